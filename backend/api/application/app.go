@@ -2,24 +2,68 @@ package application
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DanVerh/university-swe/backend/api/auth"
+	"github.com/DanVerh/university-swe/backend/api/db"
+	"github.com/DanVerh/university-swe/backend/api/handlers"
+	"github.com/DanVerh/university-swe/backend/api/logging"
+	"github.com/DanVerh/university-swe/backend/api/outbox"
+	"github.com/DanVerh/university-swe/backend/api/ratelimit"
+	"github.com/DanVerh/university-swe/backend/api/webhooks"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
 )
 
 // Define port constant value
 const port int = 8080
 
+// Time allowed for checking MongoDB at startup
+const startupCheckTimeout = 5 * time.Second
+
 // Define App struct (class)
 type App struct {
-	router http.Handler
+	router      http.Handler
+	outboxSinks []outbox.Sink
+	limitStore  ratelimit.Store
 }
 
 // Define constructor for creating object of App class
 // Pointer, because we need to modify object fields
 func New() *App {
+	authenticator, err := auth.New()
+	if err != nil {
+		slog.Error("Failed to configure authentication", "error", err)
+		os.Exit(1)
+	}
+
+	limiter, limitStore, err := newLimiter()
+	if err != nil {
+		slog.Error("Failed to configure rate limiting", "error", err)
+		os.Exit(1)
+	}
+
+	outboxSinks, err := newOutboxSinks()
+	if err != nil {
+		slog.Error("Failed to configure the outbox sinks", "error", err)
+		os.Exit(1)
+	}
+
+	prometheus.MustRegister(handlers.NewBusinessCollector())
+
 	app := &App{
-		router: loadRoutes(),
+		router:      withGRPC(loadRoutes(authenticator, limiter), handlers.NewGRPCServer(authenticator)),
+		outboxSinks: outboxSinks,
+		limitStore:  limitStore,
 	}
 
 	return app
@@ -32,12 +76,60 @@ func (app *App) Start(ctx context.Context) error {
 		Handler: app.router,
 	}
 	
-	fmt.Printf("Application started on localhost:%d\n", port)
+	// Deliver queued webhooks and relay the outbox for as long as the server runs. Both
+	// survive MongoDB being down and pick their queue up again once it is back.
+	database, err := db.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to create the background database client: %w", err)
+	}
+	defer database.DbDisconnect()
+	if err := checkTransactions(ctx, database); err != nil {
+		return err
+	}
+	workerCtx, stopWorker := context.WithCancel(ctx)
+	defer stopWorker()
+	go webhooks.NewWorker(database.Client.Database(db.DbName), nil).Run(workerCtx)
+	go outbox.NewRelay(database.Client.Database(db.DbName), app.outboxSinks...).Run(workerCtx)
+	// The in-memory rate limit store evicts refilled buckets in the background
+	if store, ok := app.limitStore.(*ratelimit.MemoryStore); ok {
+		go store.Run(workerCtx)
+	}
 
-	err := server.ListenAndServe()
+	slog.InfoContext(ctx, "Application started", "port", port)
+
+	err = server.ListenAndServe()
 	if err != nil {
 		return fmt.Errorf("failed to start server: %w", err)
 	}
 
 	return nil
 }
+
+// checkTransactions fails fast when MongoDB runs standalone, as every order and product write would fail.
+// An unreachable server is only logged, since the API survives MongoDB being down.
+func checkTransactions(ctx context.Context, database *db.Database) error {
+	ctx, cancel := context.WithTimeout(ctx, startupCheckTimeout)
+	defer cancel()
+	err := db.CheckTransactions(ctx, database.Client)
+	if errors.Is(err, db.ErrNoTransactions) {
+		return err
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to check MongoDB for transaction support", "error", err)
+	}
+	return nil
+}
+
+// withGRPC serves gRPC calls and the REST API on the same port. HTTP/2 without TLS (h2c)
+// is accepted so gRPC clients can connect with plaintext credentials.
+// gRPC calls get a request ID and an access log line like REST requests.
+func withGRPC(router http.Handler, grpcServer *grpc.Server) http.Handler {
+	grpcHandler := logging.RequestIDMiddleware(logging.Middleware(grpcServer))
+	return h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			grpcHandler.ServeHTTP(w, r)
+			return
+		}
+		router.ServeHTTP(w, r)
+	}), &http2.Server{})
+}
@@ -0,0 +1,174 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/DanVerh/university-swe/backend/api/auth"
+	"github.com/DanVerh/university-swe/backend/api/ratelimit"
+	"github.com/DanVerh/university-swe/backend/client"
+)
+
+const testSecret = "test-secret"
+
+// clientServer serves the real router behind fail, which answers a request instead of the router
+// when it returns true. requests counts every request that reached the server.
+func clientServer(t *testing.T, limits map[string]ratelimit.Limit, fail func(w http.ResponseWriter, r *http.Request) bool) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	t.Setenv("JWT_HS256_SECRET", testSecret)
+	authenticator, err := auth.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := loadRoutes(authenticator, ratelimit.New(ratelimit.NewMemoryStore(), limits))
+
+	requests := &atomic.Int32{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if fail != nil && fail(w, r) {
+			return
+		}
+		router.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+// testToken signs a JWT for the test secret with the roles
+func testToken(t *testing.T, roles ...string) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":   "client-test",
+		"roles": roles,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func newTestClient(t *testing.T, server *httptest.Server, options ...client.Option) *client.Client {
+	t.Helper()
+	apiClient, err := client.New(server.URL, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return apiClient
+}
+
+// apiError asserts that err is a *client.Error matching target
+func apiError(t *testing.T, err error, target error) *client.Error {
+	t.Helper()
+	if !errors.Is(err, target) {
+		t.Fatalf("got error %v, want %v", err, target)
+	}
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("got error %T, want *client.Error", err)
+	}
+	return apiErr
+}
+
+func TestClientRetriesServerErrors(t *testing.T) {
+	failures := int32(2)
+	server, requests := clientServer(t, nil, func(w http.ResponseWriter, r *http.Request) bool {
+		if failures == 0 {
+			return false
+		}
+		failures--
+		http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+		return true
+	})
+	apiClient := newTestClient(t, server, client.WithBearerToken(testToken(t, "viewer")), client.WithRetries(3, time.Millisecond))
+
+	// The router answers an invalid ID with a plain text 400 without reaching MongoDB
+	_, err := apiClient.GetOrder(context.Background(), "not-an-id")
+	apiErr := apiError(t, err, client.ErrBadRequest)
+	if apiErr.Message != "Invalid ObjectId format" {
+		t.Errorf("got message %q, want the plain text body", apiErr.Message)
+	}
+	if got := requests.Load(); got != 3 {
+		t.Errorf("got %d requests, want 3", got)
+	}
+}
+
+func TestClientGivesUpAfterMaxRetries(t *testing.T) {
+	server, requests := clientServer(t, nil, func(w http.ResponseWriter, r *http.Request) bool {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return true
+	})
+	apiClient := newTestClient(t, server, client.WithBearerToken(testToken(t, "viewer")), client.WithRetries(2, time.Millisecond))
+
+	_, err := apiClient.ListOrders(context.Background())
+	apiError(t, err, client.ErrServer)
+	if got := requests.Load(); got != 3 {
+		t.Errorf("got %d requests, want 3", got)
+	}
+}
+
+func TestClientDoesNotRetryPost(t *testing.T) {
+	server, requests := clientServer(t, nil, func(w http.ResponseWriter, r *http.Request) bool {
+		http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+		return true
+	})
+	apiClient := newTestClient(t, server, client.WithBearerToken(testToken(t, "sales")), client.WithRetries(3, time.Millisecond))
+
+	_, err := apiClient.CreateOrder(context.Background(), client.Order{})
+	apiError(t, err, client.ErrServer)
+	if got := requests.Load(); got != 1 {
+		t.Errorf("got %d requests, want 1", got)
+	}
+}
+
+func TestClientWaitsForRetryAfter(t *testing.T) {
+	// One request per second, so the second request is rejected with Retry-After: 1
+	limits := map[string]ratelimit.Limit{"auth": {Rate: 1, Burst: 1}}
+	server, requests := clientServer(t, limits, nil)
+	apiClient := newTestClient(t, server, client.WithBearerToken(testToken(t, "viewer")), client.WithRetries(1, time.Millisecond))
+
+	_, err := apiClient.GetOrder(context.Background(), "not-an-id")
+	apiError(t, err, client.ErrBadRequest)
+
+	start := time.Now()
+	_, err = apiClient.GetOrder(context.Background(), "not-an-id")
+	apiError(t, err, client.ErrBadRequest)
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, want the Retry-After delay of 1s", elapsed)
+	}
+	if got := requests.Load(); got != 3 {
+		t.Errorf("got %d requests, want 3", got)
+	}
+}
+
+func TestClientErrorsFromProblemDetails(t *testing.T) {
+	limits := map[string]ratelimit.Limit{"auth": {Rate: 1.0 / 60, Burst: 2}}
+	server, _ := clientServer(t, limits, nil)
+
+	invalid := newTestClient(t, server, client.WithBearerToken("not-a-token"), client.WithRetries(0, 0))
+	_, err := invalid.ListOrders(context.Background())
+	apiErr := apiError(t, err, client.ErrUnauthorized)
+	if apiErr.Message != "Invalid credentials" || apiErr.RequestID == "" {
+		t.Errorf("got message %q and request ID %q, want the problem detail and its request ID", apiErr.Message, apiErr.RequestID)
+	}
+
+	viewer := newTestClient(t, server, client.WithBearerToken(testToken(t, "viewer")), client.WithRetries(0, 0))
+	err = viewer.DeleteOrder(context.Background(), "not-an-id")
+	apiErr = apiError(t, err, client.ErrForbidden)
+	if apiErr.Message == "" {
+		t.Error("got no message, want the problem detail")
+	}
+
+	_, err = viewer.ListOrders(context.Background())
+	apiErr = apiError(t, err, client.ErrRateLimited)
+	if apiErr.RetryAfter <= 0 {
+		t.Errorf("got Retry-After %v, want a delay", apiErr.RetryAfter)
+	}
+}
@@ -0,0 +1,67 @@
+package application
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/DanVerh/university-swe/backend/api/db"
+	"github.com/DanVerh/university-swe/backend/api/ratelimit"
+)
+
+// Default rate limits of the route groups, overridable with RATE_LIMIT_<GROUP>=<requests>/<s|m|h>.
+// The auth group limits every request per client IP before its credentials are looked up,
+// so floods of invalid credentials are throttled too.
+var defaultRateLimits = map[string]string{
+	"auth":       "1200/m",
+	"products":   "300/m",
+	"categories": "300/m",
+	"customers":  "300/m",
+	"orders":     "300/m",
+	"reports":    "60/m",
+	"audit":      "60/m",
+	"webhooks":   "60/m",
+	"graphql":    "120/m",
+	"batch":      "10/m",
+}
+
+// newLimiter creates the rate limiter with the store selected by RATE_LIMIT_STORE:
+// memory (default) for a single replica or mongo to share limits between replicas.
+// The store is returned too, so the app can run the sweep of the in-memory store.
+func newLimiter() (*ratelimit.Limiter, ratelimit.Store, error) {
+	limits := map[string]ratelimit.Limit{}
+	for group, value := range defaultRateLimits {
+		if override := os.Getenv("RATE_LIMIT_" + strings.ToUpper(group)); override != "" {
+			value = override
+		}
+		limit, err := ratelimit.ParseLimit(value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("rate limit of %s: %w", group, err)
+		}
+		limits[group] = limit
+	}
+
+	var store ratelimit.Store
+	switch os.Getenv("RATE_LIMIT_STORE") {
+	case "", "memory":
+		store = ratelimit.NewMemoryStore()
+	case "mongo":
+		// The store keeps its connection for the lifetime of the app
+		database := db.DbConnect()
+		store = ratelimit.NewMongoStore(database.Client.Database(db.DbName))
+	default:
+		return nil, nil, fmt.Errorf("unknown RATE_LIMIT_STORE %q, needs to be memory or mongo", os.Getenv("RATE_LIMIT_STORE"))
+	}
+
+	return ratelimit.New(store, limits), store, nil
+}
+
+// limited applies the rate limit of the group to the routes defined by load
+func limited(limiter *ratelimit.Limiter, group string, load func(chi.Router)) func(chi.Router) {
+	return func(router chi.Router) {
+		router.Use(limiter.Middleware(group))
+		load(router)
+	}
+}
@@ -0,0 +1,30 @@
+package application
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DanVerh/university-swe/backend/api/auth"
+	"github.com/DanVerh/university-swe/backend/api/ratelimit"
+)
+
+func TestInvalidCredentialsAreRateLimited(t *testing.T) {
+	t.Setenv("JWT_HS256_SECRET", "test-secret")
+	authenticator, err := auth.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := ratelimit.New(ratelimit.NewMemoryStore(), map[string]ratelimit.Limit{"auth": {Rate: 1.0 / 60, Burst: 2}})
+	router := loadRoutes(authenticator, limiter)
+
+	for i, want := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests} {
+		request := httptest.NewRequest(http.MethodGet, "/v1/products", nil)
+		request.Header.Set("Authorization", "Bearer not-a-token")
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		if response.Code != want {
+			t.Fatalf("request %d got %d, want %d", i+1, response.Code, want)
+		}
+	}
+}
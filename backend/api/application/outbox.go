@@ -0,0 +1,40 @@
+package application
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/DanVerh/university-swe/backend/api/outbox"
+)
+
+// newOutboxSinks creates the sinks listed in OUTBOX_SINKS, comma-separated, default log:
+//   - log writes every event to the application log
+//   - webhook posts to OUTBOX_WEBHOOK_URL, signed with OUTBOX_WEBHOOK_SECRET
+//   - nats and kafka publish to in-process stand-ins of the brokers with the same
+//     subjects and partition keys, for development until a broker client is configured
+func newOutboxSinks() ([]outbox.Sink, error) {
+	names := os.Getenv("OUTBOX_SINKS")
+	if names == "" {
+		names = "log"
+	}
+
+	var sinks []outbox.Sink
+	for _, name := range strings.Split(names, ",") {
+		switch name = strings.TrimSpace(name); name {
+		case "log":
+			sinks = append(sinks, outbox.LogSink{})
+		case "webhook":
+			url := os.Getenv("OUTBOX_WEBHOOK_URL")
+			if url == "" {
+				return nil, fmt.Errorf("the webhook outbox sink needs OUTBOX_WEBHOOK_URL")
+			}
+			sinks = append(sinks, outbox.NewWebhookSink(url, os.Getenv("OUTBOX_WEBHOOK_SECRET"), nil))
+		case "nats", "kafka":
+			sinks = append(sinks, outbox.NewBrokerSink(name, outbox.NewMemoryBroker()))
+		default:
+			return nil, fmt.Errorf("unknown outbox sink %q, needs to be log, webhook, nats or kafka", name)
+		}
+	}
+	return sinks, nil
+}
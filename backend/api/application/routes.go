@@ -4,24 +4,46 @@ import (
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
 
+	"github.com/DanVerh/university-swe/backend/api/auth"
 	"github.com/DanVerh/university-swe/backend/api/handlers"
+	"github.com/DanVerh/university-swe/backend/api/logging"
+	"github.com/DanVerh/university-swe/backend/api/metrics"
+	"github.com/DanVerh/university-swe/backend/api/openapi"
+	"github.com/DanVerh/university-swe/backend/api/ratelimit"
+	"github.com/DanVerh/university-swe/backend/api/tracing"
 )
 
 // Create router with confgiured routes
-func loadRoutes() *chi.Mux {
+func loadRoutes(authenticator *auth.Authenticator, limiter *ratelimit.Limiter) *chi.Mux {
 	router := chi.NewRouter()
 
-	router.Use(middleware.Logger)
+	router.Use(logging.RequestIDMiddleware)
+	router.Use(tracing.Middleware)
+	router.Use(logging.Middleware)
+	router.Use(metrics.Middleware)
 
-	router.Get("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-	})
+	// Probes are open so the orchestrator can call them without credentials.
+	// /health is kept for existing checks and behaves like /livez.
+	healthHandler := &handlers.HealthHandler{}
+	router.Get("/health", healthHandler.Livez)
+	router.Get("/livez", healthHandler.Livez)
+	router.Get("/readyz", healthHandler.Readyz)
 
-	router.Route("/products", loadProductsRoutes)
-	router.Route("/customers", loadCustomersRoutes)
-	router.Route("/orders", loadOrdersRoutes)
+	// Prometheus scrapes without credentials, like the health check
+	router.Method(http.MethodGet, "/metrics", metrics.Handler())
+
+	// The API description is public so clients can generate code from it
+	spec := handlers.OpenAPI()
+	router.Get("/openapi.json", openapi.Handler(spec))
+	router.Get("/docs", openapi.UIHandler(spec.Info.Title, "/openapi.json"))
+
+	// Every route except the probes, /metrics and the docs requires an authenticated principal
+	loadVersions(router, authenticator, limiter)
+
+	// GraphQL is not versioned, its fields are deprecated in the schema instead.
+	// Each field checks the permission of its collection.
+	router.With(limiter.Middleware("auth"), authenticator.Middleware, limiter.Middleware("graphql")).Post("/graphql", (&handlers.GraphQLHandler{}).Serve)
 
 	return router
 }
@@ -29,28 +51,91 @@ func loadRoutes() *chi.Mux {
 // Define all routes with HTTP methods
 func loadProductsRoutes(router chi.Router) {
 	productsHandler := &handlers.ProductsHandler{}
-	router.Post("/", productsHandler.Create)
-	router.Get("/", productsHandler.List)
-	router.Get("/{id}", productsHandler.GetByID)
-	router.Put("/{id}", productsHandler.UpdateByID)
-	router.Delete("/{id}", productsHandler.DeleteByID)
+	router.With(auth.Require(auth.ProductsWrite)).Post("/", productsHandler.Create)
+	router.With(auth.Require(auth.ProductsRead)).Get("/", productsHandler.List)
+	router.With(auth.Require(auth.ProductsWrite)).Post("/import", productsHandler.Import)
+	router.With(auth.Require(auth.ProductsRead)).Get("/by-sku/{sku}", productsHandler.GetBySKU)
+	router.With(auth.Require(auth.ProductsRead)).Get("/by-barcode/{code}", productsHandler.GetByBarcode)
+	router.With(auth.Require(auth.ProductsRead)).Get("/{id}", productsHandler.GetByID)
+	router.With(auth.Require(auth.ProductsWrite)).Put("/{id}", productsHandler.UpdateByID)
+	router.With(auth.Require(auth.ProductsDelete)).Delete("/{id}", productsHandler.DeleteByID)
+	router.With(auth.Require(auth.ProductsRead)).Get("/{id}/barcode", productsHandler.Barcode)
+	router.With(auth.Require(auth.ProductsWrite)).Put("/{id}/options", productsHandler.SetOptions)
+	router.With(auth.Require(auth.ProductsRead)).Get("/{id}/variants", productsHandler.ListVariants)
+	router.With(auth.Require(auth.ProductsWrite)).Post("/{id}/variants", productsHandler.CreateVariant)
+	router.With(auth.Require(auth.ProductsWrite)).Put("/{id}/variants/{variantId}", productsHandler.UpdateVariant)
+	router.With(auth.Require(auth.ProductsDelete)).Delete("/{id}/variants/{variantId}", productsHandler.DeleteVariant)
+}
+
+// Categories are part of the catalogue, so they share the permissions of products
+func loadCategoriesRoutes(router chi.Router) {
+	categoriesHandler := &handlers.CategoriesHandler{}
+	router.With(auth.Require(auth.ProductsWrite)).Post("/", categoriesHandler.Create)
+	router.With(auth.Require(auth.ProductsRead)).Get("/", categoriesHandler.List)
+	router.With(auth.Require(auth.ProductsRead)).Get("/{id}", categoriesHandler.GetByID)
+	router.With(auth.Require(auth.ProductsWrite)).Put("/{id}", categoriesHandler.UpdateByID)
+	router.With(auth.Require(auth.ProductsDelete)).Delete("/{id}", categoriesHandler.DeleteByID)
+	router.With(auth.Require(auth.ProductsWrite)).Post("/{id}/move", categoriesHandler.Move)
+	router.With(auth.Require(auth.ProductsRead)).Get("/{id}/products", categoriesHandler.Products)
 }
 
 func loadCustomersRoutes(router chi.Router) {
 	customersHandler := &handlers.CustomersHandler{}
-	router.Post("/", customersHandler.Create)
-	router.Get("/", customersHandler.List)
-	router.Get("/{id}", customersHandler.GetByID)
-	router.Put("/{id}", customersHandler.UpdateByID)
-	router.Delete("/{id}", customersHandler.DeleteByID)
+	router.With(auth.Require(auth.CustomersWrite)).Post("/", customersHandler.Create)
+	router.With(auth.Require(auth.CustomersRead)).Get("/", customersHandler.List)
+	router.With(auth.Require(auth.CustomersWrite)).Post("/import", customersHandler.Import)
+	router.With(auth.Require(auth.CustomersRead)).Get("/{id}", customersHandler.GetByID)
+	router.With(auth.Require(auth.CustomersWrite)).Put("/{id}", customersHandler.UpdateByID)
+	router.With(auth.Require(auth.CustomersDelete)).Delete("/{id}", customersHandler.DeleteByID)
 }
 
 func loadOrdersRoutes(router chi.Router) {
 	ordersHandler := &handlers.OrdersHandler{}
-	router.Post("/", ordersHandler.Create)
-	router.Get("/", ordersHandler.List)
-	router.Get("/{id}", ordersHandler.GetByID)
-	router.Put("/{id}", ordersHandler.UpdateByID)
-	router.Delete("/{id}", ordersHandler.DeleteByID)
-	router.Get("/sum", ordersHandler.SumDeliveredOrders)
-}
\ No newline at end of file
+	router.With(auth.Require(auth.OrdersWrite)).Post("/", ordersHandler.Create)
+	router.With(auth.Require(auth.OrdersRead)).Get("/", ordersHandler.List)
+	router.With(auth.Require(auth.OrdersRead)).Get("/{id}", ordersHandler.GetByID)
+	// Only the status of an order can be updated
+	router.With(auth.Require(auth.OrdersStatus)).Put("/{id}", ordersHandler.UpdateByID)
+	router.With(auth.Require(auth.OrdersDelete)).Delete("/{id}", ordersHandler.DeleteByID)
+	// Changes other than the status are recorded in the event log of the order
+	router.With(auth.Require(auth.OrdersRead)).Get("/{id}/history", ordersHandler.History)
+	router.With(auth.Require(auth.OrdersWrite)).Put("/{id}/line", ordersHandler.ChangeLine)
+	router.With(auth.Require(auth.OrdersPayments)).Post("/{id}/payments", ordersHandler.RecordPayment)
+	router.With(auth.Require(auth.OrdersPayments)).Post("/{id}/refunds", ordersHandler.Refund)
+	router.With(auth.Require(auth.ReportsRead)).Get("/sum", ordersHandler.SumDeliveredOrders)
+	// Pushed to the warehouse screen instead of polling the list
+	router.With(auth.Require(auth.OrdersRead)).Get("/events", ordersHandler.Events)
+	router.With(auth.Require(auth.OrdersRead)).Get("/events/ws", ordersHandler.EventsWebSocket)
+}
+
+func loadBatchRoutes(router chi.Router) {
+	router.With(auth.Require(auth.ProductsWrite)).Post("/products:batch", (&handlers.ProductsHandler{}).Batch)
+	router.With(auth.Require(auth.CustomersWrite)).Post("/customers:batch", (&handlers.CustomersHandler{}).Batch)
+	router.With(auth.Require(auth.OrdersWrite)).Post("/orders:batch", (&handlers.OrdersHandler{}).Batch)
+}
+
+func loadReportsRoutes(router chi.Router) {
+	reportsHandler := &handlers.ReportsHandler{}
+	router.Use(auth.Require(auth.ReportsRead))
+	router.Get("/sales", reportsHandler.Sales)
+	router.Get("/top-products", reportsHandler.TopProducts)
+	router.Get("/top-customers", reportsHandler.TopCustomers)
+	router.Get("/customers/rfm", reportsHandler.CustomerSegments)
+}
+
+func loadAuditRoutes(router chi.Router) {
+	auditHandler := &handlers.AuditHandler{}
+	router.With(auth.Require(auth.AuditRead)).Get("/", auditHandler.List)
+}
+
+func loadWebhooksRoutes(router chi.Router) {
+	webhooksHandler := &handlers.WebhooksHandler{}
+	router.Use(auth.Require(auth.WebhooksManage))
+	router.Post("/", webhooksHandler.Create)
+	router.Get("/", webhooksHandler.List)
+	router.Get("/{id}", webhooksHandler.GetByID)
+	router.Put("/{id}", webhooksHandler.UpdateByID)
+	router.Delete("/{id}", webhooksHandler.DeleteByID)
+	router.Get("/{id}/deliveries", webhooksHandler.Deliveries)
+	router.Post("/{id}/deliveries/{deliveryId}/redeliver", webhooksHandler.Redeliver)
+}
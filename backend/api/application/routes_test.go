@@ -0,0 +1,54 @@
+package application
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/DanVerh/university-swe/backend/api/auth"
+	"github.com/DanVerh/university-swe/backend/api/handlers"
+	"github.com/DanVerh/university-swe/backend/api/openapi"
+	"github.com/DanVerh/university-swe/backend/api/ratelimit"
+)
+
+func TestRoutesAreDocumented(t *testing.T) {
+	authenticator, err := auth.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := loadRoutes(authenticator, ratelimit.New(ratelimit.NewMemoryStore(), nil))
+
+	for _, route := range openapi.Undocumented(handlers.OpenAPI(), router) {
+		t.Errorf("route %s is missing from the OpenAPI document", route)
+	}
+}
+
+// idempotentPuts are the PUT routes reviewed to set absolute values, so the client may retry them.
+// Changes that add to a value, like payments and refunds, are POST routes.
+var idempotentPuts = map[string]bool{
+	"/products/{id}":                      true,
+	"/products/{id}/options":              true,
+	"/products/{id}/variants/{variantId}": true,
+	"/categories/{id}":                    true,
+	"/customers/{id}":                     true,
+	"/orders/{id}":                        true,
+	"/orders/{id}/line":                   true,
+	"/webhooks/{id}":                      true,
+}
+
+func TestPutRoutesAreIdempotent(t *testing.T) {
+	authenticator, err := auth.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := loadRoutes(authenticator, ratelimit.New(ratelimit.NewMemoryStore(), nil))
+
+	chi.Walk(router, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if method == http.MethodPut && !idempotentPuts[strings.TrimPrefix(route, "/v1")] {
+			t.Errorf("PUT %s is retried by the client but is not in the reviewed idempotent routes", route)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,69 @@
+package application
+
+import (
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/DanVerh/university-swe/backend/api/auth"
+	"github.com/DanVerh/university-swe/backend/api/ratelimit"
+	"github.com/DanVerh/university-swe/backend/api/versioning"
+)
+
+// apiVersion is a set of routes mounted under /<name>
+type apiVersion struct {
+	name   string
+	routes func(limiter *ratelimit.Limiter) func(chi.Router)
+	// deprecation is set once a successor version exists
+	deprecation *versioning.Deprecation
+}
+
+// apiVersions are served side by side. A new version gets its own route loader,
+// e.g. {name: "v2", routes: loadV2Routes}, and the previous one a deprecation with "/v2" as successor.
+var apiVersions = []apiVersion{
+	{name: "v1", routes: loadV1Routes},
+}
+
+// unversioned deprecates the paths without version prefix, which serve the /v1 routes until the sunset
+var unversioned = versioning.Deprecation{
+	Since:     time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC),
+	Sunset:    time.Date(2027, time.April, 1, 0, 0, 0, 0, time.UTC),
+	Successor: "/v1",
+}
+
+// loadVersions mounts every API version and the deprecated unversioned aliases of /v1.
+// Deprecation headers are set before authentication so rejected requests carry them too.
+// The auth limit runs before authentication, so it is keyed by client IP.
+func loadVersions(router chi.Router, authenticator *auth.Authenticator, limiter *ratelimit.Limiter) {
+	for _, version := range apiVersions {
+		router.Route("/"+version.name, func(router chi.Router) {
+			if version.deprecation != nil {
+				router.Use(versioning.Deprecated(*version.deprecation))
+			}
+			router.Use(limiter.Middleware("auth"), authenticator.Middleware)
+			version.routes(limiter)(router)
+		})
+	}
+
+	router.Group(func(router chi.Router) {
+		router.Use(versioning.Deprecated(unversioned))
+		router.Use(limiter.Middleware("auth"), authenticator.Middleware)
+		loadV1Routes(limiter)(router)
+	})
+}
+
+// loadV1Routes returns the routes of version 1
+func loadV1Routes(limiter *ratelimit.Limiter) func(chi.Router) {
+	return func(router chi.Router) {
+		router.Route("/products", limited(limiter, "products", loadProductsRoutes))
+		router.Route("/categories", limited(limiter, "categories", loadCategoriesRoutes))
+		router.Route("/customers", limited(limiter, "customers", loadCustomersRoutes))
+		router.Route("/orders", limited(limiter, "orders", loadOrdersRoutes))
+		router.Route("/reports", limited(limiter, "reports", loadReportsRoutes))
+		router.Route("/audit", limited(limiter, "audit", loadAuditRoutes))
+		router.Route("/webhooks", limited(limiter, "webhooks", loadWebhooksRoutes))
+
+		// Batch routes live next to the collections, e.g. POST /v1/products:batch
+		router.Group(limited(limiter, "batch", loadBatchRoutes))
+	}
+}
@@ -0,0 +1,162 @@
+package audit
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/DanVerh/university-swe/backend/api/auth"
+	"github.com/DanVerh/university-swe/backend/api/logging"
+)
+
+// Mongo collection name for audit records. Records are only ever inserted.
+const Collection = "audit"
+
+// Audited operations
+const (
+	OperationCreate = "create"
+	OperationUpdate = "update"
+	OperationDelete = "delete"
+	OperationStatus = "status"
+	OperationUpsert = "upsert"
+)
+
+// Actor recorded for changes made outside of an authenticated request, e.g. by the import CLI
+const systemActor = "system"
+
+// Change is the before and after value of a single field
+type Change struct {
+	Field  string      `json:"field" bson:"field"`
+	Before interface{} `json:"before,omitempty" bson:"before,omitempty"`
+	After  interface{} `json:"after,omitempty" bson:"after,omitempty"`
+}
+
+// Record is a single audited change of a resource
+type Record struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id"`
+	Timestamp  time.Time          `json:"timestamp" bson:"timestamp"`
+	Actor      string             `json:"actor" bson:"actor"`
+	ActorType  string             `json:"actorType,omitempty" bson:"actorType,omitempty"`
+	Resource   string             `json:"resource" bson:"resource"`
+	ResourceID primitive.ObjectID `json:"resourceId" bson:"resourceId"`
+	Operation  string             `json:"operation" bson:"operation"`
+	Changes    []Change           `json:"changes" bson:"changes"`
+	RequestID  string             `json:"requestId,omitempty" bson:"requestId,omitempty"`
+}
+
+// New creates a record of the change made by the principal of the context.
+// before is nil for creates and after is nil for deletes.
+func New(ctx context.Context, resource string, id primitive.ObjectID, operation string, before, after interface{}) Record {
+	record := Record{
+		ID:         primitive.NewObjectID(),
+		Timestamp:  time.Now().UTC(),
+		Actor:      systemActor,
+		Resource:   resource,
+		ResourceID: id,
+		Operation:  operation,
+		Changes:    Diff(ctx, before, after),
+		RequestID:  logging.RequestID(ctx),
+	}
+	if principal := auth.FromContext(ctx); principal != nil {
+		record.Actor = principal.Subject
+		record.ActorType = principal.Type
+	}
+	return record
+}
+
+// Append inserts the records into the audit collection. A failure is logged
+// rather than returned, as the audited change has already been written.
+func Append(ctx context.Context, database *mongo.Database, records ...Record) {
+	if len(records) == 0 {
+		return
+	}
+	documents := make([]interface{}, len(records))
+	for i := range records {
+		documents[i] = records[i]
+	}
+	if _, err := database.Collection(Collection).InsertMany(ctx, documents); err != nil {
+		slog.ErrorContext(ctx, "Failed to write audit records", "count", len(records), "error", err)
+	}
+}
+
+// Write creates and appends a single record
+func Write(ctx context.Context, database *mongo.Database, resource string, id primitive.ObjectID, operation string, before, after interface{}) {
+	Append(ctx, database, New(ctx, resource, id, operation, before, after))
+}
+
+// ApplySet returns a copy of the document with the $set fields applied, i.e. the document after the update
+func ApplySet(document bson.M, set bson.M) bson.M {
+	after := bson.M{}
+	for key, value := range document {
+		after[key] = value
+	}
+	for key, value := range set {
+		after[key] = value
+	}
+	return after
+}
+
+// ApplyUpdate returns a copy of the document with the $set and $unset fields of the update applied
+func ApplyUpdate(document bson.M, update bson.M) bson.M {
+	set, _ := update["$set"].(bson.M)
+	after := ApplySet(document, set)
+	if unset, ok := update["$unset"].(bson.M); ok {
+		for key := range unset {
+			delete(after, key)
+		}
+	}
+	return after
+}
+
+// Diff lists the fields whose value differs between before and after, ignoring _id.
+// Models are compared by their bson representation.
+func Diff(ctx context.Context, before, after interface{}) []Change {
+	beforeFields := toDocument(ctx, before)
+	afterFields := toDocument(ctx, after)
+
+	fields := map[string]bool{}
+	for field := range beforeFields {
+		fields[field] = true
+	}
+	for field := range afterFields {
+		fields[field] = true
+	}
+	delete(fields, "_id")
+
+	names := make([]string, 0, len(fields))
+	for field := range fields {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+
+	changes := []Change{}
+	for _, field := range names {
+		if !reflect.DeepEqual(beforeFields[field], afterFields[field]) {
+			changes = append(changes, Change{Field: field, Before: beforeFields[field], After: afterFields[field]})
+		}
+	}
+	return changes
+}
+
+// toDocument normalizes a model or document into a bson.M with bson field names and types
+func toDocument(ctx context.Context, value interface{}) bson.M {
+	document := bson.M{}
+	if value == nil || reflect.ValueOf(value).Kind() == reflect.Ptr && reflect.ValueOf(value).IsNil() {
+		return document
+	}
+	data, err := bson.Marshal(value)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to marshal audited document", "error", err)
+		return document
+	}
+	if err := bson.Unmarshal(data, &document); err != nil {
+		slog.ErrorContext(ctx, "Failed to unmarshal audited document", "error", err)
+	}
+	return document
+}
@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Mongo collection name for API keys
+const apiKeysCollection = "apiKeys"
+
+// Prefix of every issued API key, used to tell keys apart from JWTs
+const apiKeyPrefix = "sk_"
+
+// How long a verified API key is accepted without a lookup. A revoked key stays usable for at most this long.
+const apiKeyCacheTTL = 30 * time.Second
+
+// ErrAPIKeyNotFound is returned when revoking a key that does not exist
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
+// errInvalidAPIKey is returned for unknown and revoked keys
+var errInvalidAPIKey = errors.New("invalid or revoked API key")
+
+// APIKey represents an API key in the database. Only the SHA-256 hash of the key is stored.
+type APIKey struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	Name      string             `json:"name" bson:"name"`
+	Prefix    string             `json:"prefix" bson:"prefix"`
+	Hash      string             `json:"-" bson:"hash"`
+	Roles     []string           `json:"roles" bson:"roles"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	RevokedAt *time.Time         `json:"revokedAt,omitempty" bson:"revokedAt,omitempty"`
+}
+
+// IssueAPIKey generates a new key with the given roles, stores its hash and returns the plaintext key,
+// which is shown only once
+func IssueAPIKey(ctx context.Context, database *mongo.Database, name string, roles []string) (string, *APIKey, error) {
+	if name == "" {
+		return "", nil, errors.New("name is required")
+	}
+	for _, role := range roles {
+		if !ValidRole(role) {
+			return "", nil, fmt.Errorf("unknown role %q", role)
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	plaintext := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	key := &APIKey{
+		ID:        primitive.NewObjectID(),
+		Name:      name,
+		Prefix:    plaintext[:len(apiKeyPrefix)+6],
+		Hash:      hashAPIKey(plaintext),
+		Roles:     roles,
+		CreatedAt: time.Now().UTC(),
+	}
+	if _, err := database.Collection(apiKeysCollection).InsertOne(ctx, key); err != nil {
+		return "", nil, err
+	}
+	return plaintext, key, nil
+}
+
+// RevokeAPIKey marks the key as revoked. Running servers stop accepting it once their cached
+// verification expires, after at most apiKeyCacheTTL.
+func RevokeAPIKey(ctx context.Context, database *mongo.Database, id primitive.ObjectID) error {
+	result, err := database.Collection(apiKeysCollection).UpdateOne(ctx,
+		bson.M{"_id": id, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now().UTC()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// ListAPIKeys returns every issued key, including revoked ones
+func ListAPIKeys(ctx context.Context, database *mongo.Database) ([]APIKey, error) {
+	cursor, err := database.Collection(apiKeysCollection).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	keys := []APIKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// verifyAPIKey looks up an active key by the hash of its plaintext and returns its principal
+func verifyAPIKey(ctx context.Context, database *mongo.Database, hash string) (*Principal, error) {
+	var key APIKey
+	err := database.Collection(apiKeysCollection).FindOne(ctx, bson.M{
+		"hash":      hash,
+		"revokedAt": bson.M{"$exists": false},
+	}).Decode(&key)
+	if err == mongo.ErrNoDocuments {
+		return nil, errInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Principal{Subject: "apikey:" + key.ID.Hex(), Type: PrincipalAPIKey, Name: key.Name, Roles: key.Roles}, nil
+}
+
+func isAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, apiKeyPrefix)
+}
+
+func hashAPIKey(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeyCache holds the principals of verified API keys by key hash. Unknown keys are never cached,
+// so guessing keys cannot grow it.
+type apiKeyCache struct {
+	ttl     time.Duration
+	mutex   sync.Mutex
+	entries map[string]cachedAPIKey
+}
+
+type cachedAPIKey struct {
+	principal *Principal
+	expires   time.Time
+}
+
+func newAPIKeyCache(ttl time.Duration) *apiKeyCache {
+	return &apiKeyCache{ttl: ttl, entries: map[string]cachedAPIKey{}}
+}
+
+// get returns the principal of a verified key, nil if it is not cached or expired
+func (cache *apiKeyCache) get(hash string) *Principal {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	entry, ok := cache.entries[hash]
+	if !ok || time.Now().After(entry.expires) {
+		return nil
+	}
+	return entry.principal
+}
+
+// put caches the principal of a verified key and drops the expired entries
+func (cache *apiKeyCache) put(hash string, principal *Principal) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	now := time.Now()
+	for cached, entry := range cache.entries {
+		if now.After(entry.expires) {
+			delete(cache.entries, cached)
+		}
+	}
+	cache.entries[hash] = cachedAPIKey{principal: principal, expires: now.Add(cache.ttl)}
+}
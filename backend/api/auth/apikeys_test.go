@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAPIKeyCache(t *testing.T) {
+	cache := newAPIKeyCache(time.Hour)
+	hash := hashAPIKey("sk_test")
+	if cache.get(hash) != nil {
+		t.Fatal("empty cache returned a principal")
+	}
+
+	principal := &Principal{Subject: "apikey:1", Type: PrincipalAPIKey, Roles: []string{"viewer"}}
+	cache.put(hash, principal)
+	if got := cache.get(hash); got != principal {
+		t.Fatalf("got %v, want the cached principal", got)
+	}
+	if cache.get(hashAPIKey("sk_other")) != nil {
+		t.Fatal("cache returned a principal for another key")
+	}
+}
+
+func TestAPIKeyCacheExpiry(t *testing.T) {
+	cache := newAPIKeyCache(-time.Second)
+	cache.put("expired", &Principal{Subject: "apikey:1"})
+	if cache.get("expired") != nil {
+		t.Fatal("expired entry returned a principal")
+	}
+	cache.put("other", &Principal{Subject: "apikey:2"})
+	if _, ok := cache.entries["expired"]; ok {
+		t.Fatal("expired entry was not dropped")
+	}
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryInterceptor is the gRPC counterpart of Middleware for unary calls
+func (authenticator *Authenticator) UnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := authenticator.authenticateCall(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamInterceptor is the gRPC counterpart of Middleware for streaming calls
+func (authenticator *Authenticator) StreamInterceptor(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := authenticator.authenticateCall(stream.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+}
+
+// authenticateCall reads the same credentials as Middleware from the call metadata
+// ("authorization: Bearer <jwt|api key>" or "x-api-key") and stores the principal in the context
+func (authenticator *Authenticator) authenticateCall(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var credential string
+	if values := md.Get("x-api-key"); len(values) > 0 {
+		credential = values[0]
+	}
+	if credential == "" {
+		if values := md.Get("authorization"); len(values) > 0 {
+			scheme, token, _ := strings.Cut(values[0], " ")
+			if strings.EqualFold(scheme, "Bearer") {
+				credential = strings.TrimSpace(token)
+			}
+		}
+	}
+	if credential == "" {
+		return nil, status.Error(codes.Unauthenticated, "Missing credentials")
+	}
+
+	principal, err := authenticator.Authenticate(ctx, credential)
+	if errors.Is(err, ErrInvalidCredentials) {
+		return nil, status.Error(codes.Unauthenticated, "Invalid credentials")
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to verify API key", "error", err)
+		return nil, status.Error(codes.Internal, "Failed to verify API key")
+	}
+	return WithPrincipal(ctx, principal), nil
+}
+
+// authenticatedStream replaces the context of a stream with one that carries the principal
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream *authenticatedStream) Context() context.Context {
+	return stream.ctx
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwtVerifier validates bearer tokens signed with the locally configured keys
+type jwtVerifier struct {
+	hmacSecret []byte
+	rsaKey     *rsa.PublicKey
+	issuer     string
+	audience   string
+}
+
+// newJWTVerifier reads the signing keys from the environment:
+// JWT_HS256_SECRET for HS256, JWT_RS256_PUBLIC_KEY_FILE (PEM) for RS256,
+// and the optional JWT_ISSUER and JWT_AUDIENCE claims to enforce.
+func newJWTVerifier() (*jwtVerifier, error) {
+	verifier := &jwtVerifier{
+		hmacSecret: []byte(os.Getenv("JWT_HS256_SECRET")),
+		issuer:     os.Getenv("JWT_ISSUER"),
+		audience:   os.Getenv("JWT_AUDIENCE"),
+	}
+
+	if path := os.Getenv("JWT_RS256_PUBLIC_KEY_FILE"); path != "" {
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read RS256 public key: %w", err)
+		}
+		verifier.rsaKey, err = jwt.ParseRSAPublicKeyFromPEM(pem)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse RS256 public key: %w", err)
+		}
+	}
+
+	return verifier, nil
+}
+
+// enabled reports whether any signing key is configured
+func (verifier *jwtVerifier) enabled() bool {
+	return len(verifier.hmacSecret) > 0 || verifier.rsaKey != nil
+}
+
+// verify checks the signature and standard claims of the token and returns its principal
+func (verifier *jwtVerifier) verify(tokenString string) (*Principal, error) {
+	if !verifier.enabled() {
+		return nil, errors.New("JWT authentication is not configured")
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"HS256", "RS256"}),
+		jwt.WithExpirationRequired(),
+	}
+	if verifier.issuer != "" {
+		options = append(options, jwt.WithIssuer(verifier.issuer))
+	}
+	if verifier.audience != "" {
+		options = append(options, jwt.WithAudience(verifier.audience))
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, verifier.key, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	subject, err := claims.GetSubject()
+	if err != nil || subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+
+	principal := &Principal{Subject: subject, Type: PrincipalJWT, Roles: rolesClaim(claims["roles"])}
+	principal.Name, _ = claims["name"].(string)
+	return principal, nil
+}
+
+// rolesClaim reads the roles claim as a JSON array or a space separated string
+func rolesClaim(claim interface{}) []string {
+	switch value := claim.(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		roles := make([]string, 0, len(value))
+		for _, role := range value {
+			if role, ok := role.(string); ok {
+				roles = append(roles, role)
+			}
+		}
+		return roles
+	}
+	return nil
+}
+
+// key returns the verification key matching the signing method of the token
+func (verifier *jwtVerifier) key(token *jwt.Token) (interface{}, error) {
+	switch token.Method.Alg() {
+	case "HS256":
+		if len(verifier.hmacSecret) == 0 {
+			return nil, errors.New("HS256 tokens are not accepted")
+		}
+		return verifier.hmacSecret, nil
+	case "RS256":
+		if verifier.rsaKey == nil {
+			return nil, errors.New("RS256 tokens are not accepted")
+		}
+		return verifier.rsaKey, nil
+	}
+	return nil, fmt.Errorf("unexpected signing method %v", token.Method.Alg())
+}
@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/DanVerh/university-swe/backend/api/db"
+	"github.com/DanVerh/university-swe/backend/api/errorHandling"
+)
+
+// Time allowed to look up an API key in MongoDB
+const apiKeyLookupTimeout = 5 * time.Second
+
+// Authenticator verifies the credentials of incoming requests
+type Authenticator struct {
+	jwt *jwtVerifier
+	// keys caches verified API keys so most requests skip the MongoDB lookup
+	keys *apiKeyCache
+}
+
+// New creates an Authenticator with the JWT keys configured in the environment
+func New() (*Authenticator, error) {
+	verifier, err := newJWTVerifier()
+	if err != nil {
+		return nil, err
+	}
+	return &Authenticator{jwt: verifier, keys: newAPIKeyCache(apiKeyCacheTTL)}, nil
+}
+
+// ErrInvalidCredentials is returned by Authenticate for unknown API keys and invalid tokens
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Authenticate resolves an API key or JWT to its principal.
+// Errors other than ErrInvalidCredentials mean the credential could not be checked,
+// e.g. because MongoDB is unavailable.
+func (authenticator *Authenticator) Authenticate(ctx context.Context, credential string) (*Principal, error) {
+	if isAPIKey(credential) {
+		return authenticator.authenticateAPIKey(ctx, credential)
+	}
+
+	principal, err := authenticator.jwt.verify(credential)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+	return principal, nil
+}
+
+// authenticateAPIKey resolves an API key from the cache or looks it up with the shared MongoDB client
+func (authenticator *Authenticator) authenticateAPIKey(ctx context.Context, credential string) (*Principal, error) {
+	hash := hashAPIKey(credential)
+	if principal := authenticator.keys.get(hash); principal != nil {
+		return principal, nil
+	}
+
+	database, err := db.Shared()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, apiKeyLookupTimeout)
+	defer cancel()
+	principal, err := verifyAPIKey(ctx, database.Client.Database(db.DbName), hash)
+	if errors.Is(err, errInvalidAPIKey) {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	authenticator.keys.put(hash, principal)
+	return principal, nil
+}
+
+// Middleware rejects requests without valid credentials and stores the principal in the request context.
+// Accepted credentials are "Authorization: Bearer <jwt|api key>" and "X-API-Key: <api key>".
+func (authenticator *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		credential := r.Header.Get("X-API-Key")
+		if credential == "" {
+			scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+			if strings.EqualFold(scheme, "Bearer") {
+				credential = strings.TrimSpace(token)
+			}
+		}
+		if credential == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sales"`)
+			errorHandling.ThrowProblem(r.Context(), w, http.StatusUnauthorized, "Missing credentials", nil)
+			return
+		}
+
+		principal, err := authenticator.Authenticate(r.Context(), credential)
+		if err != nil && !errors.Is(err, ErrInvalidCredentials) {
+			errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to verify API key", err)
+			return
+		}
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sales", error="invalid_token"`)
+			errorHandling.ThrowProblem(r.Context(), w, http.StatusUnauthorized, "Invalid credentials", err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+	})
+}
@@ -0,0 +1,30 @@
+package auth
+
+import "context"
+
+// Kinds of credentials a principal can authenticate with
+const (
+	PrincipalJWT    = "jwt"
+	PrincipalAPIKey = "apikey"
+)
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	Subject string   `json:"subject"`
+	Type    string   `json:"type"`
+	Name    string   `json:"name,omitempty"`
+	Roles   []string `json:"roles"`
+}
+
+type contextKey struct{}
+
+// WithPrincipal returns a copy of the context carrying the principal
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, principal)
+}
+
+// FromContext returns the principal of the request, or nil for unauthenticated requests
+func FromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(contextKey{}).(*Principal)
+	return principal
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/DanVerh/university-swe/backend/api/errorHandling"
+)
+
+// Permissions checked on the routes, named <resource>:<operation>
+const (
+	ProductsRead   = "products:read"
+	ProductsWrite  = "products:write"
+	ProductsDelete = "products:delete"
+
+	CustomersRead   = "customers:read"
+	CustomersWrite  = "customers:write"
+	CustomersDelete = "customers:delete"
+
+	OrdersRead   = "orders:read"
+	OrdersWrite  = "orders:write"
+	OrdersStatus = "orders:status"
+	OrdersDelete = "orders:delete"
+	// Recording payments and refunds moves money, so it is separate from editing orders
+	OrdersPayments = "orders:payments"
+
+	ReportsRead = "reports:read"
+
+	AuditRead = "audit:read"
+
+	// Webhooks send order data to external URLs, so only admins manage them
+	WebhooksManage = "webhooks:manage"
+)
+
+// allPermissions grants every permission
+const allPermissions = "*"
+
+// rolePermissions is the permissions matrix: the permissions granted by each role
+var rolePermissions = map[string][]string{
+	"admin": {allPermissions},
+	"manager": {
+		ProductsRead, ProductsWrite,
+		CustomersRead, CustomersWrite,
+		OrdersRead, OrdersWrite, OrdersStatus, OrdersPayments,
+		ReportsRead,
+		AuditRead,
+	},
+	"sales": {
+		ProductsRead,
+		CustomersRead, CustomersWrite,
+		OrdersRead, OrdersWrite,
+		ReportsRead,
+	},
+	"warehouse": {
+		ProductsRead,
+		CustomersRead,
+		OrdersRead, OrdersStatus,
+	},
+	"viewer": {
+		ProductsRead,
+		CustomersRead,
+		OrdersRead,
+	},
+}
+
+// ValidRole reports whether the role exists in the permissions matrix
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Can reports whether any role of the principal grants the permission
+func (principal *Principal) Can(permission string) bool {
+	if principal == nil {
+		return false
+	}
+	for _, role := range principal.Roles {
+		for _, granted := range rolePermissions[role] {
+			if granted == allPermissions || granted == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Require rejects requests whose principal lacks any of the permissions with 403
+func Require(permissions ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal := FromContext(r.Context())
+			if principal == nil {
+				errorHandling.ThrowProblem(r.Context(), w, http.StatusUnauthorized, "Missing credentials", nil)
+				return
+			}
+
+			var missing []string
+			for _, permission := range permissions {
+				if !principal.Can(permission) {
+					missing = append(missing, permission)
+				}
+			}
+			if len(missing) > 0 {
+				detail := fmt.Sprintf("%s is missing permission %s", principal.Subject, strings.Join(missing, ", "))
+				errorHandling.ThrowProblem(r.Context(), w, http.StatusForbidden, detail, nil)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
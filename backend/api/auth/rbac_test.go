@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DanVerh/university-swe/backend/api/errorHandling"
+)
+
+// permissions lists every permission checked on the routes
+var permissions = []string{
+	ProductsRead, ProductsWrite, ProductsDelete,
+	CustomersRead, CustomersWrite, CustomersDelete,
+	OrdersRead, OrdersWrite, OrdersStatus, OrdersDelete, OrdersPayments,
+	ReportsRead,
+	AuditRead,
+	WebhooksManage,
+}
+
+// expectedGrants is the permissions matrix as specified, written out independently of rolePermissions
+var expectedGrants = map[string][]string{
+	"admin": permissions,
+	"manager": {
+		ProductsRead, ProductsWrite,
+		CustomersRead, CustomersWrite,
+		OrdersRead, OrdersWrite, OrdersStatus, OrdersPayments,
+		ReportsRead,
+		AuditRead,
+	},
+	"sales": {
+		ProductsRead,
+		CustomersRead, CustomersWrite,
+		OrdersRead, OrdersWrite,
+		ReportsRead,
+	},
+	"warehouse": {
+		ProductsRead,
+		CustomersRead,
+		OrdersRead, OrdersStatus,
+	},
+	"viewer": {
+		ProductsRead,
+		CustomersRead,
+		OrdersRead,
+	},
+}
+
+func TestPermissionsMatrix(t *testing.T) {
+	if len(expectedGrants) != len(rolePermissions) {
+		t.Fatalf("the matrix has %d roles, the test expects %d", len(rolePermissions), len(expectedGrants))
+	}
+	for role, granted := range rolePermissions {
+		if _, ok := expectedGrants[role]; !ok {
+			t.Errorf("role %s is missing from the test", role)
+		}
+		for _, permission := range granted {
+			if permission != allPermissions && !containsPermission(permissions, permission) {
+				t.Errorf("permission %s of role %s is missing from the test", permission, role)
+			}
+		}
+	}
+
+	for role, granted := range expectedGrants {
+		principal := &Principal{Subject: "test", Roles: []string{role}}
+		for _, permission := range permissions {
+			want := containsPermission(granted, permission)
+			if got := principal.Can(permission); got != want {
+				t.Errorf("role %s, permission %s: Can is %v, want %v", role, permission, got, want)
+			}
+		}
+	}
+}
+
+func TestCanCombinesRoles(t *testing.T) {
+	principal := &Principal{Subject: "test", Roles: []string{"viewer", "warehouse"}}
+	if !principal.Can(OrdersStatus) {
+		t.Error("a permission of the second role is not granted")
+	}
+	if principal.Can(OrdersDelete) {
+		t.Error("a permission of neither role is granted")
+	}
+	if (&Principal{Subject: "test", Roles: []string{"unknown"}}).Can(ProductsRead) {
+		t.Error("an unknown role grants a permission")
+	}
+	var missing *Principal
+	if missing.Can(ProductsRead) {
+		t.Error("a nil principal is granted a permission")
+	}
+}
+
+func TestRequire(t *testing.T) {
+	for role, granted := range expectedGrants {
+		for _, permission := range permissions {
+			allowed := containsPermission(granted, permission)
+			principal := &Principal{Subject: "user:" + role, Roles: []string{role}}
+
+			called := false
+			handler := Require(permission)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request = request.WithContext(WithPrincipal(request.Context(), principal))
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, request)
+
+			if allowed {
+				if !called || response.Code != http.StatusNoContent {
+					t.Errorf("role %s, permission %s: got %d without calling the handler, want it called", role, permission, response.Code)
+				}
+				continue
+			}
+			if called {
+				t.Errorf("role %s, permission %s: the handler was called", role, permission)
+			}
+			assertProblem(t, response, http.StatusForbidden)
+		}
+	}
+}
+
+func TestRequireWithoutPrincipal(t *testing.T) {
+	handler := Require(ProductsRead)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the handler was called without a principal")
+	}))
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/", nil))
+	assertProblem(t, response, http.StatusUnauthorized)
+}
+
+func assertProblem(t *testing.T, response *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if response.Code != status {
+		t.Fatalf("got status %d, want %d", response.Code, status)
+	}
+	if contentType := response.Header().Get("Content-Type"); contentType != "application/problem+json" {
+		t.Fatalf("got Content-Type %q, want application/problem+json", contentType)
+	}
+	var problem errorHandling.Problem
+	if err := json.NewDecoder(response.Body).Decode(&problem); err != nil {
+		t.Fatal(err)
+	}
+	if problem.Status != status || problem.Detail == "" {
+		t.Fatalf("got problem %+v, want status %d with a detail", problem, status)
+	}
+}
+
+func containsPermission(permissions []string, permission string) bool {
+	for _, value := range permissions {
+		if value == permission {
+			return true
+		}
+	}
+	return false
+}
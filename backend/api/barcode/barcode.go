@@ -0,0 +1,173 @@
+package barcode
+
+import (
+	"errors"
+	"strings"
+)
+
+// Formats of the supported retail barcodes. A UPC-A code is an EAN-13 code with a leading 0.
+const (
+	EAN13 = "EAN-13"
+	UPCA  = "UPC-A"
+)
+
+// Errors of invalid codes
+var (
+	ErrFormat   = errors.New("Barcode needs 13 digits (EAN-13) or 12 digits (UPC-A)")
+	ErrChecksum = errors.New("Barcode check digit is wrong")
+)
+
+// Number of modules of the bars of an EAN-13 or UPC-A symbol, without the quiet zones
+const symbolModules = 95
+
+// Patterns of the digits, a 1 is a bar module. L and G patterns encode the left half,
+// R patterns the right half. The G pattern of a digit is its R pattern reversed.
+var (
+	lPatterns = [10]string{"0001101", "0011001", "0010011", "0111101", "0100011", "0110001", "0101111", "0111011", "0110111", "0001011"}
+	gPatterns = [10]string{"0100111", "0110011", "0011011", "0100001", "0011101", "0111001", "0000101", "0010001", "0001001", "0010111"}
+	rPatterns = [10]string{"1110010", "1100110", "1101100", "1000010", "1011100", "1001110", "1010000", "1000100", "1001000", "1110100"}
+)
+
+// parities selects L or G for each digit of the left half by the first digit of an EAN-13 code
+var parities = [10]string{"LLLLLL", "LLGLGG", "LLGGLG", "LLGGGL", "LGLLGG", "LGGLLG", "LGGGLL", "LGLGLG", "LGLGGL", "LGGLGL"}
+
+// Validate returns the format of the code, or an error unless it is an EAN-13 or UPC-A code with a correct check digit
+func Validate(code string) (string, error) {
+	format := ""
+	switch len(code) {
+	case 13:
+		format = EAN13
+	case 12:
+		format = UPCA
+	default:
+		return "", ErrFormat
+	}
+	for _, digit := range code {
+		if digit < '0' || digit > '9' {
+			return "", ErrFormat
+		}
+	}
+	if CheckDigit(code[:len(code)-1]) != code[len(code)-1] {
+		return "", ErrChecksum
+	}
+	return format, nil
+}
+
+// CheckDigit returns the GS1 check digit of the digits: from the right, digits are weighted 3 and 1 in turn
+func CheckDigit(digits string) byte {
+	sum := 0
+	for i := 0; i < len(digits); i++ {
+		weight := 1
+		if (len(digits)-i)%2 == 1 {
+			weight = 3
+		}
+		sum += int(digits[i]-'0') * weight
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// Equivalents returns the valid code and its other form: the UPC-A code of an EAN-13 code
+// starting with 0, or the EAN-13 code of a UPC-A code. Both scan as the same product.
+func Equivalents(code string) []string {
+	switch {
+	case len(code) == 12:
+		return []string{code, "0" + code}
+	case len(code) == 13 && strings.HasPrefix(code, "0"):
+		return []string{code, code[1:]}
+	}
+	return []string{code}
+}
+
+// Digit is a human readable digit printed below the bars
+type Digit struct {
+	Value byte
+	// Center is the horizontal center of the digit in modules from the start of the bars, negative in the left quiet zone
+	Center float64
+}
+
+// Symbol is the bar pattern of a code
+type Symbol struct {
+	Format string
+	Code   string
+	// Bars has a true module for every bar module
+	Bars []bool
+	// Long marks the modules of the bars extending into the text line: the guards,
+	// and for UPC-A also the first and last digit
+	Long []bool
+	// Digits are the human readable digits
+	Digits []Digit
+	// QuietLeft and QuietRight are the widths of the empty zones next to the bars in modules
+	QuietLeft  int
+	QuietRight int
+}
+
+// Encode validates the code and returns its symbol. UPC-A codes are encoded as EAN-13 codes
+// with a leading 0, which gives the same bars.
+func Encode(code string) (*Symbol, error) {
+	format, err := Validate(code)
+	if err != nil {
+		return nil, err
+	}
+	ean := code
+	if format == UPCA {
+		ean = "0" + code
+	}
+
+	symbol := &Symbol{Format: format, Code: code, QuietLeft: 11, QuietRight: 7}
+	var pattern strings.Builder
+	pattern.WriteString("101")
+	parity := parities[ean[0]-'0']
+	for i := 1; i <= 6; i++ {
+		digit := ean[i] - '0'
+		if parity[i-1] == 'L' {
+			pattern.WriteString(lPatterns[digit])
+		} else {
+			pattern.WriteString(gPatterns[digit])
+		}
+	}
+	pattern.WriteString("01010")
+	for i := 7; i <= 12; i++ {
+		pattern.WriteString(rPatterns[ean[i]-'0'])
+	}
+	pattern.WriteString("101")
+
+	symbol.Bars = make([]bool, symbolModules)
+	symbol.Long = make([]bool, symbolModules)
+	for i, module := range pattern.String() {
+		symbol.Bars[i] = module == '1'
+	}
+	// Start, center and end guards
+	for _, guard := range [][2]int{{0, 3}, {45, 50}, {92, 95}} {
+		markLong(symbol.Long, guard[0], guard[1])
+	}
+
+	// The left half holds digits 2 to 7 of the EAN-13 code and starts after the start guard,
+	// the right half holds digits 8 to 13 and starts after the center guard
+	leftCenter := func(i int) float64 { return 3 + 7*float64(i) + 3.5 }
+	rightCenter := func(i int) float64 { return 50 + 7*float64(i) + 3.5 }
+	if format == EAN13 {
+		symbol.Digits = append(symbol.Digits, Digit{Value: ean[0], Center: -6})
+		for i := 0; i < 6; i++ {
+			symbol.Digits = append(symbol.Digits, Digit{Value: ean[1+i], Center: leftCenter(i)},
+				Digit{Value: ean[7+i], Center: rightCenter(i)})
+		}
+		return symbol, nil
+	}
+
+	// UPC-A prints the first and last digit outside the bars and extends their bars like the guards
+	symbol.QuietLeft, symbol.QuietRight = 9, 9
+	markLong(symbol.Long, 3, 10)
+	markLong(symbol.Long, 85, 92)
+	symbol.Digits = append(symbol.Digits, Digit{Value: code[0], Center: -5}, Digit{Value: code[11], Center: symbolModules + 5})
+	for i := 1; i < 6; i++ {
+		symbol.Digits = append(symbol.Digits, Digit{Value: code[i], Center: leftCenter(i)},
+			Digit{Value: code[5+i], Center: rightCenter(i - 1)})
+	}
+	return symbol, nil
+}
+
+func markLong(long []bool, from, to int) {
+	for i := from; i < to; i++ {
+		long[i] = true
+	}
+}
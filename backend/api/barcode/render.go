@@ -0,0 +1,118 @@
+package barcode
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+// Height of the text line below the bars in modules. Long bars extend halfway into it.
+const textModules = 9
+
+// font has a 5x7 bitmap per digit, a 1 is a black pixel
+var font = [10][7]string{
+	{"01110", "10001", "10011", "10101", "11001", "10001", "01110"},
+	{"00100", "01100", "00100", "00100", "00100", "00100", "01110"},
+	{"01110", "10001", "00001", "00010", "00100", "01000", "11111"},
+	{"11111", "00010", "00100", "00010", "00001", "10001", "01110"},
+	{"00010", "00110", "01010", "10010", "11111", "00010", "00010"},
+	{"11111", "10000", "11110", "00001", "00001", "10001", "01110"},
+	{"00110", "01000", "10000", "11110", "10001", "10001", "01110"},
+	{"11111", "00001", "00010", "00100", "01000", "01000", "01000"},
+	{"01110", "10001", "10001", "01110", "10001", "10001", "01110"},
+	{"01110", "10001", "10001", "01111", "00001", "00010", "01100"},
+}
+
+// size returns the width and height of the symbol in pixels with bars of height modules
+func (symbol *Symbol) size(moduleWidth, height int) (int, int) {
+	return (symbol.QuietLeft + symbolModules + symbol.QuietRight) * moduleWidth, (height + textModules) * moduleWidth
+}
+
+// barHeight returns the height of the bar module in modules
+func (symbol *Symbol) barHeight(module, height int) int {
+	if symbol.Long[module] {
+		return height + textModules/2
+	}
+	return height
+}
+
+// SVG writes the symbol as an SVG image, moduleWidth is the width of a module
+// in pixels and height the height of the bars in modules
+func (symbol *Symbol) SVG(w io.Writer, moduleWidth, height int) error {
+	width, total := symbol.size(moduleWidth, height)
+	if _, err := fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", width, total, width, total); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, `<rect width="%d" height="%d" fill="#fff"/>`+"\n", width, total); err != nil {
+		return err
+	}
+	// A rect per run of bar modules of the same height
+	for start := 0; start < symbolModules; {
+		end := start + 1
+		for end < symbolModules && symbol.Bars[end] == symbol.Bars[start] && symbol.Long[end] == symbol.Long[start] {
+			end++
+		}
+		if symbol.Bars[start] {
+			x := (symbol.QuietLeft + start) * moduleWidth
+			if _, err := fmt.Fprintf(w, `<rect x="%d" y="0" width="%d" height="%d" fill="#000"/>`+"\n",
+				x, (end-start)*moduleWidth, symbol.barHeight(start, height)*moduleWidth); err != nil {
+				return err
+			}
+		}
+		start = end
+	}
+	for _, digit := range symbol.Digits {
+		x := (float64(symbol.QuietLeft) + digit.Center) * float64(moduleWidth)
+		if _, err := fmt.Fprintf(w, `<text x="%g" y="%d" font-family="monospace" font-size="%d" text-anchor="middle">%c</text>`+"\n",
+			x, total-moduleWidth, 8*moduleWidth, digit.Value); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "</svg>\n")
+	return err
+}
+
+// Image draws the symbol in grayscale, moduleWidth is the width of a module
+// in pixels and height the height of the bars in modules
+func (symbol *Symbol) Image(moduleWidth, height int) *image.Gray {
+	width, total := symbol.size(moduleWidth, height)
+	img := image.NewGray(image.Rect(0, 0, width, total))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	black := color.Gray{}
+	fill := func(x, y, w, h int) {
+		for row := y; row < y+h; row++ {
+			for col := x; col < x+w; col++ {
+				img.SetGray(col, row, black)
+			}
+		}
+	}
+
+	for module, bar := range symbol.Bars {
+		if bar {
+			fill((symbol.QuietLeft+module)*moduleWidth, 0, moduleWidth, symbol.barHeight(module, height)*moduleWidth)
+		}
+	}
+	// Digits are 7 modules high, a font pixel is a module
+	top := (height + 1) * moduleWidth
+	for _, digit := range symbol.Digits {
+		left := int((float64(symbol.QuietLeft)+digit.Center-2.5)*float64(moduleWidth) + 0.5)
+		for y, row := range font[digit.Value-'0'] {
+			for x, pixel := range row {
+				if pixel == '1' {
+					fill(left+x*moduleWidth, top+y*moduleWidth, moduleWidth, moduleWidth)
+				}
+			}
+		}
+	}
+	return img
+}
+
+// PNG writes the symbol as a PNG image, moduleWidth is the width of a module
+// in pixels and height the height of the bars in modules
+func (symbol *Symbol) PNG(w io.Writer, moduleWidth, height int) error {
+	return png.Encode(w, symbol.Image(moduleWidth, height))
+}
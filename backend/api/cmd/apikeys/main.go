@@ -0,0 +1,79 @@
+// Command apikeys issues, lists and revokes API keys for the sales API.
+//
+//	go run ./cmd/apikeys issue -name warehouse-scanner -roles warehouse
+//	go run ./cmd/apikeys list
+//	go run ./cmd/apikeys revoke -id 6740c1f2a3b4c5d6e7f80912
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/DanVerh/university-swe/backend/api/auth"
+	"github.com/DanVerh/university-swe/backend/api/db"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: apikeys <issue|list|revoke> [flags]")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	command := os.Args[1]
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	name := flags.String("name", "", "name of the key owner (issue)")
+	roles := flags.String("roles", "", "comma separated roles of the key, e.g. admin or warehouse (issue)")
+	id := flags.String("id", "", "id of the key to revoke (revoke)")
+	flags.Parse(os.Args[2:])
+
+	database := db.DbConnect()
+	defer database.DbDisconnect()
+	sales := database.Client.Database(db.DbName)
+	ctx := context.Background()
+
+	switch command {
+	case "issue":
+		var keyRoles []string
+		if *roles != "" {
+			keyRoles = strings.Split(*roles, ",")
+		}
+		plaintext, key, err := auth.IssueAPIKey(ctx, sales, *name, keyRoles)
+		if err != nil {
+			log.Fatalf("Failed to issue API key: %v", err)
+		}
+		fmt.Printf("Issued API key %s for %s with roles %v\n", key.ID.Hex(), key.Name, key.Roles)
+		fmt.Printf("Key (shown only once): %s\n", plaintext)
+	case "list":
+		keys, err := auth.ListAPIKeys(ctx, sales)
+		if err != nil {
+			log.Fatalf("Failed to list API keys: %v", err)
+		}
+		for _, key := range keys {
+			status := "active"
+			if key.RevokedAt != nil {
+				status = "revoked " + key.RevokedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%s\t%s\t%s...\t%s\t%s\n", key.ID.Hex(), key.Name, key.Prefix, strings.Join(key.Roles, ","), status)
+		}
+	case "revoke":
+		objectID, err := primitive.ObjectIDFromHex(*id)
+		if err != nil {
+			log.Fatalf("Invalid ObjectId format: %v", err)
+		}
+		if err := auth.RevokeAPIKey(ctx, sales, objectID); err != nil {
+			log.Fatalf("Failed to revoke API key: %v", err)
+		}
+		fmt.Printf("Revoked API key %s\n", *id)
+	default:
+		usage()
+	}
+}
@@ -0,0 +1,57 @@
+// Command import streams a CSV file of products or customers into the sales database.
+//
+//	go run ./cmd/import -resource products -file catalogue.csv -upsert
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/DanVerh/university-swe/backend/api/db"
+	"github.com/DanVerh/university-swe/backend/api/handlers"
+)
+
+func main() {
+	resource := flag.String("resource", "products", "resource to import: products or customers")
+	file := flag.String("file", "", "path to the CSV file, reads stdin when empty")
+	upsert := flag.Bool("upsert", false, "update products matched by name instead of failing on duplicates")
+	flag.Parse()
+
+	source := os.Stdin
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			log.Fatalf("Failed to open CSV file: %v", err)
+		}
+		defer f.Close()
+		source = f
+	}
+
+	database := db.DbConnect()
+	defer database.DbDisconnect()
+	sales := database.Client.Database(db.DbName)
+
+	var report *handlers.ImportReport
+	var err error
+	switch *resource {
+	case "products":
+		report, err = handlers.ImportProducts(context.Background(), sales, source, *upsert)
+	case "customers":
+		report, err = handlers.ImportCustomers(context.Background(), sales, source)
+	default:
+		log.Fatalf("Unknown resource %q. Needs to be products or customers", *resource)
+	}
+	if err != nil {
+		log.Fatalf("Failed to import CSV: %v", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,29 @@
+// Command rebuild-orders replays the order event log to regenerate the orders collection.
+//
+//	go run ./cmd/rebuild-orders
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+
+	"github.com/DanVerh/university-swe/backend/api/db"
+	"github.com/DanVerh/university-swe/backend/api/handlers"
+)
+
+func main() {
+	database := db.DbConnect()
+	defer database.DbDisconnect()
+	sales := database.Client.Database(db.DbName)
+
+	report, err := handlers.RebuildOrders(context.Background(), sales)
+	if err != nil {
+		log.Fatalf("Failed to rebuild orders: %v", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+}
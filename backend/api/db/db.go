@@ -2,15 +2,35 @@
 package db
 
 import (
-    "log"
+    "context"
+    "errors"
+    "log/slog"
+    "os"
+    "sync"
 
+    "github.com/DanVerh/university-swe/backend/api/metrics"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/event"
     "go.mongodb.org/mongo-driver/mongo"
     "go.mongodb.org/mongo-driver/mongo/options"
+    "go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
 )
 
-// Mongo server uri
+// Mongo server uri. The server needs to be a replica set member or a mongos, as order and product
+// writes run in transactions with their outbox and order log entries. For development a single
+// server is enough when started as a one-member replica set: mongod --replSet rs0, then rs.initiate().
 const dbUri = "mongodb://localhost:27017"
 
+// Mongo database name
+const DbName = "sales"
+
+// MigrationVersion is the version of the newest migration in backend/migration/migrations.
+// Readiness fails until the database is migrated to it.
+const MigrationVersion = 12
+
+// Collection where golang-migrate records the migration version
+const MigrationsCollection = "schema_migrations"
+
 type Database struct {
 	Client *mongo.Client
 }
@@ -23,24 +43,121 @@ func DbConnect() *Database {
 	return db
 }
 
-func connectClient() *mongo.Client {
-    client, err := mongo.NewClient(options.Client().ApplyURI(dbUri))
+// Connect creates a connected client without pinging the server.
+// Unlike DbConnect it returns errors, for callers that must survive MongoDB being down.
+func Connect() (*Database, error) {
+    client, err := mongo.NewClient(clientOptions())
     if err != nil {
-        log.Fatal(err)
+        return nil, err
     }
 
     err = client.Connect(nil)
     if err != nil {
-        log.Fatal(err)
+        return nil, err
+    }
+
+    return &Database{Client: client}, nil
+}
+
+// The client shared by the long-lived callers of Shared
+var (
+    sharedMutex sync.Mutex
+    shared      *Database
+)
+
+// Shared returns a client shared by the whole process, connecting it on first use.
+// Like Connect it returns errors instead of exiting; a failed connect is retried on the next call.
+// Callers must not disconnect it.
+func Shared() (*Database, error) {
+    sharedMutex.Lock()
+    defer sharedMutex.Unlock()
+    if shared != nil {
+        return shared, nil
+    }
+
+    database, err := Connect()
+    if err != nil {
+        return nil, err
+    }
+    shared = database
+    return shared, nil
+}
+
+// ErrNoTransactions is returned by CheckTransactions for a standalone server
+var ErrNoTransactions = errors.New("MongoDB runs standalone, but order and product writes need transactions. Run it as a replica set, e.g. mongod --replSet rs0 and rs.initiate()")
+
+// CheckTransactions asks the server whether it supports transactions, i.e. whether it is
+// a replica set member or a mongos. It returns ErrNoTransactions for a standalone server.
+func CheckTransactions(ctx context.Context, client *mongo.Client) error {
+    var hello struct {
+        SetName string `bson:"setName"`
+        Msg     string `bson:"msg"`
+    }
+    err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+    if err != nil {
+        return err
+    }
+    if hello.SetName == "" && hello.Msg != "isdbgrid" {
+        return ErrNoTransactions
+    }
+    return nil
+}
+
+func connectClient() *mongo.Client {
+    db, err := Connect()
+    if err != nil {
+        fatal("Failed to connect to MongoDB", err)
     }
 
-    err = client.Ping(nil, nil)
+    err = db.Client.Ping(nil, nil)
     if err != nil {
-        log.Fatal(err)
+        fatal("Failed to ping MongoDB", err)
+    }
+
+    slog.Debug("Connected to MongoDB")
+    return db.Client
+}
+
+// clientOptions configures the server uri and the metrics and tracing monitors
+func clientOptions() *options.ClientOptions {
+    return options.Client().
+        ApplyURI(dbUri).
+        SetMonitor(commandMonitors(metrics.CommandMonitor(), otelmongo.NewMonitor())).
+        SetPoolMonitor(metrics.PoolMonitor())
+}
+
+// commandMonitors combines command monitors, as a client accepts only one.
+// Used to record metrics and trace spans of every command.
+func commandMonitors(monitors ...*event.CommandMonitor) *event.CommandMonitor {
+    return &event.CommandMonitor{
+        Started: func(ctx context.Context, started *event.CommandStartedEvent) {
+            for _, monitor := range monitors {
+                if monitor.Started != nil {
+                    monitor.Started(ctx, started)
+                }
+            }
+        },
+        Succeeded: func(ctx context.Context, succeeded *event.CommandSucceededEvent) {
+            for _, monitor := range monitors {
+                if monitor.Succeeded != nil {
+                    monitor.Succeeded(ctx, succeeded)
+                }
+            }
+        },
+        Failed: func(ctx context.Context, failed *event.CommandFailedEvent) {
+            for _, monitor := range monitors {
+                if monitor.Failed != nil {
+                    monitor.Failed(ctx, failed)
+                }
+            }
+        },
     }
+}
 
-    log.Println("Connected to MongoDB")
-    return client
+// fatal logs the error and exits, like log.Fatal
+func fatal(message string, err error) {
+    slog.Error(message, "error", err)
+    os.Exit(1)
 }
 
 
@@ -49,8 +166,8 @@ func (db *Database) DbDisconnect() {
 	// Disconnect the MongoDB client without using context
 	err := db.Client.Disconnect(nil)
 	if err != nil {
-		log.Fatalf("Failed to disconnect MongoDB client: %v", err)
+		fatal("Failed to disconnect MongoDB client", err)
 	}
 
-	log.Println("Disconnected from MongoDB")
+	slog.Debug("Disconnected from MongoDB")
 }
\ No newline at end of file
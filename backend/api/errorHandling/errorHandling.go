@@ -1,8 +1,12 @@
 package errorHandling
 
 import (
-	"log"
+	"context"
+	"encoding/json"
+	"log/slog"
 	"net/http"
+
+	"github.com/DanVerh/university-swe/backend/api/logging"
 )
 
 type Error struct {
@@ -19,15 +23,50 @@ func (e *Error) Init(w http.ResponseWriter, statusCode int, responseMessage stri
 	e.errorMessage = errorMessage
 }
 
-func ThrowError(w http.ResponseWriter, statusCode int, responseMessage string, errorMessage error) {
+// ThrowError logs the error with the request context and responds with a plain text body
+func ThrowError(ctx context.Context, w http.ResponseWriter, statusCode int, responseMessage string, errorMessage error) {
 	e := &Error{}
 	e.Init(w, statusCode, responseMessage, errorMessage)
 
-	if errorMessage == nil {
-		log.Println(e.responseMessage)
-	} else {
-		log.Printf(e.responseMessage, "%v: ", e.errorMessage)
-	}
+	logError(ctx, e.statusCode, e.responseMessage, e.errorMessage)
 
 	http.Error(w, e.responseMessage, e.statusCode)
 }
+
+// Problem is an RFC 7807 problem details response body
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// RequestID correlates the response with the log lines of the request
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// ThrowProblem logs the error with the request context and responds with an application/problem+json body
+func ThrowProblem(ctx context.Context, w http.ResponseWriter, statusCode int, detail string, errorMessage error) {
+	logError(ctx, statusCode, detail, errorMessage)
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(statusCode),
+		Status:    statusCode,
+		Detail:    detail,
+		RequestID: w.Header().Get(logging.RequestIDHeader),
+	})
+}
+
+// logError logs the error response. The log handler adds the request and trace IDs of the context.
+func logError(ctx context.Context, statusCode int, message string, errorMessage error) {
+	level := slog.LevelWarn
+	if statusCode >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	attrs := []slog.Attr{slog.Int("status", statusCode)}
+	if errorMessage != nil {
+		attrs = append(attrs, slog.String("error", errorMessage.Error()))
+	}
+	slog.LogAttrs(ctx, level, message, attrs...)
+}
@@ -0,0 +1,38 @@
+package errorHandling
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DanVerh/university-swe/backend/api/logging"
+)
+
+// contextRecorder records the request ID of the context of every log record
+type contextRecorder struct {
+	slog.Handler
+	requestIDs *[]string
+}
+
+func (handler contextRecorder) Handle(ctx context.Context, record slog.Record) error {
+	*handler.requestIDs = append(*handler.requestIDs, logging.RequestID(ctx))
+	return nil
+}
+
+func TestThrowErrorLogsWithRequestContext(t *testing.T) {
+	var requestIDs []string
+	previous := slog.Default()
+	slog.SetDefault(slog.New(contextRecorder{Handler: slog.NewTextHandler(io.Discard, nil), requestIDs: &requestIDs}))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	ctx := logging.WithRequestID(context.Background(), "request-1")
+	ThrowError(ctx, httptest.NewRecorder(), http.StatusInternalServerError, "Failed", nil)
+	ThrowProblem(ctx, httptest.NewRecorder(), http.StatusBadRequest, "Invalid", nil)
+
+	if len(requestIDs) != 2 || requestIDs[0] != "request-1" || requestIDs[1] != "request-1" {
+		t.Errorf("got request IDs %q in the log contexts, want request-1 twice", requestIDs)
+	}
+}
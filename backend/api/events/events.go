@@ -0,0 +1,165 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Order event types
+const (
+	OrderCreated       = "order.created"
+	OrderStatusChanged = "order.status_changed"
+	OrderDeleted       = "order.deleted"
+)
+
+// Number of events kept to replay to resuming subscribers
+const defaultHistorySize = 1000
+
+// Buffered events per subscriber before it is dropped as too slow
+const subscriberBuffer = 64
+
+// Event is a change published on the bus
+type Event struct {
+	// ID increases with every event, also across restarts, so subscribers can resume after it
+	ID   uint64      `json:"id,string"`
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+	// Attributes are matched by subscription filters, e.g. customer and status of an order
+	Attributes map[string]string `json:"-"`
+}
+
+// Filter selects the events of a subscription. Empty fields match every event.
+type Filter struct {
+	Types      []string
+	Attributes map[string]string
+}
+
+// Matches reports whether the event passes the filter
+func (filter Filter) Matches(event Event) bool {
+	if len(filter.Types) > 0 {
+		found := false
+		for _, eventType := range filter.Types {
+			if eventType == event.Type {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for key, value := range filter.Attributes {
+		if event.Attributes[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Bus delivers published events to every matching subscriber in process
+type Bus struct {
+	mu          sync.Mutex
+	lastID      uint64
+	history     []Event
+	historySize int
+	subscribers map[*Subscription]struct{}
+}
+
+// NewBus creates a bus that keeps the last historySize events for resuming subscribers
+func NewBus(historySize int) *Bus {
+	return &Bus{historySize: historySize, subscribers: map[*Subscription]struct{}{}}
+}
+
+// Subscription receives the events of a bus matching its filter
+type Subscription struct {
+	bus    *Bus
+	filter Filter
+	events chan Event
+}
+
+// Events is closed when the subscription is closed or the subscriber falls too far behind.
+// A dropped subscriber resumes by subscribing again after the last event it received.
+func (subscription *Subscription) Events() <-chan Event {
+	return subscription.events
+}
+
+// Close stops the delivery of events
+func (subscription *Subscription) Close() {
+	bus := subscription.bus
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	bus.remove(subscription)
+}
+
+// Publish assigns the ID and time of the event and delivers it to the subscribers
+func (bus *Bus) Publish(event Event) Event {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	// IDs are the publish time in nanoseconds, bumped if the clock did not advance
+	event.Time = time.Now().UTC()
+	event.ID = uint64(event.Time.UnixNano())
+	if event.ID <= bus.lastID {
+		event.ID = bus.lastID + 1
+	}
+	bus.lastID = event.ID
+
+	bus.history = append(bus.history, event)
+	if len(bus.history) > bus.historySize {
+		bus.history = bus.history[len(bus.history)-bus.historySize:]
+	}
+
+	for subscription := range bus.subscribers {
+		if !subscription.filter.Matches(event) {
+			continue
+		}
+		select {
+		case subscription.events <- event:
+		default:
+			bus.remove(subscription)
+		}
+	}
+	return event
+}
+
+// Subscribe registers a subscription and returns the kept events after the ID that match the filter.
+// after is 0 for a new subscriber; events older than the history are lost.
+func (bus *Bus) Subscribe(filter Filter, after uint64) (*Subscription, []Event) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	var missed []Event
+	if after > 0 {
+		for _, event := range bus.history {
+			if event.ID > after && filter.Matches(event) {
+				missed = append(missed, event)
+			}
+		}
+	}
+
+	subscription := &Subscription{bus: bus, filter: filter, events: make(chan Event, subscriberBuffer)}
+	bus.subscribers[subscription] = struct{}{}
+	return subscription, missed
+}
+
+// remove closes the channel of a registered subscription. The caller holds the lock.
+func (bus *Bus) remove(subscription *Subscription) {
+	if _, ok := bus.subscribers[subscription]; ok {
+		delete(bus.subscribers, subscription)
+		close(subscription.events)
+	}
+}
+
+// defaultBus is the bus of the process, fed by the handlers
+var defaultBus = NewBus(defaultHistorySize)
+
+// Publish publishes the event on the bus of the process
+func Publish(event Event) Event {
+	return defaultBus.Publish(event)
+}
+
+// Subscribe subscribes to the bus of the process
+func Subscribe(filter Filter, after uint64) (*Subscription, []Event) {
+	return defaultBus.Subscribe(filter, after)
+}
@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/DanVerh/university-swe/backend/api/db"
+	"github.com/DanVerh/university-swe/backend/api/errorHandling"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Default and maximum number of entries in top-N rankings
+const (
+	defaultTopLimit = 10
+	maxTopLimit     = 100
+)
+
+// productRanking holds the sales figures of a single product
+type productRanking struct {
+	Product primitive.ObjectID `json:"product" bson:"_id"`
+	Name    string             `json:"name,omitempty" bson:"name,omitempty"`
+	Units   int64              `json:"units" bson:"units"`
+	Revenue float64            `json:"revenue" bson:"revenue"`
+	Orders  int64              `json:"orders" bson:"orders"`
+}
+
+// customerValue holds the lifetime figures of a single customer
+type customerValue struct {
+	Customer      primitive.ObjectID `json:"customer" bson:"_id"`
+	Name          string             `json:"name,omitempty" bson:"name,omitempty"`
+	LifetimeValue float64            `json:"lifetimeValue" bson:"lifetimeValue"`
+	Orders        int64              `json:"orders" bson:"orders"`
+	LastOrderDate time.Time          `json:"lastOrderDate" bson:"lastOrderDate"`
+}
+
+// customerSegment holds the RFM scores and segment label of a customer
+type customerSegment struct {
+	customerValue `bson:",inline"`
+	RecencyDays   int    `json:"recencyDays"`
+	Recency       int    `json:"recencyScore"`
+	Frequency     int    `json:"frequencyScore"`
+	Monetary      int    `json:"monetaryScore"`
+	Segment       string `json:"segment"`
+}
+
+// TopProducts handles GET requests for the best selling products.
+// Query parameters: by (revenue|units), limit, status (default delivered), from, to and tz.
+func (reportsHandler *ReportsHandler) TopProducts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		errorHandling.ThrowError(r.Context(), w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be GET", nil)
+		return
+	}
+
+	sortField := r.URL.Query().Get("by")
+	if sortField == "" {
+		sortField = "revenue"
+	}
+	if sortField != "revenue" && sortField != "units" {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid by. Needs to be revenue or units", nil)
+		return
+	}
+
+	pipeline, limit, ok := analyticsPipeline(w, r)
+	if !ok {
+		return
+	}
+	pipeline = append(pipeline,
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$product"},
+			{Key: "units", Value: bson.D{{Key: "$sum", Value: "$amount"}}},
+			{Key: "revenue", Value: bson.D{{Key: "$sum", Value: "$sum"}}},
+			{Key: "orders", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: sortField, Value: -1}, {Key: "_id", Value: 1}}}},
+		bson.D{{Key: "$limit", Value: limit}},
+	)
+	pipeline = append(pipeline, nameLookupStages("product")...)
+
+	products := []productRanking{}
+	if !aggregateOrders(w, r, pipeline, &products) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(products)
+}
+
+// TopCustomers handles GET requests for the most valuable customers.
+// Query parameters: by (value|orders), limit, status (default delivered), from, to and tz.
+func (reportsHandler *ReportsHandler) TopCustomers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		errorHandling.ThrowError(r.Context(), w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be GET", nil)
+		return
+	}
+
+	sortField := "lifetimeValue"
+	switch r.URL.Query().Get("by") {
+	case "", "value":
+	case "orders":
+		sortField = "orders"
+	default:
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid by. Needs to be value or orders", nil)
+		return
+	}
+
+	pipeline, limit, ok := analyticsPipeline(w, r)
+	if !ok {
+		return
+	}
+	pipeline = append(pipeline, customerValueStages()...)
+	pipeline = append(pipeline,
+		bson.D{{Key: "$sort", Value: bson.D{{Key: sortField, Value: -1}, {Key: "_id", Value: 1}}}},
+		bson.D{{Key: "$limit", Value: limit}},
+	)
+	pipeline = append(pipeline, nameLookupStages("customer")...)
+
+	customers := []customerValue{}
+	if !aggregateOrders(w, r, pipeline, &customers) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(customers)
+}
+
+// CustomerSegments handles GET requests for RFM (recency, frequency, monetary) scores of every customer.
+// Each dimension is scored 1-5 by quintile and the scores are mapped to a segment label.
+func (reportsHandler *ReportsHandler) CustomerSegments(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		errorHandling.ThrowError(r.Context(), w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be GET", nil)
+		return
+	}
+
+	pipeline, _, ok := analyticsPipeline(w, r)
+	if !ok {
+		return
+	}
+	pipeline = append(pipeline, customerValueStages()...)
+	pipeline = append(pipeline, nameLookupStages("customer")...)
+
+	segments := []customerSegment{}
+	if !aggregateOrders(w, r, pipeline, &segments) {
+		return
+	}
+	scoreRFM(segments, time.Now())
+
+	// Filter by segment label after scoring, so quintiles are computed over all customers
+	if segment := r.URL.Query().Get("segment"); segment != "" {
+		filtered := []customerSegment{}
+		for _, customer := range segments {
+			if customer.Segment == segment {
+				filtered = append(filtered, customer)
+			}
+		}
+		segments = filtered
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(segments)
+}
+
+// analyticsPipeline parses the shared query parameters and returns the matching stages.
+// Like SumDeliveredOrders only delivered orders count unless another status is requested.
+func analyticsPipeline(w http.ResponseWriter, r *http.Request) (mongo.Pipeline, int, bool) {
+	limit := defaultTopLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxTopLimit {
+			errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid limit. Needs to be between 1 and 100", nil)
+			return nil, 0, false
+		}
+		limit = parsed
+	}
+
+	dateRange, err := parseReportRange(r)
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, err.Error(), nil)
+		return nil, 0, false
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = "delivered"
+	}
+	return reportMatchPipeline(dateRange, status), limit, true
+}
+
+// customerValueStages groups orders by customer into lifetime value, order count and last order date
+func customerValueStages() []bson.D {
+	return []bson.D{
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$customer"},
+			{Key: "lifetimeValue", Value: bson.D{{Key: "$sum", Value: "$sum"}}},
+			{Key: "orders", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "lastOrderDate", Value: bson.D{{Key: "$max", Value: "$createdAt"}}},
+		}}},
+	}
+}
+
+// aggregateOrders runs the pipeline on the orders collection and decodes every result
+func aggregateOrders(w http.ResponseWriter, r *http.Request, pipeline mongo.Pipeline, results interface{}) bool {
+	db := db.DbConnect()
+	defer db.DbDisconnect()
+	collection := db.Client.Database(dbName).Collection(ordersCollection)
+
+	cursor, err := collection.Aggregate(r.Context(), pipeline)
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to aggregate orders", err)
+		return false
+	}
+	defer cursor.Close(r.Context())
+
+	if err := cursor.All(r.Context(), results); err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to decode aggregation result", err)
+		return false
+	}
+	return true
+}
+
+// scoreRFM fills in recency, frequency and monetary quintile scores and the segment of every customer
+func scoreRFM(segments []customerSegment, now time.Time) {
+	recency := make([]float64, len(segments))
+	frequency := make([]float64, len(segments))
+	monetary := make([]float64, len(segments))
+	for i := range segments {
+		segments[i].RecencyDays = int(now.Sub(segments[i].LastOrderDate).Hours() / 24)
+		recency[i] = float64(segments[i].RecencyDays)
+		frequency[i] = float64(segments[i].Orders)
+		monetary[i] = segments[i].LifetimeValue
+	}
+
+	// Fewer days since the last order is better
+	recencyScores := quintileScores(recency, false)
+	frequencyScores := quintileScores(frequency, true)
+	monetaryScores := quintileScores(monetary, true)
+	for i := range segments {
+		segments[i].Recency = recencyScores[i]
+		segments[i].Frequency = frequencyScores[i]
+		segments[i].Monetary = monetaryScores[i]
+		segments[i].Segment = rfmSegment(recencyScores[i], frequencyScores[i], monetaryScores[i])
+	}
+}
+
+// quintileScores ranks the values into scores from 1 (worst) to 5 (best). Equal values share a score.
+func quintileScores(values []float64, higherIsBetter bool) []int {
+	order := make([]int, len(values))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		if higherIsBetter {
+			return values[order[a]] < values[order[b]]
+		}
+		return values[order[a]] > values[order[b]]
+	})
+
+	// Ties are scored by the middle position of their run
+	scores := make([]int, len(values))
+	for start := 0; start < len(order); {
+		end := start + 1
+		for end < len(order) && values[order[end]] == values[order[start]] {
+			end++
+		}
+		score := (start+end-1)/2*5/len(values) + 1
+		for _, index := range order[start:end] {
+			scores[index] = score
+		}
+		start = end
+	}
+	return scores
+}
+
+// rfmSegment maps RFM scores to the usual customer segment labels
+func rfmSegment(recency, frequency, monetary int) string {
+	switch {
+	case recency >= 4 && frequency >= 4 && monetary >= 4:
+		return "champions"
+	case recency >= 3 && frequency >= 4:
+		return "loyal"
+	case recency >= 4 && frequency == 1:
+		return "new"
+	case recency >= 4 && frequency >= 2:
+		return "potential-loyalist"
+	case recency <= 2 && frequency >= 4:
+		return "cannot-lose"
+	case recency <= 2 && frequency >= 2:
+		return "at-risk"
+	case recency == 1 && frequency == 1:
+		return "lost"
+	case recency <= 2:
+		return "hibernating"
+	default:
+		return "needs-attention"
+	}
+}
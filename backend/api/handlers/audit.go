@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/DanVerh/university-swe/backend/api/audit"
+	"github.com/DanVerh/university-swe/backend/api/db"
+	"github.com/DanVerh/university-swe/backend/api/errorHandling"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Default and maximum number of audit records returned at once
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// AuditHandler handles queries of the audit trail
+type AuditHandler struct{}
+
+// List handles GET requests for audit records, newest first.
+// Query parameters: resource, id, actor, from, to, tz and limit.
+func (auditHandler *AuditHandler) List(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		errorHandling.ThrowError(r.Context(), w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be GET", nil)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := bson.M{}
+	if resource := query.Get("resource"); resource != "" {
+		filter["resource"] = resource
+	}
+	if id := query.Get("id"); id != "" {
+		objectID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid ObjectId format", nil)
+			return
+		}
+		filter["resourceId"] = objectID
+	}
+	if actor := query.Get("actor"); actor != "" {
+		filter["actor"] = actor
+	}
+
+	dateRange, err := parseReportRange(r)
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	timestamp := bson.M{}
+	if dateRange.From != nil {
+		timestamp["$gte"] = *dateRange.From
+	}
+	if dateRange.To != nil {
+		timestamp["$lt"] = *dateRange.To
+	}
+	if len(timestamp) > 0 {
+		filter["timestamp"] = timestamp
+	}
+
+	limit := defaultAuditLimit
+	if value := query.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxAuditLimit {
+			errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid limit. Needs to be between 1 and 1000", nil)
+			return
+		}
+	}
+
+	db := db.DbConnect()
+	defer db.DbDisconnect()
+	collection := db.Client.Database(dbName).Collection(audit.Collection)
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "timestamp", Value: -1}}).SetLimit(int64(limit))
+	cursor, err := collection.Find(r.Context(), filter, findOptions)
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to retrieve audit records", err)
+		return
+	}
+	defer cursor.Close(r.Context())
+
+	records := []audit.Record{}
+	if err := cursor.All(r.Context(), &records); err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to decode audit records", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(records)
+}
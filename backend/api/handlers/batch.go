@@ -0,0 +1,642 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/DanVerh/university-swe/backend/api/audit"
+	"github.com/DanVerh/university-swe/backend/api/auth"
+	"github.com/DanVerh/university-swe/backend/api/db"
+	"github.com/DanVerh/university-swe/backend/api/errorHandling"
+	"github.com/DanVerh/university-swe/backend/api/outbox"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Maximum number of items accepted in a single batch request
+const maxBatchSize = 10000
+
+// Batch modes selected with the ?mode= query parameter
+const (
+	batchModeBestEffort = "best-effort"
+	batchModeAtomic     = "atomic"
+)
+
+// batchItem is a single operation of a batch request.
+// An item without "op" is treated as the document to create.
+type batchItem struct {
+	Op   string          `json:"op"`
+	ID   string          `json:"id"`
+	Data json.RawMessage `json:"data"`
+}
+
+// batchResult is the outcome of a single batch item
+type batchResult struct {
+	Index  int    `json:"index"`
+	Status int    `json:"status"`
+	ID     string `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// batchOp is a validated batch item ready to be written
+type batchOp struct {
+	index    int
+	op       string
+	id       primitive.ObjectID
+	model    mongo.WriteModel
+	document interface{} // created document, for the audit trail
+	set      bson.M      // updated fields, for the audit trail
+	update   bson.M      // update document of the write model
+}
+
+// batchBuilder validates batch items of one resource and turns them into write models.
+// Items that fail validation get their result filled in and no operation.
+type batchBuilder func(ctx context.Context, database *mongo.Database, items []batchItem, results []batchResult) []batchOp
+
+// Batch handles POST requests to create, update and delete many products at once
+func (productHandler *ProductsHandler) Batch(w http.ResponseWriter, r *http.Request) {
+	runBatch(w, r, "products", buildProductsBatch)
+}
+
+// Batch handles POST requests to create, update and delete many customers at once
+func (customersHandler *CustomersHandler) Batch(w http.ResponseWriter, r *http.Request) {
+	runBatch(w, r, customerCollection, buildCustomersBatch)
+}
+
+// Batch handles POST requests to create, update and delete many orders at once
+func (ordersHandler *OrdersHandler) Batch(w http.ResponseWriter, r *http.Request) {
+	runBatch(w, r, ordersCollection, buildOrdersBatch)
+}
+
+// runBatch parses the batch body, validates it with the builder and writes it with a single BulkWrite
+func runBatch(w http.ResponseWriter, r *http.Request, collectionName string, build batchBuilder) {
+	if r.Method != http.MethodPost {
+		errorHandling.ThrowError(r.Context(), w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be POST", nil)
+		return
+	}
+
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = batchModeBestEffort
+	}
+	if mode != batchModeBestEffort && mode != batchModeAtomic {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid mode. Needs to be best-effort or atomic", nil)
+		return
+	}
+
+	items, err := decodeBatchItems(r)
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid batch body", err)
+		return
+	}
+	if len(items) == 0 {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Batch is empty", nil)
+		return
+	}
+	if len(items) > maxBatchSize {
+		errorHandling.ThrowError(r.Context(), w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Batch exceeds %d items", maxBatchSize), nil)
+		return
+	}
+
+	ctx := r.Context()
+	db := db.DbConnect()
+	defer db.DbDisconnect()
+	database := db.Client.Database(dbName)
+	collection := database.Collection(collectionName)
+
+	results := make([]batchResult, len(items))
+	for i := range results {
+		results[i].Index = i
+	}
+
+	ops := build(ctx, database, items, results)
+	ops = authorizeBatch(r, collectionName, ops, results)
+	ops, targets, err := checkBatchTargets(ctx, collection, ops, results)
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to look up batch targets", err)
+		return
+	}
+
+	if mode == batchModeAtomic && len(ops) < len(items) {
+		// Nothing is written when any item is invalid
+		for _, op := range ops {
+			results[op.index] = batchResult{Index: op.index, Status: http.StatusFailedDependency, ID: op.id.Hex(), Error: "Not executed: batch rejected"}
+		}
+		writeBatchResults(w, http.StatusBadRequest, results)
+		return
+	}
+
+	if len(ops) > 0 {
+		models := make([]mongo.WriteModel, len(ops))
+		events := make([]writeEvents, len(ops))
+		for i, op := range ops {
+			models[i] = op.model
+			events[i] = batchWriteEvents(collectionName, op, targets[op.id])
+		}
+
+		if mode == batchModeAtomic {
+			err = writeBatchAtomic(ctx, db.Client, collection, models, events)
+			if err != nil {
+				status := batchErrorStatus(err)
+				for _, op := range ops {
+					results[op.index] = batchResult{Index: op.index, Status: status, ID: op.id.Hex(), Error: err.Error()}
+				}
+				writeBatchResults(w, status, results)
+				return
+			}
+		} else {
+			_, err = bulkWriteWithEvents(ctx, collection, models, events)
+		}
+
+		failed := map[int]error{}
+		var bulkErr mongo.BulkWriteException
+		if errors.As(err, &bulkErr) {
+			for _, writeErr := range bulkErr.WriteErrors {
+				failed[writeErr.Index] = writeErr
+			}
+		} else if err != nil {
+			errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to write batch", err)
+			return
+		}
+
+		var records []audit.Record
+		for i, op := range ops {
+			result := batchResult{Index: op.index, ID: op.id.Hex()}
+			if writeErr, ok := failed[i]; ok {
+				result.Status = batchErrorStatus(writeErr)
+				result.Error = writeErr.Error()
+			} else if op.op == "create" {
+				result.Status = http.StatusCreated
+			} else {
+				result.Status = http.StatusOK
+			}
+			results[op.index] = result
+
+			if _, ok := failed[i]; !ok {
+				records = append(records, batchAuditRecord(ctx, collectionName, op, targets[op.id]))
+				if collectionName == ordersCollection {
+					publishBatchOrderEvent(ctx, database, op, targets[op.id])
+				}
+			}
+		}
+		audit.Append(ctx, database, records...)
+	}
+
+	status := http.StatusOK
+	for _, result := range results {
+		if result.Status >= http.StatusBadRequest {
+			status = http.StatusMultiStatus
+			break
+		}
+	}
+	writeBatchResults(w, status, results)
+}
+
+// decodeBatchItems reads a JSON array or, for NDJSON content types, one JSON value per line
+func decodeBatchItems(r *http.Request) ([]batchItem, error) {
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+
+	contentType := r.Header.Get("Content-Type")
+	ndjson := strings.HasPrefix(contentType, "application/x-ndjson") || strings.HasPrefix(contentType, "application/ndjson")
+
+	if !ndjson {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		if delim, ok := token.(json.Delim); !ok || delim != '[' {
+			return nil, errors.New("expected a JSON array")
+		}
+	}
+
+	var items []batchItem
+	for ndjson || decoder.More() {
+		var raw json.RawMessage
+		err := decoder.Decode(&raw)
+		if ndjson && err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		item, err := parseBatchItem(raw)
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %w", len(items), err)
+		}
+		items = append(items, item)
+		if len(items) > maxBatchSize {
+			break
+		}
+	}
+
+	return items, nil
+}
+
+// parseBatchItem decodes an item, treating an object without "op" as a create document
+func parseBatchItem(raw json.RawMessage) (batchItem, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return batchItem{}, err
+	}
+
+	if _, ok := fields["op"]; !ok {
+		return batchItem{Op: "create", Data: raw}, nil
+	}
+
+	var item batchItem
+	if err := json.Unmarshal(raw, &item); err != nil {
+		return batchItem{}, err
+	}
+	return item, nil
+}
+
+// decodeBatchData decodes the data of an item, keeping numbers as json.Number like Create does
+func decodeBatchData(data json.RawMessage, value interface{}) error {
+	if len(data) == 0 {
+		return errors.New("data is required")
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(value)
+}
+
+// decodeBatchUpdate decodes the data of an update item into an update body like UpdateByID does
+func decodeBatchUpdate(data json.RawMessage) (bson.M, error) {
+	if len(data) == 0 {
+		return nil, errors.New("data is required")
+	}
+	var updateBody bson.M
+	if err := json.Unmarshal(data, &updateBody); err != nil {
+		return nil, err
+	}
+	if len(updateBody) == 0 {
+		return nil, errors.New("data is required")
+	}
+	return updateBody, nil
+}
+
+// buildBatch dispatches every item to the create or update callback, handling ids and deletes itself.
+// The update callback validates the item and returns the fields to $set.
+// A document can only be changed once per batch, as the events of each operation are derived
+// from the document before the batch.
+func buildBatch(items []batchItem, results []batchResult, create func(i int, item batchItem) (*batchOp, error), update func(item batchItem) (bson.M, error)) []batchOp {
+	var ops []batchOp
+	changed := map[primitive.ObjectID]bool{}
+	for i, item := range items {
+		var op *batchOp
+		var err error
+
+		switch item.Op {
+		case "create":
+			op, err = create(i, item)
+		case "update", "delete":
+			objectID, idErr := primitive.ObjectIDFromHex(item.ID)
+			if idErr != nil {
+				err = errors.New("Invalid ObjectId format")
+				break
+			}
+			if changed[objectID] {
+				err = errors.New("Duplicate id. A document can only be updated or deleted once per batch")
+				break
+			}
+			changed[objectID] = true
+			op = &batchOp{op: item.Op, id: objectID}
+			if item.Op == "update" {
+				op.set, err = update(item)
+				op.update = bson.M{"$set": op.set}
+				op.model = mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": objectID}).SetUpdate(op.update)
+			} else {
+				op.model = mongo.NewDeleteOneModel().SetFilter(bson.M{"_id": objectID})
+			}
+		default:
+			err = errors.New("Invalid op. Needs to be create, update or delete")
+		}
+
+		if err != nil {
+			status := http.StatusBadRequest
+			if err == errSKUTaken || err == errBarcodeTaken {
+				status = http.StatusConflict
+			}
+			results[i] = batchResult{Index: i, Status: status, ID: item.ID, Error: err.Error()}
+			continue
+		}
+		op.index = i
+		ops = append(ops, *op)
+	}
+	return ops
+}
+
+func buildProductsBatch(ctx context.Context, database *mongo.Database, items []batchItem, results []batchResult) []batchOp {
+	create := func(i int, item batchItem) (*batchOp, error) {
+		var product Product
+		if err := decodeBatchData(item.Data, &product); err != nil {
+			return nil, errors.New("Invalid JSON")
+		}
+		if err := validateProduct(&product); err != nil {
+			return nil, err
+		}
+		if err := checkCategories(ctx, database, product.Categories); err != nil {
+			return nil, err
+		}
+		product.ID = primitive.NewObjectID()
+		defaultSKU(&product)
+		if err := checkProductIdentifiers(ctx, database, bson.M{}, productSKUs(&product), product.Barcode); err != nil {
+			return nil, err
+		}
+		amount := int32(0)
+		product.Amount = &amount
+		return &batchOp{op: "create", id: product.ID, model: mongo.NewInsertOneModel().SetDocument(product), document: product}, nil
+	}
+	update := func(item batchItem) (bson.M, error) {
+		updateBody, err := decodeBatchUpdate(item.Data)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := validateProductUpdate(updateBody); err != nil {
+			return nil, err
+		}
+		if categories, ok := updateBody["categories"].([]primitive.ObjectID); ok {
+			if err := checkCategories(ctx, database, categories); err != nil {
+				return nil, err
+			}
+		}
+		// buildBatch rejects invalid ids, a zero id only matches no product here
+		id, _ := primitive.ObjectIDFromHex(item.ID)
+		if err := checkUpdatedIdentifiers(ctx, database, id, updateBody); err != nil {
+			return nil, err
+		}
+		return updateBody, nil
+	}
+	ops := buildBatch(items, results, create, update)
+	// An empty barcode is unset like in single updates
+	for i := range ops {
+		if ops[i].op == "update" {
+			ops[i].update = productUpdate(ops[i].set)
+			ops[i].model = mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": ops[i].id}).SetUpdate(ops[i].update)
+		}
+	}
+	return ops
+}
+
+func buildCustomersBatch(ctx context.Context, database *mongo.Database, items []batchItem, results []batchResult) []batchOp {
+	create := func(i int, item batchItem) (*batchOp, error) {
+		var customer Customer
+		if err := decodeBatchData(item.Data, &customer); err != nil {
+			return nil, errors.New("Invalid JSON")
+		}
+		if err := validateCustomer(&customer); err != nil {
+			return nil, err
+		}
+		customer.ID = primitive.NewObjectID()
+		return &batchOp{op: "create", id: customer.ID, model: mongo.NewInsertOneModel().SetDocument(customer), document: customer}, nil
+	}
+	update := func(item batchItem) (bson.M, error) {
+		updateBody, err := decodeBatchUpdate(item.Data)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := validateCustomerUpdate(updateBody); err != nil {
+			return nil, err
+		}
+		return updateBody, nil
+	}
+	return buildBatch(items, results, create, update)
+}
+
+func buildOrdersBatch(ctx context.Context, database *mongo.Database, items []batchItem, results []batchResult) []batchOp {
+	// Decode all new orders first so customers and products are fetched with one query each
+	orders := make(map[int]*Order)
+	var customerIDs, productIDs []primitive.ObjectID
+	for i, item := range items {
+		if item.Op != "create" {
+			continue
+		}
+		var order Order
+		if err := json.Unmarshal(item.Data, &order); err != nil {
+			continue
+		}
+		orders[i] = &order
+		customerIDs = append(customerIDs, order.Customer)
+		productIDs = append(productIDs, order.Product)
+	}
+
+	customers := map[primitive.ObjectID]bool{}
+	var customerDocs []Customer
+	lookupErr := findByIDs(ctx, database.Collection(customerCollection), customerIDs, &customerDocs)
+	for _, customer := range customerDocs {
+		customers[customer.ID] = true
+	}
+
+	products := map[primitive.ObjectID]*Product{}
+	var productDocs []Product
+	if err := findByIDs(ctx, database.Collection("products"), productIDs, &productDocs); err != nil && lookupErr == nil {
+		lookupErr = err
+	}
+	for i := range productDocs {
+		products[productDocs[i].ID] = &productDocs[i]
+	}
+
+	create := func(i int, item batchItem) (*batchOp, error) {
+		order, ok := orders[i]
+		if !ok {
+			return nil, errors.New("Invalid request body")
+		}
+		if err := validateOrder(order); err != nil {
+			return nil, err
+		}
+		if lookupErr != nil {
+			return nil, fmt.Errorf("Error checking customer and product existence: %w", lookupErr)
+		}
+		if !customers[order.Customer] {
+			return nil, errors.New("Customer does not exist")
+		}
+		product, ok := products[order.Product]
+		if !ok {
+			return nil, errors.New("Product does not exist")
+		}
+		variant, err := orderVariant(product, order.Variant)
+		if err != nil {
+			return nil, err
+		}
+		priceOrder(order, product, variant)
+		order.ID = primitive.NewObjectID()
+		return &batchOp{op: "create", id: order.ID, model: mongo.NewInsertOneModel().SetDocument(order), document: order}, nil
+	}
+	update := func(item batchItem) (bson.M, error) {
+		updateBody, err := decodeBatchUpdate(item.Data)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := validateOrderUpdate(updateBody); err != nil {
+			return nil, err
+		}
+		return updateBody, nil
+	}
+	return buildBatch(items, results, create, update)
+}
+
+// authorizeBatch drops operations that need a permission beyond the one checked on the route:
+// deletes need <resource>:delete and order updates need orders:status, as on the single item routes
+func authorizeBatch(r *http.Request, resource string, ops []batchOp, results []batchResult) []batchOp {
+	principal := auth.FromContext(r.Context())
+
+	var kept []batchOp
+	for _, op := range ops {
+		permission := ""
+		if op.op == "delete" {
+			permission = resource + ":delete"
+		} else if op.op == "update" && resource == ordersCollection {
+			permission = auth.OrdersStatus
+		}
+
+		if permission != "" && !principal.Can(permission) {
+			results[op.index] = batchResult{Index: op.index, Status: http.StatusForbidden, ID: op.id.Hex(), Error: "Missing permission " + permission}
+			continue
+		}
+		kept = append(kept, op)
+	}
+	return kept
+}
+
+// findByIDs decodes all documents of the collection whose _id is in ids
+func findByIDs(ctx context.Context, collection *mongo.Collection, ids []primitive.ObjectID, documents interface{}) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	return cursor.All(ctx, documents)
+}
+
+// checkBatchTargets drops update and delete operations whose document does not exist
+// and returns the current documents of the others for the audit trail
+func checkBatchTargets(ctx context.Context, collection *mongo.Collection, ops []batchOp, results []batchResult) ([]batchOp, map[primitive.ObjectID]bson.M, error) {
+	var ids []primitive.ObjectID
+	for _, op := range ops {
+		if op.op != "create" {
+			ids = append(ids, op.id)
+		}
+	}
+
+	var existing []bson.M
+	if err := findByIDs(ctx, collection, ids, &existing); err != nil {
+		return nil, nil, err
+	}
+	targets := make(map[primitive.ObjectID]bson.M, len(existing))
+	for _, document := range existing {
+		if id, ok := document["_id"].(primitive.ObjectID); ok {
+			targets[id] = document
+		}
+	}
+
+	var kept []batchOp
+	for _, op := range ops {
+		if _, found := targets[op.id]; op.op != "create" && !found {
+			results[op.index] = batchResult{Index: op.index, Status: http.StatusNotFound, ID: op.id.Hex(), Error: "No document found with the provided ID"}
+			continue
+		}
+		kept = append(kept, op)
+	}
+	return kept, targets, nil
+}
+
+// batchAuditRecord creates the audit record of a written operation from its previous document
+func batchAuditRecord(ctx context.Context, resource string, op batchOp, before bson.M) audit.Record {
+	switch op.op {
+	case "create":
+		return audit.New(ctx, resource, op.id, audit.OperationCreate, nil, op.document)
+	case "delete":
+		return audit.New(ctx, resource, op.id, audit.OperationDelete, before, nil)
+	}
+	operation := audit.OperationUpdate
+	if resource == ordersCollection {
+		operation = audit.OperationStatus
+	}
+	return audit.New(ctx, resource, op.id, operation, before, audit.ApplyUpdate(before, op.update))
+}
+
+// batchWriteEvents returns the events recorded with a written operation, from its previous document
+func batchWriteEvents(resource string, op batchOp, before bson.M) writeEvents {
+	switch {
+	case resource == ordersCollection && op.op == "create":
+		order := op.document.(*Order)
+		return writeEvents{
+			domain: orderCreatedEvents(order),
+			orders: []orderLogEntry{{order: op.id, eventType: orderEventCreated, data: orderCreatedData(order)}},
+			stock:  orderStockChanges(nil, order),
+		}
+	case resource == ordersCollection && op.op == "update":
+		var previous Order
+		if raw, err := bson.Marshal(before); err == nil {
+			bson.Unmarshal(raw, &previous)
+		}
+		from, to := previous.Status, op.set["status"].(string)
+		if from == to {
+			return writeEvents{}
+		}
+		next := previous
+		next.Status = to
+		return writeEvents{
+			domain: orderStatusEvents(op.id, previous.Customer, from, to),
+			orders: []orderLogEntry{{order: op.id, eventType: orderEventStatusChanged, data: orderEventData{Status: to, PreviousStatus: from}}},
+			stock:  orderStockChanges(&previous, &next),
+		}
+	case resource == ordersCollection && op.op == "delete":
+		return writeEvents{orders: []orderLogEntry{{order: op.id, eventType: orderEventDeleted}}}
+	case resource == "products" && op.op == "update":
+		return writeEvents{domain: productUpdateEvents(op.id, before, op.set)}
+	}
+	return writeEvents{}
+}
+
+// writeBatchAtomic runs the bulk write and records the events inside a transaction,
+// so either every item and its events are written or none
+func writeBatchAtomic(ctx context.Context, client *mongo.Client, collection *mongo.Collection, models []mongo.WriteModel, events []writeEvents) error {
+	return outbox.Transact(ctx, client, func(sessionCtx mongo.SessionContext) error {
+		if _, err := collection.BulkWrite(sessionCtx, models, options.BulkWrite().SetOrdered(true)); err != nil {
+			return err
+		}
+		for _, itemEvents := range events {
+			if err := itemEvents.record(sessionCtx, collection.Database()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// batchErrorStatus maps a write error to the HTTP status reported for the item
+func batchErrorStatus(err error) int {
+	if mongo.IsDuplicateKeyError(err) {
+		return http.StatusConflict
+	}
+	var writeErr mongo.BulkWriteError
+	// Errors of writes in a transaction with their events only keep the message
+	if errors.Is(err, errOutOfStock) || (errors.As(err, &writeErr) && writeErr.Message == errOutOfStock.Error()) {
+		return http.StatusConflict
+	}
+	if errors.As(err, &writeErr) && writeErr.Code == 121 {
+		// Document failed the collection schema validation
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func writeBatchResults(w http.ResponseWriter, status int, results []batchResult) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(bson.M{"results": results})
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestBuildBatchRejectsDuplicateIDs(t *testing.T) {
+	id := primitive.NewObjectID().Hex()
+	other := primitive.NewObjectID().Hex()
+	cancel := json.RawMessage(`{"status":"cancelled"}`)
+	items := []batchItem{
+		{Op: "update", ID: id, Data: cancel},
+		{Op: "update", ID: id, Data: cancel},
+		{Op: "delete", ID: id},
+		{Op: "update", ID: other, Data: cancel},
+	}
+	results := make([]batchResult, len(items))
+	update := func(item batchItem) (bson.M, error) {
+		return decodeBatchUpdate(item.Data)
+	}
+
+	ops := buildBatch(items, results, nil, update)
+	if len(ops) != 2 || ops[0].index != 0 || ops[1].index != 3 {
+		t.Fatalf("got %d operations, want the first change of each id", len(ops))
+	}
+	for _, index := range []int{1, 2} {
+		if results[index].Status != http.StatusBadRequest || results[index].Error == "" {
+			t.Errorf("item %d: got result %+v, want 400 for the duplicate id", index, results[index])
+		}
+	}
+}
@@ -0,0 +1,577 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/DanVerh/university-swe/backend/api/audit"
+	"github.com/DanVerh/university-swe/backend/api/db"
+	"github.com/DanVerh/university-swe/backend/api/errorHandling"
+	"github.com/DanVerh/university-swe/backend/api/outbox"
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Mongo collection name for the category tree
+const categoriesCollection = "categories"
+
+// Separator of the IDs in the path of a category
+const categoryPathSeparator = "/"
+
+// Errors of category changes that the tree does not allow
+var (
+	errCategoryHasChildren = errors.New("Category has subcategories. Move or delete them first")
+	errCategoryCycle       = errors.New("A category cannot be moved below itself")
+	errCategoryNameTaken   = errors.New("A sibling category has the same name")
+)
+
+// CategoriesHandler handles requests for the category tree
+type CategoriesHandler struct{}
+
+// Category is a node of the category tree. Path is the materialized path of the IDs from the root
+// to the category, e.g. /<root id>/<child id>/, so the descendants of a category are the
+// categories whose path starts with its path. Position orders the children of a parent from 0.
+type Category struct {
+	ID       primitive.ObjectID  `json:"id" bson:"_id"`
+	Name     string              `json:"name" bson:"name"`
+	Parent   *primitive.ObjectID `json:"parent" bson:"parent"`
+	Path     string              `json:"path" bson:"path"`
+	Position int32               `json:"position" bson:"position"`
+}
+
+// Create handles POST requests to create a category, at the end of its siblings unless a position is given
+func (categoriesHandler *CategoriesHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name     string              `json:"name"`
+		Parent   *primitive.ObjectID `json:"parent"`
+		Position *int32              `json:"position"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid JSON", nil)
+		return
+	}
+
+	db := db.DbConnect()
+	defer db.DbDisconnect()
+
+	category, err := insertCategory(r.Context(), db.Client.Database(dbName), body.Name, body.Parent, body.Position)
+	if err != nil {
+		throwCategoryError(r.Context(), w, err, "Failed to insert the category into the database")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(category)
+}
+
+// List handles GET requests to list the categories ordered by parent and position.
+// The parent query parameter limits the list to the children of a category, or of the root with parent=root.
+func (categoriesHandler *CategoriesHandler) List(w http.ResponseWriter, r *http.Request) {
+	filter := bson.M{}
+	if parent := r.URL.Query().Get("parent"); parent == "root" {
+		filter["parent"] = nil
+	} else if parent != "" {
+		objectID, err := primitive.ObjectIDFromHex(parent)
+		if err != nil {
+			errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid parent. Needs to be an ObjectId or root", nil)
+			return
+		}
+		filter["parent"] = objectID
+	}
+
+	db := db.DbConnect()
+	defer db.DbDisconnect()
+
+	cursor, err := db.Client.Database(dbName).Collection(categoriesCollection).Find(r.Context(), filter,
+		options.Find().SetSort(bson.D{{Key: "parent", Value: 1}, {Key: "position", Value: 1}}))
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to retrieve documents from the database", err)
+		return
+	}
+	defer cursor.Close(r.Context())
+
+	categories := []Category{}
+	if err := cursor.All(r.Context(), &categories); err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to decode documents", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(categories)
+}
+
+// GetByID handles GET requests to retrieve a single category
+func (categoriesHandler *CategoriesHandler) GetByID(w http.ResponseWriter, r *http.Request) {
+	objectID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid ObjectId format", nil)
+		return
+	}
+
+	db := db.DbConnect()
+	defer db.DbDisconnect()
+
+	category, err := findCategory(r.Context(), db.Client.Database(dbName), objectID)
+	if err == mongo.ErrNoDocuments {
+		errorHandling.ThrowError(r.Context(), w, http.StatusNotFound, "No category found with the given ID", nil)
+		return
+	}
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to retrieve category", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(category)
+}
+
+// UpdateByID handles PUT requests to rename a category. Moves and reorders go through Move.
+func (categoriesHandler *CategoriesHandler) UpdateByID(w http.ResponseWriter, r *http.Request) {
+	objectID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid ObjectId format", nil)
+		return
+	}
+
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid request body", nil)
+		return
+	}
+
+	db := db.DbConnect()
+	defer db.DbDisconnect()
+
+	category, err := renameCategory(r.Context(), db.Client.Database(dbName), objectID, body.Name)
+	if err != nil {
+		throwCategoryError(r.Context(), w, err, "Failed to update category")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(category)
+}
+
+// DeleteByID handles DELETE requests to delete a category without subcategories.
+// Its products stay in their other categories.
+func (categoriesHandler *CategoriesHandler) DeleteByID(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid ObjectId format", nil)
+		return
+	}
+
+	db := db.DbConnect()
+	defer db.DbDisconnect()
+
+	if err := deleteCategory(r.Context(), db.Client.Database(dbName), objectID); err != nil {
+		throwCategoryError(r.Context(), w, err, "Failed to delete category")
+		return
+	}
+
+	response := fmt.Sprintf("Deleted category with ID: %v", id)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(response))
+}
+
+// Move handles POST requests to move a category with its subtree below another parent
+// and to reorder it among its siblings. A missing parent keeps the current parent,
+// null moves the category to the root. A missing position moves it to the end.
+func (categoriesHandler *CategoriesHandler) Move(w http.ResponseWriter, r *http.Request) {
+	objectID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid ObjectId format", nil)
+		return
+	}
+
+	// The parent stays raw to tell a missing parent from null
+	var body struct {
+		Parent   json.RawMessage `json:"parent"`
+		Position *int32          `json:"position"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid request body", nil)
+		return
+	}
+	move := categoryMove{position: body.Position}
+	if len(body.Parent) > 0 {
+		move.changeParent = true
+		if err := json.Unmarshal(body.Parent, &move.parent); err != nil {
+			errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid parent. Needs to be an ObjectId or null", nil)
+			return
+		}
+	}
+
+	db := db.DbConnect()
+	defer db.DbDisconnect()
+
+	category, err := moveCategory(r.Context(), db.Client.Database(dbName), objectID, move)
+	if err != nil {
+		throwCategoryError(r.Context(), w, err, "Failed to move category")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(category)
+}
+
+// Products handles GET requests for the products of a category and of all its subcategories
+func (categoriesHandler *CategoriesHandler) Products(w http.ResponseWriter, r *http.Request) {
+	objectID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid ObjectId format", nil)
+		return
+	}
+
+	projection, err := parseFields(r, Product{})
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	db := db.DbConnect()
+	defer db.DbDisconnect()
+	database := db.Client.Database(dbName)
+
+	category, err := findCategory(r.Context(), database, objectID)
+	if err == mongo.ErrNoDocuments {
+		errorHandling.ThrowError(r.Context(), w, http.StatusNotFound, "No category found with the given ID", nil)
+		return
+	}
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to retrieve category", err)
+		return
+	}
+
+	subtree, err := categorySubtree(r.Context(), database, category)
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to retrieve subcategories", err)
+		return
+	}
+
+	cursor, err := database.Collection("products").Find(r.Context(), bson.M{"categories": bson.M{"$in": subtree}},
+		findOptions(projection).SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to retrieve documents from the database", err)
+		return
+	}
+	defer cursor.Close(r.Context())
+
+	if projection != nil {
+		if err := writeDocuments(r.Context(), w, cursor); err != nil {
+			errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to decode documents", err)
+		}
+		return
+	}
+
+	products := []Product{}
+	if err := cursor.All(r.Context(), &products); err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to decode documents", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(products)
+}
+
+// throwCategoryError responds to an error of a category change
+func throwCategoryError(ctx context.Context, w http.ResponseWriter, err error, message string) {
+	switch {
+	case isInvalid(err):
+		errorHandling.ThrowError(ctx, w, http.StatusBadRequest, err.Error(), nil)
+	case err == mongo.ErrNoDocuments:
+		errorHandling.ThrowError(ctx, w, http.StatusNotFound, "No category found with the given ID", nil)
+	case err == errCategoryHasChildren || err == errCategoryCycle:
+		errorHandling.ThrowError(ctx, w, http.StatusConflict, err.Error(), nil)
+	case mongo.IsDuplicateKeyError(err):
+		errorHandling.ThrowError(ctx, w, http.StatusConflict, errCategoryNameTaken.Error(), nil)
+	default:
+		errorHandling.ThrowError(ctx, w, http.StatusInternalServerError, message, err)
+	}
+}
+
+// categoryMove is the target of a move. parent is only used if changeParent is set, nil for the root.
+type categoryMove struct {
+	changeParent bool
+	parent       *primitive.ObjectID
+	position     *int32
+}
+
+// insertCategory creates a category below the parent, or at the root for a nil parent
+func insertCategory(ctx context.Context, database *mongo.Database, name string, parentID *primitive.ObjectID, position *int32) (*Category, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, invalid(errors.New("Name is required"))
+	}
+
+	category := &Category{ID: primitive.NewObjectID(), Name: name, Parent: parentID}
+	err := outbox.Transact(ctx, database.Client(), func(sessionCtx mongo.SessionContext) error {
+		parent, err := findParentCategory(sessionCtx, database, parentID)
+		if err != nil {
+			return err
+		}
+		category.Path = categoryPath(parent, category.ID)
+
+		category.Position, err = makeRoomForCategory(sessionCtx, database, category, position)
+		if err != nil {
+			return err
+		}
+		_, err = database.Collection(categoriesCollection).InsertOne(sessionCtx, category)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "Created category", "id", category.ID.Hex(), "name", category.Name, "path", category.Path)
+	audit.Write(ctx, database, categoriesCollection, category.ID, audit.OperationCreate, nil, category)
+	return category, nil
+}
+
+// renameCategory changes the name of a category
+func renameCategory(ctx context.Context, database *mongo.Database, id primitive.ObjectID, name string) (*Category, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, invalid(errors.New("Name is required"))
+	}
+
+	var before Category
+	err := database.Collection(categoriesCollection).FindOneAndUpdate(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"name": name}}).Decode(&before)
+	if err != nil {
+		return nil, err
+	}
+	after := before
+	after.Name = name
+	audit.Write(ctx, database, categoriesCollection, id, audit.OperationUpdate, before, after)
+	return &after, nil
+}
+
+// deleteCategory deletes a leaf category, closes the gap in the positions of its siblings
+// and removes it from its products
+func deleteCategory(ctx context.Context, database *mongo.Database, id primitive.ObjectID) error {
+	var before Category
+	err := outbox.Transact(ctx, database.Client(), func(sessionCtx mongo.SessionContext) error {
+		categories := database.Collection(categoriesCollection)
+		children, err := categories.CountDocuments(sessionCtx, bson.M{"parent": id}, options.Count().SetLimit(1))
+		if err != nil {
+			return err
+		}
+		if children > 0 {
+			return errCategoryHasChildren
+		}
+
+		if err := categories.FindOneAndDelete(sessionCtx, bson.M{"_id": id}).Decode(&before); err != nil {
+			return err
+		}
+		if _, err := categories.UpdateMany(sessionCtx, bson.M{"parent": before.Parent, "position": bson.M{"$gt": before.Position}},
+			bson.M{"$inc": bson.M{"position": -1}}); err != nil {
+			return err
+		}
+		_, err = database.Collection("products").UpdateMany(sessionCtx, bson.M{"categories": id}, bson.M{"$pull": bson.M{"categories": id}})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	audit.Write(ctx, database, categoriesCollection, id, audit.OperationDelete, before, nil)
+	return nil
+}
+
+// moveCategory moves a category and its subtree and rewrites the paths of the subtree
+func moveCategory(ctx context.Context, database *mongo.Database, id primitive.ObjectID, move categoryMove) (*Category, error) {
+	var before, after Category
+	err := outbox.Transact(ctx, database.Client(), func(sessionCtx mongo.SessionContext) error {
+		categories := database.Collection(categoriesCollection)
+		if err := categories.FindOne(sessionCtx, bson.M{"_id": id}).Decode(&before); err != nil {
+			return err
+		}
+		after = before
+
+		if move.changeParent {
+			parent, err := findParentCategory(sessionCtx, database, move.parent)
+			if err != nil {
+				return err
+			}
+			if parent != nil && strings.HasPrefix(parent.Path, before.Path) {
+				return errCategoryCycle
+			}
+			after.Parent = move.parent
+			after.Path = categoryPath(parent, id)
+		}
+
+		// Close the gap at the old place, then open one at the new place
+		if _, err := categories.UpdateMany(sessionCtx, bson.M{"parent": before.Parent, "position": bson.M{"$gt": before.Position}},
+			bson.M{"$inc": bson.M{"position": -1}}); err != nil {
+			return err
+		}
+		position, err := makeRoomForCategory(sessionCtx, database, &after, move.position)
+		if err != nil {
+			return err
+		}
+		after.Position = position
+
+		if _, err := categories.UpdateOne(sessionCtx, bson.M{"_id": id},
+			bson.M{"$set": bson.M{"parent": after.Parent, "position": after.Position}}); err != nil {
+			return err
+		}
+		if after.Path == before.Path {
+			return nil
+		}
+		// Replace the old path prefix of the category and its descendants with the new one
+		_, err = categories.UpdateMany(sessionCtx, bson.M{"path": bson.M{"$regex": "^" + regexp.QuoteMeta(before.Path)}},
+			mongo.Pipeline{{{Key: "$set", Value: bson.M{"path": bson.M{"$concat": bson.A{
+				after.Path,
+				bson.M{"$substrBytes": bson.A{"$path", len(before.Path), bson.M{"$strLenBytes": "$path"}}},
+			}}}}}})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	audit.Write(ctx, database, categoriesCollection, id, audit.OperationUpdate, before, after)
+	return &after, nil
+}
+
+// findCategory returns the category with the ID or mongo.ErrNoDocuments
+func findCategory(ctx context.Context, database *mongo.Database, id primitive.ObjectID) (*Category, error) {
+	var category Category
+	if err := database.Collection(categoriesCollection).FindOne(ctx, bson.M{"_id": id}).Decode(&category); err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// findParentCategory returns the parent of a new or moved category, nil for the root
+func findParentCategory(ctx context.Context, database *mongo.Database, id *primitive.ObjectID) (*Category, error) {
+	if id == nil {
+		return nil, nil
+	}
+	parent, err := findCategory(ctx, database, *id)
+	if err == mongo.ErrNoDocuments {
+		return nil, invalid(errors.New("Parent category does not exist"))
+	}
+	return parent, err
+}
+
+// categoryPath returns the path of a category below the parent, nil for the root
+func categoryPath(parent *Category, id primitive.ObjectID) string {
+	if parent == nil {
+		return categoryPathSeparator + id.Hex() + categoryPathSeparator
+	}
+	return parent.Path + id.Hex() + categoryPathSeparator
+}
+
+// makeRoomForCategory shifts the siblings of the category at or after the position and returns
+// the position, clamped to the number of siblings. A nil position is the end.
+func makeRoomForCategory(ctx context.Context, database *mongo.Database, category *Category, position *int32) (int32, error) {
+	categories := database.Collection(categoriesCollection)
+	siblings := bson.M{"parent": category.Parent, "_id": bson.M{"$ne": category.ID}}
+	count, err := categories.CountDocuments(ctx, siblings)
+	if err != nil {
+		return 0, err
+	}
+	if position == nil || int64(*position) >= count {
+		return int32(count), nil
+	}
+	at := *position
+	if at < 0 {
+		at = 0
+	}
+	siblings["position"] = bson.M{"$gte": at}
+	if _, err := categories.UpdateMany(ctx, siblings, bson.M{"$inc": bson.M{"position": 1}}); err != nil {
+		return 0, err
+	}
+	return at, nil
+}
+
+// categorySubtree returns the IDs of the category and all its descendants
+func categorySubtree(ctx context.Context, database *mongo.Database, category *Category) ([]primitive.ObjectID, error) {
+	cursor, err := database.Collection(categoriesCollection).Find(ctx,
+		bson.M{"path": bson.M{"$regex": "^" + regexp.QuoteMeta(category.Path)}},
+		options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var documents []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, len(documents))
+	for i, document := range documents {
+		ids[i] = document.ID
+	}
+	return ids, nil
+}
+
+// checkCategories returns a validation error unless every category exists
+func checkCategories(ctx context.Context, database *mongo.Database, ids []primitive.ObjectID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	count, err := database.Collection(categoriesCollection).CountDocuments(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return err
+	}
+	if count != int64(len(ids)) {
+		return invalid(errCategoryNotFound)
+	}
+	return nil
+}
+
+// categoryIDs converts the categories of a product update body to unique ObjectIds
+func categoryIDs(value interface{}) ([]primitive.ObjectID, error) {
+	values, ok := value.([]interface{})
+	if !ok {
+		return nil, errors.New("Invalid type for 'categories'. Expected an array of ObjectIds.")
+	}
+	ids := []primitive.ObjectID{}
+	seen := map[primitive.ObjectID]bool{}
+	for _, value := range values {
+		hex, _ := value.(string)
+		id, err := primitive.ObjectIDFromHex(hex)
+		if err != nil {
+			return nil, errors.New("Invalid type for 'categories'. Expected an array of ObjectIds.")
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// uniqueCategories removes duplicate categories of a new product
+func uniqueCategories(ids []primitive.ObjectID) []primitive.ObjectID {
+	if ids == nil {
+		return nil
+	}
+	unique := []primitive.ObjectID{}
+	seen := map[primitive.ObjectID]bool{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -1,14 +1,17 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
-	"strings"
 	"fmt"
 
+	"github.com/DanVerh/university-swe/backend/api/audit"
 	"github.com/DanVerh/university-swe/backend/api/db"
 	"github.com/DanVerh/university-swe/backend/api/errorHandling"
+	"github.com/go-chi/chi/v5"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -30,36 +33,28 @@ type Customer struct {
 // CreateCustomer handles POST requests to add a new customer
 func (handler *CustomersHandler) Create(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		errorHandling.ThrowError(w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be POST", nil)
+		errorHandling.ThrowError(r.Context(), w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be POST", nil)
 		return
 	}
 
 	var customer Customer
 	if err := json.NewDecoder(r.Body).Decode(&customer); err != nil {
-		errorHandling.ThrowError(w, http.StatusBadRequest, "Invalid JSON", err)
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid JSON", err)
 		return
 	}
 
-	// Validate required fields
-	if customer.Name == "" || customer.Address == "" {
-		errorHandling.ThrowError(w, http.StatusBadRequest, "Name and address are required", nil)
-		return
-	}
-
-	// Assign a new ID
-	customer.ID = primitive.NewObjectID()
-
 	db := db.DbConnect()
 	defer db.DbDisconnect()
-	collection := db.Client.Database(dbName).Collection(customerCollection)
 
-	_, err := collection.InsertOne(nil, customer)
+	err := insertCustomer(r.Context(), db.Client.Database(dbName), &customer)
+	if isInvalid(err) {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
 	if err != nil {
-		errorHandling.ThrowError(w, http.StatusInternalServerError, "Failed to insert customer into database", err)
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to insert customer into database", err)
 		return
 	}
-
-	log.Printf("Created customer: %v", customer)
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(customer)
 }
@@ -67,7 +62,13 @@ func (handler *CustomersHandler) Create(w http.ResponseWriter, r *http.Request)
 // List handles GET requests to list all customers or search for customers by name
 func (customersHandler *CustomersHandler) List(w http.ResponseWriter, r *http.Request) {
     if r.Method != http.MethodGet {
-        errorHandling.ThrowError(w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be GET", nil)
+        errorHandling.ThrowError(r.Context(), w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be GET", nil)
+        return
+    }
+
+    projection, err := parseFields(r, Customer{})
+    if err != nil {
+        errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, err.Error(), nil)
         return
     }
 
@@ -87,16 +88,32 @@ func (customersHandler *CustomersHandler) List(w http.ResponseWriter, r *http.Re
         filter = bson.M{}
     }
 
-    cursor, err := collection.Find(nil, filter)
+    cursor, err := collection.Find(r.Context(), filter, findOptions(projection))
     if err != nil {
-        errorHandling.ThrowError(w, http.StatusInternalServerError, "Failed to retrieve documents from the database", err)
+        errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to retrieve documents from the database", err)
+        return
+    }
+    defer cursor.Close(r.Context())
+
+    // Stream CSV or NDJSON when requested instead of the JSON array
+    if format := exportFormat(r); format != "" {
+        if err := exportCursor(r.Context(), w, format, cursor, customerColumns, customerRow); err != nil {
+            slog.ErrorContext(r.Context(), "Failed to export customers", "error", err)
+        }
+        return
+    }
+
+    // Return raw documents when only some fields are requested
+    if projection != nil {
+        if err := writeDocuments(r.Context(), w, cursor); err != nil {
+            errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to decode documents", err)
+        }
         return
     }
-    defer cursor.Close(nil)
 
     var customers []Customer
-    if err := cursor.All(nil, &customers); err != nil {
-        errorHandling.ThrowError(w, http.StatusInternalServerError, "Failed to decode documents", err)
+    if err := cursor.All(r.Context(), &customers); err != nil {
+        errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to decode documents", err)
         return
     }
 
@@ -108,14 +125,20 @@ func (customersHandler *CustomersHandler) List(w http.ResponseWriter, r *http.Re
 // GetByID handles GET requests to retrieve a single customer by ID
 func (customersHandler *CustomersHandler) GetByID(w http.ResponseWriter, r *http.Request) {
     if r.Method != http.MethodGet {
-        errorHandling.ThrowError(w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be GET", nil)
+        errorHandling.ThrowError(r.Context(), w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be GET", nil)
         return
     }
 
-    id := strings.TrimPrefix(r.URL.Path, "/customers/")
+    id := chi.URLParam(r, "id")
     objectID, err := primitive.ObjectIDFromHex(id)
     if err != nil {
-        errorHandling.ThrowError(w, http.StatusBadRequest, "Invalid ObjectId format", nil)
+        errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid ObjectId format", nil)
+        return
+    }
+
+    projection, err := parseFields(r, Customer{})
+    if err != nil {
+        errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, err.Error(), nil)
         return
     }
 
@@ -124,16 +147,27 @@ func (customersHandler *CustomersHandler) GetByID(w http.ResponseWriter, r *http
     collection := db.Client.Database(dbName).Collection("customers")
 
     var customer Customer
-    err = collection.FindOne(nil, bson.M{"_id": objectID}).Decode(&customer)
+    var document bson.M
+    result := collection.FindOne(r.Context(), bson.M{"_id": objectID}, findOneOptions(projection))
+    if projection != nil {
+        err = result.Decode(&document)
+    } else {
+        err = result.Decode(&customer)
+    }
     if err != nil {
         if err == mongo.ErrNoDocuments {
-            errorHandling.ThrowError(w, http.StatusNotFound, "No customer found with the given ID", nil)
+            errorHandling.ThrowError(r.Context(), w, http.StatusNotFound, "No customer found with the given ID", nil)
         } else {
-            errorHandling.ThrowError(w, http.StatusInternalServerError, "Failed to retrieve customer", err)
+            errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to retrieve customer", err)
         }
         return
     }
 
+    if projection != nil {
+        writeDocument(w, document)
+        return
+    }
+
     w.WriteHeader(http.StatusOK)
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(customer)
@@ -142,43 +176,37 @@ func (customersHandler *CustomersHandler) GetByID(w http.ResponseWriter, r *http
 // UpdateByID handles PUT requests to update a customer by ID
 func (customersHandler *CustomersHandler) UpdateByID(w http.ResponseWriter, r *http.Request) {
     if r.Method != http.MethodPut {
-        errorHandling.ThrowError(w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be PUT", nil)
+        errorHandling.ThrowError(r.Context(), w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be PUT", nil)
         return
     }
 
-    id := strings.TrimPrefix(r.URL.Path, "/customers/")
+    id := chi.URLParam(r, "id")
     objectID, err := primitive.ObjectIDFromHex(id)
     if err != nil {
-        errorHandling.ThrowError(w, http.StatusBadRequest, "Invalid ObjectId format", nil)
+        errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid ObjectId format", nil)
         return
     }
 
     var updateBody bson.M
     if err := json.NewDecoder(r.Body).Decode(&updateBody); err != nil {
-        errorHandling.ThrowError(w, http.StatusBadRequest, "Invalid request body", nil)
+        errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid request body", nil)
         return
     }
 
     db := db.DbConnect()
     defer db.DbDisconnect()
-    collection := db.Client.Database(dbName).Collection("customers")
 
-    var updateKeys []string
-    for updateKey := range updateBody {
-        if updateKey != "name" && updateKey != "address" {
-            errorHandling.ThrowError(w, http.StatusBadRequest, "Invalid update field", nil)
-            return
-        }
-        updateKeys = append(updateKeys, updateKey)
+    updateKeys, err := updateCustomer(r.Context(), db.Client.Database(dbName), objectID, updateBody)
+    if isInvalid(err) {
+        errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, err.Error(), nil)
+        return
     }
-
-    updateResult, err := collection.UpdateByID(nil, objectID, bson.M{"$set": updateBody})
-    if err != nil {
-        errorHandling.ThrowError(w, http.StatusInternalServerError, "Failed to update customer", err)
+    if err == mongo.ErrNoDocuments {
+        errorHandling.ThrowError(r.Context(), w, http.StatusNotFound, "No customer found with the provided ID", nil)
         return
     }
-    if updateResult.MatchedCount == 0 {
-        errorHandling.ThrowError(w, http.StatusNotFound, "No customer found with the provided ID", nil)
+    if err != nil {
+        errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to update customer", err)
         return
     }
 
@@ -190,32 +218,99 @@ func (customersHandler *CustomersHandler) UpdateByID(w http.ResponseWriter, r *h
 // DeleteByID handles DELETE requests to delete a customer by ID
 func (customersHandler *CustomersHandler) DeleteByID(w http.ResponseWriter, r *http.Request) {
     if r.Method != http.MethodDelete {
-        errorHandling.ThrowError(w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be DELETE", nil)
+        errorHandling.ThrowError(r.Context(), w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be DELETE", nil)
         return
     }
 
-    id := strings.TrimPrefix(r.URL.Path, "/customers/")
+    id := chi.URLParam(r, "id")
     objectID, err := primitive.ObjectIDFromHex(id)
     if err != nil {
-        errorHandling.ThrowError(w, http.StatusBadRequest, "Invalid ObjectId format", nil)
+        errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid ObjectId format", nil)
         return
     }
 
     db := db.DbConnect()
     defer db.DbDisconnect()
-	collection := db.Client.Database(dbName).Collection("customers")
 
-    deleteResult, err := collection.DeleteOne(nil, bson.M{"_id": objectID})
-    if err != nil {
-        errorHandling.ThrowError(w, http.StatusInternalServerError, "Failed to delete product", err)
+    err = deleteCustomer(r.Context(), db.Client.Database(dbName), objectID)
+    if err == mongo.ErrNoDocuments {
+        errorHandling.ThrowError(r.Context(), w, http.StatusNotFound, fmt.Sprintf("No product found with the provided ID: %v", id), nil)
         return
     }
-    if deleteResult.DeletedCount == 0 {
-        errorHandling.ThrowError(w, http.StatusNotFound, fmt.Sprintf("No product found with the provided ID: %v", id), nil)
+    if err != nil {
+        errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to delete product", err)
         return
     }
 
     response := fmt.Sprintf("Deleted product with ID: %v", id)
     w.WriteHeader(http.StatusOK)
     w.Write([]byte(response))
-}
\ No newline at end of file
+}
+
+// insertCustomer validates and stores a new customer
+func insertCustomer(ctx context.Context, database *mongo.Database, customer *Customer) error {
+	// Validate required fields
+	if err := validateCustomer(customer); err != nil {
+		return invalid(err)
+	}
+
+	// Assign a new ID
+	customer.ID = primitive.NewObjectID()
+
+	if _, err := database.Collection(customerCollection).InsertOne(ctx, customer); err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "Created customer", "id", customer.ID.Hex(), "name", customer.Name)
+	audit.Write(ctx, database, customerCollection, customer.ID, audit.OperationCreate, nil, customer)
+	return nil
+}
+
+// updateCustomer validates and sets the fields of a customer and returns the updated field names.
+// It returns mongo.ErrNoDocuments if the customer does not exist.
+func updateCustomer(ctx context.Context, database *mongo.Database, id primitive.ObjectID, updateBody bson.M) ([]string, error) {
+	updateKeys, err := validateCustomerUpdate(updateBody)
+	if err != nil {
+		return nil, invalid(err)
+	}
+
+	// Keep the document before the update for the audit trail
+	var before bson.M
+	err = database.Collection(customerCollection).FindOneAndUpdate(ctx, bson.M{"_id": id}, bson.M{"$set": updateBody}).Decode(&before)
+	if err != nil {
+		return nil, err
+	}
+	audit.Write(ctx, database, customerCollection, id, audit.OperationUpdate, before, audit.ApplySet(before, updateBody))
+	return updateKeys, nil
+}
+
+// deleteCustomer deletes a customer. It returns mongo.ErrNoDocuments if the customer does not exist.
+func deleteCustomer(ctx context.Context, database *mongo.Database, id primitive.ObjectID) error {
+	var before bson.M
+	err := database.Collection(customerCollection).FindOneAndDelete(ctx, bson.M{"_id": id}).Decode(&before)
+	if err != nil {
+		return err
+	}
+	audit.Write(ctx, database, customerCollection, id, audit.OperationDelete, before, nil)
+	return nil
+}
+
+// validateCustomer checks the fields required to create a customer
+func validateCustomer(customer *Customer) error {
+	if customer.Name == "" || customer.Address == "" {
+		return errors.New("Name and address are required")
+	}
+	return nil
+}
+
+// validateCustomerUpdate checks that only name and address are updated
+func validateCustomerUpdate(updateBody bson.M) ([]string, error) {
+	var updateKeys []string
+	for updateKey := range updateBody {
+		if updateKey != "name" && updateKey != "address" {
+			return nil, errors.New("Invalid update field")
+		}
+		updateKeys = append(updateKeys, updateKey)
+	}
+	return updateKeys, nil
+}
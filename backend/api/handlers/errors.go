@@ -0,0 +1,36 @@
+package handlers
+
+import "errors"
+
+// Errors of order creation when a referenced document does not exist
+var (
+	errCustomerNotFound = errors.New("Customer does not exist")
+	errProductNotFound  = errors.New("Product does not exist")
+)
+
+// errCategoryNotFound is returned when a product is assigned to a category that does not exist
+var errCategoryNotFound = errors.New("Category does not exist")
+
+// validationError marks an error caused by invalid input rather than by the database,
+// so REST and GraphQL can report it as a client error
+type validationError struct {
+	err error
+}
+
+func (validation validationError) Error() string {
+	return validation.err.Error()
+}
+
+// invalid wraps a validation error
+func invalid(err error) error {
+	if err == nil {
+		return nil
+	}
+	return validationError{err}
+}
+
+// isInvalid reports whether the error is a validation error
+func isInvalid(err error) bool {
+	var validation validationError
+	return errors.As(err, &validation)
+}
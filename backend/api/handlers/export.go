@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Export formats supported by the list endpoints besides the default JSON array
+const (
+	formatCSV    = "csv"
+	formatNDJSON = "ndjson"
+)
+
+// CSV columns of every exported resource
+var (
+	productColumns  = []string{"id", "name", "sku", "barcode", "price", "amount"}
+	customerColumns = []string{"id", "name", "address"}
+	orderColumns    = []string{"id", "amount", "sum", "customer", "status", "product", "variant", "paid", "refunded"}
+)
+
+// exportFormat returns the format requested with ?format= or the Accept header, or "" for JSON
+func exportFormat(r *http.Request) string {
+	switch strings.ToLower(r.URL.Query().Get("format")) {
+	case formatCSV:
+		return formatCSV
+	case formatNDJSON:
+		return formatNDJSON
+	case "json":
+		return ""
+	}
+
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "text/csv"):
+		return formatCSV
+	case strings.Contains(accept, "application/x-ndjson"), strings.Contains(accept, "application/ndjson"):
+		return formatNDJSON
+	}
+	return ""
+}
+
+// exportCursor streams every document of the cursor as CSV rows or NDJSON lines without buffering the result
+func exportCursor[T any](ctx context.Context, w http.ResponseWriter, format string, cursor *mongo.Cursor, columns []string, row func(*T) []string) error {
+	flusher, _ := w.(http.Flusher)
+
+	if format == formatCSV {
+		w.Header().Set("Content-Type", "text/csv")
+		w.WriteHeader(http.StatusOK)
+
+		writer := csv.NewWriter(w)
+		if err := writer.Write(columns); err != nil {
+			return err
+		}
+		for cursor.Next(ctx) {
+			var document T
+			if err := cursor.Decode(&document); err != nil {
+				return err
+			}
+			if err := writer.Write(row(&document)); err != nil {
+				return err
+			}
+			if writer.Flush(); flusher != nil {
+				flusher.Flush()
+			}
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return err
+		}
+		return cursor.Err()
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(w)
+	for cursor.Next(ctx) {
+		var document T
+		if err := cursor.Decode(&document); err != nil {
+			return err
+		}
+		if err := encoder.Encode(document); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	return cursor.Err()
+}
+
+func productRow(product *Product) []string {
+	amount := ""
+	if product.Amount != nil {
+		amount = strconv.Itoa(int(*product.Amount))
+	}
+	return []string{product.ID.Hex(), product.Name, product.SKU, product.Barcode, strconv.FormatFloat(product.Price, 'f', -1, 64), amount}
+}
+
+func customerRow(customer *Customer) []string {
+	return []string{customer.ID.Hex(), customer.Name, customer.Address}
+}
+
+func orderRow(order *Order) []string {
+	variant := ""
+	if order.Variant != nil {
+		variant = order.Variant.Hex()
+	}
+	return []string{
+		order.ID.Hex(),
+		strconv.Itoa(int(order.Amount)),
+		strconv.FormatFloat(order.Sum, 'f', -1, 64),
+		order.Customer.Hex(),
+		order.Status,
+		order.Product.Hex(),
+		variant,
+		strconv.FormatFloat(order.Paid, 'f', -1, 64),
+		strconv.FormatFloat(order.Refunded, 'f', -1, 64),
+	}
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestExportOrdersCSV(t *testing.T) {
+	variant := primitive.NewObjectID()
+	orders := []interface{}{
+		Order{ID: primitive.NewObjectID(), Amount: 2, Sum: 19.5, Customer: primitive.NewObjectID(), Status: "delivered",
+			Product: primitive.NewObjectID(), Variant: &variant, Paid: 19.5, Refunded: 4.25},
+		Order{ID: primitive.NewObjectID(), Amount: 1, Sum: 3, Customer: primitive.NewObjectID(), Status: "pending",
+			Product: primitive.NewObjectID()},
+	}
+	cursor, err := mongo.NewCursorFromDocuments(orders, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response := httptest.NewRecorder()
+	if err := exportCursor(context.Background(), response, formatCSV, cursor, orderColumns, orderRow); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(response.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || !reflect.DeepEqual(records[0], orderColumns) {
+		t.Fatalf("got %v, want the header and two rows", records)
+	}
+
+	// Every field of the order is exported, so the rows can be read back
+	row := map[string]string{}
+	for i, column := range records[0] {
+		row[column] = records[1][i]
+	}
+	first := orders[0].(Order)
+	want := map[string]string{
+		"id": first.ID.Hex(), "amount": "2", "sum": "19.5", "customer": first.Customer.Hex(), "status": "delivered",
+		"product": first.Product.Hex(), "variant": variant.Hex(), "paid": "19.5", "refunded": "4.25",
+	}
+	if !reflect.DeepEqual(row, want) {
+		t.Errorf("got row %v, want %v", row, want)
+	}
+	if records[2][6] != "" {
+		t.Errorf("got variant %q for an order without variant, want it empty", records[2][6])
+	}
+	if fields := reflect.TypeOf(Order{}).NumField(); len(orderColumns) != fields {
+		t.Errorf("the export has %d columns for the %d fields of an order", len(orderColumns), fields)
+	}
+}
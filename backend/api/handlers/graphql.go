@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/DanVerh/university-swe/backend/api/auth"
+	"github.com/DanVerh/university-swe/backend/api/db"
+	"github.com/DanVerh/university-swe/backend/api/errorHandling"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Limits of a single GraphQL query
+const (
+	maxGraphQLDepth      = 6
+	maxGraphQLComplexity = 1000
+	// Every field costs 1; fields returning lists multiply the cost of their selections
+	graphQLListMultiplier = 10
+)
+
+// Fields returning lists, weighted by graphQLListMultiplier
+var graphQLListFields = map[string]bool{"products": true, "customers": true, "orders": true}
+
+// GraphQLHandler handles GraphQL queries and mutations over products, customers and orders
+type GraphQLHandler struct{}
+
+// graphQLRequest is the body of a GraphQL request
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// graphQLContext holds the database and the batched loaders of a single request
+type graphQLContext struct {
+	database       *mongo.Database
+	customers      *loader
+	products       *loader
+	customerOrders *loader
+}
+
+type graphQLContextKey struct{}
+
+// graphQLSchema is built once; resolvers find the database of the request in the context
+var graphQLSchema = newGraphQLSchema()
+
+// Serve handles POST requests with a GraphQL query
+func (graphQLHandler *GraphQLHandler) Serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorHandling.ThrowError(r.Context(), w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be POST", nil)
+		return
+	}
+
+	var request graphQLRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid JSON", err)
+		return
+	}
+	if err := checkGraphQLLimits(request.Query); err != nil {
+		writeGraphQL(w, http.StatusBadRequest, &graphql.Result{Errors: []gqlerrors.FormattedError{{Message: err.Error()}}})
+		return
+	}
+
+	db := db.DbConnect()
+	defer db.DbDisconnect()
+	database := db.Client.Database(dbName)
+
+	ctx := context.WithValue(r.Context(), graphQLContextKey{}, &graphQLContext{
+		database:       database,
+		customers:      documentLoader(database, customerCollection, func(customer *Customer) primitive.ObjectID { return customer.ID }),
+		products:       documentLoader(database, "products", func(product *Product) primitive.ObjectID { return product.ID }),
+		customerOrders: customerOrdersLoader(database),
+	})
+	result := graphql.Do(graphql.Params{
+		Schema:         graphQLSchema,
+		RequestString:  request.Query,
+		OperationName:  request.OperationName,
+		VariableValues: request.Variables,
+		Context:        ctx,
+	})
+	writeGraphQL(w, http.StatusOK, result)
+}
+
+func writeGraphQL(w http.ResponseWriter, status int, result *graphql.Result) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+// fromGraphQLContext returns the request state stored by Serve
+func fromGraphQLContext(ctx context.Context) *graphQLContext {
+	return ctx.Value(graphQLContextKey{}).(*graphQLContext)
+}
+
+// requirePermission fails the field unless the principal of the request has the permission
+func requirePermission(ctx context.Context, permission string) error {
+	if !auth.FromContext(ctx).Can(permission) {
+		return fmt.Errorf("Missing permission %s", permission)
+	}
+	return nil
+}
+
+// checkGraphQLLimits rejects queries nested deeper than maxGraphQLDepth or costing more than maxGraphQLComplexity.
+// Queries that do not parse are left to graphql.Do to report.
+func checkGraphQLLimits(query string) error {
+	document, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		return nil
+	}
+	fragments := map[string]*ast.FragmentDefinition{}
+	for _, definition := range document.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			fragments[fragment.Name.Value] = fragment
+		}
+	}
+	for _, definition := range document.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		depth, complexity := selectionCost(operation.SelectionSet, fragments, map[string]bool{})
+		if depth > maxGraphQLDepth {
+			return fmt.Errorf("Query depth %d exceeds the limit of %d", depth, maxGraphQLDepth)
+		}
+		if complexity > maxGraphQLComplexity {
+			return fmt.Errorf("Query complexity %d exceeds the limit of %d", complexity, maxGraphQLComplexity)
+		}
+	}
+	return nil
+}
+
+// selectionCost returns the depth and complexity of the selection set, following fragments once per path
+func selectionCost(selectionSet *ast.SelectionSet, fragments map[string]*ast.FragmentDefinition, visiting map[string]bool) (int, int) {
+	if selectionSet == nil {
+		return 0, 0
+	}
+	depth, complexity := 0, 0
+	add := func(childDepth, childComplexity int) {
+		depth = max(depth, childDepth)
+		complexity += childComplexity
+	}
+	for _, selection := range selectionSet.Selections {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			childDepth, childComplexity := selectionCost(selection.SelectionSet, fragments, visiting)
+			if graphQLListFields[selection.Name.Value] {
+				childComplexity *= graphQLListMultiplier
+			}
+			add(childDepth+1, childComplexity+1)
+		case *ast.InlineFragment:
+			add(selectionCost(selection.SelectionSet, fragments, visiting))
+		case *ast.FragmentSpread:
+			name := selection.Name.Value
+			fragment, ok := fragments[name]
+			if !ok || visiting[name] {
+				continue
+			}
+			visiting[name] = true
+			add(selectionCost(fragment.SelectionSet, fragments, visiting))
+			delete(visiting, name)
+		}
+	}
+	return depth, complexity
+}
+
+// objectIDScalar serializes ObjectIds as hex strings
+var objectIDScalar = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "ObjectID",
+	Description: "MongoDB ObjectId as a 24 character hex string",
+	Serialize: func(value interface{}) interface{} {
+		if id, ok := value.(primitive.ObjectID); ok {
+			return id.Hex()
+		}
+		return nil
+	},
+	ParseValue: func(value interface{}) interface{} {
+		text, ok := value.(string)
+		if !ok {
+			return nil
+		}
+		id, err := primitive.ObjectIDFromHex(text)
+		if err != nil {
+			return nil
+		}
+		return id
+	},
+	ParseLiteral: func(value ast.Value) interface{} {
+		text, ok := value.(*ast.StringValue)
+		if !ok {
+			return nil
+		}
+		id, err := primitive.ObjectIDFromHex(text.Value)
+		if err != nil {
+			return nil
+		}
+		return id
+	},
+})
+
+func newGraphQLSchema() graphql.Schema {
+	statusValues := graphql.EnumValueConfigMap{}
+	for _, status := range orderStatuses {
+		statusValues[status.(string)] = &graphql.EnumValueConfig{Value: status}
+	}
+	orderStatus := graphql.NewEnum(graphql.EnumConfig{Name: "OrderStatus", Values: statusValues})
+
+	productType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Product",
+		Fields: graphql.Fields{
+			"id":         &graphql.Field{Type: graphql.NewNonNull(objectIDScalar)},
+			"name":       &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"sku":        &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"barcode":    &graphql.Field{Type: graphql.String},
+			"price":      &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+			"amount":     &graphql.Field{Type: graphql.Int},
+			"categories": &graphql.Field{Type: graphql.NewList(graphql.NewNonNull(objectIDScalar))},
+		},
+	})
+
+	// Customer and Order reference each other, so their fields are thunks
+	var customerType, orderType *graphql.Object
+	customerType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Customer",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":      &graphql.Field{Type: graphql.NewNonNull(objectIDScalar)},
+				"name":    &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"address": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"orders": &graphql.Field{
+					Type: graphql.NewList(graphql.NewNonNull(orderType)),
+					Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+						if err := requirePermission(params.Context, auth.OrdersRead); err != nil {
+							return nil, err
+						}
+						customer := params.Source.(*Customer)
+						return fromGraphQLContext(params.Context).customerOrders.Load(params.Context, customer.ID), nil
+					},
+				},
+			}
+		}),
+	})
+	orderType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Order",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":         &graphql.Field{Type: graphql.NewNonNull(objectIDScalar)},
+				"amount":     &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+				"sum":        &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+				"paid":       &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+				"refunded":   &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+				"status":     &graphql.Field{Type: graphql.NewNonNull(orderStatus)},
+				"customerId": &graphql.Field{Type: graphql.NewNonNull(objectIDScalar), Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					return params.Source.(*Order).Customer, nil
+				}},
+				"productId": &graphql.Field{Type: graphql.NewNonNull(objectIDScalar), Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					return params.Source.(*Order).Product, nil
+				}},
+				"variantId": &graphql.Field{Type: objectIDScalar, Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					if variant := params.Source.(*Order).Variant; variant != nil {
+						return *variant, nil
+					}
+					return nil, nil
+				}},
+				// References resolve to null when the document was deleted
+				"customer": &graphql.Field{
+					Type: customerType,
+					Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+						if err := requirePermission(params.Context, auth.CustomersRead); err != nil {
+							return nil, err
+						}
+						order := params.Source.(*Order)
+						return fromGraphQLContext(params.Context).customers.Load(params.Context, order.Customer), nil
+					},
+				},
+				"product": &graphql.Field{
+					Type: productType,
+					Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+						if err := requirePermission(params.Context, auth.ProductsRead); err != nil {
+							return nil, err
+						}
+						order := params.Source.(*Order)
+						return fromGraphQLContext(params.Context).products.Load(params.Context, order.Product), nil
+					},
+				},
+			}
+		}),
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query:    graphQLQuery(productType, customerType, orderType, orderStatus),
+		Mutation: graphQLMutation(productType, customerType, orderType, orderStatus),
+	})
+	if err != nil {
+		panic(fmt.Sprintf("invalid GraphQL schema: %v", err))
+	}
+	return schema
+}
@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/DanVerh/university-swe/backend/api/auth"
+	"github.com/graphql-go/graphql"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// graphQLQuery defines the read operations, each requiring the read permission of its collection
+func graphQLQuery(productType, customerType, orderType *graphql.Object, orderStatus *graphql.Enum) *graphql.Object {
+	idArgument := graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(objectIDScalar)}}
+	nameArgument := graphql.FieldConfigArgument{"name": &graphql.ArgumentConfig{
+		Type: graphql.String, Description: "Case-insensitive name search"}}
+
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"products": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(productType))),
+				Args: nameArgument,
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					if err := requirePermission(params.Context, auth.ProductsRead); err != nil {
+						return nil, err
+					}
+					return findGraphQL[Product](params, "products", nameFilter(params.Args))
+				},
+			},
+			"product": &graphql.Field{
+				Type: productType,
+				Args: idArgument,
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					if err := requirePermission(params.Context, auth.ProductsRead); err != nil {
+						return nil, err
+					}
+					return findOneGraphQL[Product](params.Context, "products", params.Args["id"])
+				},
+			},
+			"customers": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(customerType))),
+				Args: nameArgument,
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					if err := requirePermission(params.Context, auth.CustomersRead); err != nil {
+						return nil, err
+					}
+					return findGraphQL[Customer](params, customerCollection, nameFilter(params.Args))
+				},
+			},
+			"customer": &graphql.Field{
+				Type: customerType,
+				Args: idArgument,
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					if err := requirePermission(params.Context, auth.CustomersRead); err != nil {
+						return nil, err
+					}
+					return findOneGraphQL[Customer](params.Context, customerCollection, params.Args["id"])
+				},
+			},
+			"orders": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(orderType))),
+				Args: graphql.FieldConfigArgument{
+					"status":   &graphql.ArgumentConfig{Type: orderStatus},
+					"customer": &graphql.ArgumentConfig{Type: objectIDScalar},
+					"product":  &graphql.ArgumentConfig{Type: objectIDScalar},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					if err := requirePermission(params.Context, auth.OrdersRead); err != nil {
+						return nil, err
+					}
+					filter := bson.M{}
+					for name, value := range params.Args {
+						filter[name] = value
+					}
+					return findGraphQL[Order](params, ordersCollection, filter)
+				},
+			},
+			"order": &graphql.Field{
+				Type: orderType,
+				Args: idArgument,
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					if err := requirePermission(params.Context, auth.OrdersRead); err != nil {
+						return nil, err
+					}
+					return findOneGraphQL[Order](params.Context, ordersCollection, params.Args["id"])
+				},
+			},
+		},
+	})
+}
+
+// graphQLMutation defines the write operations. They share validation, auditing and
+// order pricing with the REST handlers.
+func graphQLMutation(productType, customerType, orderType *graphql.Object, orderStatus *graphql.Enum) *graphql.Object {
+	idArgument := &graphql.ArgumentConfig{Type: graphql.NewNonNull(objectIDScalar)}
+	productInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "ProductInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"name":  &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"price": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Float)},
+		},
+	})
+	productUpdate := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "ProductUpdate",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"name":   &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"price":  &graphql.InputObjectFieldConfig{Type: graphql.Float},
+			"amount": &graphql.InputObjectFieldConfig{Type: graphql.Int},
+		},
+	})
+	customerInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "CustomerInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"name":    &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"address": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		},
+	})
+	customerUpdate := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "CustomerUpdate",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"name":    &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"address": &graphql.InputObjectFieldConfig{Type: graphql.String},
+		},
+	})
+	orderInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "OrderInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"customer": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(objectIDScalar)},
+			"product":  &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(objectIDScalar)},
+			"variant":  &graphql.InputObjectFieldConfig{Type: objectIDScalar, Description: "Required for products with variants"},
+			"amount":   &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createProduct": &graphql.Field{
+				Type: graphql.NewNonNull(productType),
+				Args: graphql.FieldConfigArgument{"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(productInput)}},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					if err := requirePermission(params.Context, auth.ProductsWrite); err != nil {
+						return nil, err
+					}
+					input := params.Args["input"].(map[string]interface{})
+					product := &Product{Name: input["name"].(string), Price: input["price"].(float64)}
+					if err := insertProduct(params.Context, fromGraphQLContext(params.Context).database, product); err != nil {
+						return nil, graphQLError(params.Context, err, "product")
+					}
+					return product, nil
+				},
+			},
+			"updateProduct": &graphql.Field{
+				Type: productType,
+				Args: graphql.FieldConfigArgument{"id": idArgument, "input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(productUpdate)}},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					if err := requirePermission(params.Context, auth.ProductsWrite); err != nil {
+						return nil, err
+					}
+					updateBody := bson.M(params.Args["input"].(map[string]interface{}))
+					// validateProductUpdate expects JSON numbers for amount
+					if amount, ok := updateBody["amount"].(int); ok {
+						updateBody["amount"] = float64(amount)
+					}
+					id := params.Args["id"].(primitive.ObjectID)
+					_, err := updateProduct(params.Context, fromGraphQLContext(params.Context).database, id, updateBody)
+					if err != nil {
+						return nil, graphQLError(params.Context, err, "product")
+					}
+					return findOneGraphQL[Product](params.Context, "products", id)
+				},
+			},
+			"deleteProduct": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Args: graphql.FieldConfigArgument{"id": idArgument},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					if err := requirePermission(params.Context, auth.ProductsDelete); err != nil {
+						return nil, err
+					}
+					err := deleteProduct(params.Context, fromGraphQLContext(params.Context).database, params.Args["id"].(primitive.ObjectID))
+					return err == nil, graphQLError(params.Context, err, "product")
+				},
+			},
+			"createCustomer": &graphql.Field{
+				Type: graphql.NewNonNull(customerType),
+				Args: graphql.FieldConfigArgument{"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(customerInput)}},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					if err := requirePermission(params.Context, auth.CustomersWrite); err != nil {
+						return nil, err
+					}
+					input := params.Args["input"].(map[string]interface{})
+					customer := &Customer{Name: input["name"].(string), Address: input["address"].(string)}
+					if err := insertCustomer(params.Context, fromGraphQLContext(params.Context).database, customer); err != nil {
+						return nil, graphQLError(params.Context, err, "customer")
+					}
+					return customer, nil
+				},
+			},
+			"updateCustomer": &graphql.Field{
+				Type: customerType,
+				Args: graphql.FieldConfigArgument{"id": idArgument, "input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(customerUpdate)}},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					if err := requirePermission(params.Context, auth.CustomersWrite); err != nil {
+						return nil, err
+					}
+					id := params.Args["id"].(primitive.ObjectID)
+					updateBody := bson.M(params.Args["input"].(map[string]interface{}))
+					_, err := updateCustomer(params.Context, fromGraphQLContext(params.Context).database, id, updateBody)
+					if err != nil {
+						return nil, graphQLError(params.Context, err, "customer")
+					}
+					return findOneGraphQL[Customer](params.Context, customerCollection, id)
+				},
+			},
+			"deleteCustomer": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Args: graphql.FieldConfigArgument{"id": idArgument},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					if err := requirePermission(params.Context, auth.CustomersDelete); err != nil {
+						return nil, err
+					}
+					err := deleteCustomer(params.Context, fromGraphQLContext(params.Context).database, params.Args["id"].(primitive.ObjectID))
+					return err == nil, graphQLError(params.Context, err, "customer")
+				},
+			},
+			"createOrder": &graphql.Field{
+				Type: graphql.NewNonNull(orderType),
+				Args: graphql.FieldConfigArgument{"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(orderInput)}},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					if err := requirePermission(params.Context, auth.OrdersWrite); err != nil {
+						return nil, err
+					}
+					input := params.Args["input"].(map[string]interface{})
+					order := &Order{
+						Customer: input["customer"].(primitive.ObjectID),
+						Product:  input["product"].(primitive.ObjectID),
+						Amount:   int32(input["amount"].(int)),
+					}
+					if variant, ok := input["variant"].(primitive.ObjectID); ok {
+						order.Variant = &variant
+					}
+					if err := insertOrder(params.Context, fromGraphQLContext(params.Context).database, order); err != nil {
+						return nil, graphQLError(params.Context, err, "order")
+					}
+					return order, nil
+				},
+			},
+			"updateOrderStatus": &graphql.Field{
+				Type: orderType,
+				Args: graphql.FieldConfigArgument{"id": idArgument, "status": &graphql.ArgumentConfig{Type: graphql.NewNonNull(orderStatus)}},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					if err := requirePermission(params.Context, auth.OrdersStatus); err != nil {
+						return nil, err
+					}
+					id := params.Args["id"].(primitive.ObjectID)
+					updateBody := bson.M{"status": params.Args["status"]}
+					_, err := updateOrder(params.Context, fromGraphQLContext(params.Context).database, id, updateBody)
+					if err != nil {
+						return nil, graphQLError(params.Context, err, "order")
+					}
+					return findOneGraphQL[Order](params.Context, ordersCollection, id)
+				},
+			},
+			"deleteOrder": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Args: graphql.FieldConfigArgument{"id": idArgument},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					if err := requirePermission(params.Context, auth.OrdersDelete); err != nil {
+						return nil, err
+					}
+					err := deleteOrder(params.Context, fromGraphQLContext(params.Context).database, params.Args["id"].(primitive.ObjectID))
+					return err == nil, graphQLError(params.Context, err, "order")
+				},
+			},
+		},
+	})
+}
+
+// nameFilter builds the case-insensitive name search of the REST list handlers
+func nameFilter(args map[string]interface{}) bson.M {
+	name, _ := args["name"].(string)
+	if name == "" {
+		return bson.M{}
+	}
+	return bson.M{"name": bson.M{"$regex": primitive.Regex{Pattern: name, Options: "i"}}}
+}
+
+// findGraphQL finds the documents of the collection matching the filter
+func findGraphQL[T any](params graphql.ResolveParams, collection string, filter bson.M) ([]*T, error) {
+	ctx := params.Context
+	cursor, err := fromGraphQLContext(ctx).database.Collection(collection).Find(ctx, filter)
+	if err != nil {
+		return nil, graphQLError(ctx, err, collection)
+	}
+	defer cursor.Close(ctx)
+
+	documents := []*T{}
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, graphQLError(ctx, err, collection)
+	}
+	return documents, nil
+}
+
+// findOneGraphQL finds a document by id, resolving to null if it does not exist
+func findOneGraphQL[T any](ctx context.Context, collection string, id interface{}) (interface{}, error) {
+	var document T
+	err := fromGraphQLContext(ctx).database.Collection(collection).FindOne(ctx, bson.M{"_id": id}).Decode(&document)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, graphQLError(ctx, err, collection)
+	}
+	return &document, nil
+}
+
+// graphQLError reports validation and missing document errors to the client.
+// Database errors are logged and replaced, as the REST handlers do.
+func graphQLError(ctx context.Context, err error, resource string) error {
+	switch {
+	case err == nil:
+		return nil
+	case err == mongo.ErrNoDocuments:
+		return fmt.Errorf("No %s found with the provided ID", resource)
+	case isInvalid(err), err == errCustomerNotFound, err == errProductNotFound, err == errVariantNotFound, err == errOutOfStock,
+		err == errSKUTaken, err == errBarcodeTaken:
+		return err
+	}
+	slog.ErrorContext(ctx, "GraphQL resolver failed", "resource", resource, "error", err)
+	return errors.New("Internal server error")
+}
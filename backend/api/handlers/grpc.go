@@ -0,0 +1,454 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+
+	"github.com/DanVerh/university-swe/backend/api/auth"
+	"github.com/DanVerh/university-swe/backend/api/db"
+	salesv1 "github.com/DanVerh/university-swe/backend/api/proto/sales/v1"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+//go:generate protoc --proto_path=../proto --go_out=../proto --go_opt=paths=source_relative --go-grpc_out=../proto --go-grpc_opt=paths=source_relative sales/v1/sales.proto
+
+// SalesServer implements the gRPC SalesService with the same store functions as the REST handlers
+type SalesServer struct {
+	salesv1.UnimplementedSalesServiceServer
+}
+
+// NewGRPCServer creates a gRPC server with the SalesService that authenticates every call
+func NewGRPCServer(authenticator *auth.Authenticator) *grpc.Server {
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(authenticator.UnaryInterceptor),
+		grpc.StreamInterceptor(authenticator.StreamInterceptor),
+	)
+	salesv1.RegisterSalesServiceServer(server, &SalesServer{})
+	return server
+}
+
+func (server *SalesServer) CreateProduct(ctx context.Context, request *salesv1.CreateProductRequest) (*salesv1.Product, error) {
+	if err := grpcPermission(ctx, auth.ProductsWrite); err != nil {
+		return nil, err
+	}
+	database := db.DbConnect()
+	defer database.DbDisconnect()
+
+	product := Product{Name: request.GetName(), Price: request.GetPrice()}
+	if err := insertProduct(ctx, database.Client.Database(dbName), &product); err != nil {
+		return nil, grpcError(ctx, err, "products")
+	}
+	return productMessage(&product), nil
+}
+
+func (server *SalesServer) GetProduct(ctx context.Context, request *salesv1.GetProductRequest) (*salesv1.Product, error) {
+	if err := grpcPermission(ctx, auth.ProductsRead); err != nil {
+		return nil, err
+	}
+	product, err := findOneGRPC[Product](ctx, "products", request.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return productMessage(product), nil
+}
+
+func (server *SalesServer) ListProducts(ctx context.Context, request *salesv1.ListProductsRequest) (*salesv1.ListProductsResponse, error) {
+	if err := grpcPermission(ctx, auth.ProductsRead); err != nil {
+		return nil, err
+	}
+	products, err := findGRPC[Product](ctx, "products", nameFilter(map[string]interface{}{"name": request.GetName()}))
+	if err != nil {
+		return nil, err
+	}
+	response := &salesv1.ListProductsResponse{}
+	for _, product := range products {
+		response.Products = append(response.Products, productMessage(product))
+	}
+	return response, nil
+}
+
+func (server *SalesServer) UpdateProduct(ctx context.Context, request *salesv1.UpdateProductRequest) (*salesv1.Product, error) {
+	if err := grpcPermission(ctx, auth.ProductsWrite); err != nil {
+		return nil, err
+	}
+	id, err := grpcObjectID(request.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	// Amounts are numbers in the REST body, so they are passed as float64 to the shared validation
+	updateBody := bson.M{}
+	if request.Name != nil {
+		updateBody["name"] = request.GetName()
+	}
+	if request.Price != nil {
+		updateBody["price"] = request.GetPrice()
+	}
+	if request.Amount != nil {
+		updateBody["amount"] = float64(request.GetAmount())
+	}
+	if len(updateBody) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "No fields to update")
+	}
+
+	database := db.DbConnect()
+	defer database.DbDisconnect()
+
+	if _, err := updateProduct(ctx, database.Client.Database(dbName), id, updateBody); err != nil {
+		return nil, grpcError(ctx, err, "products")
+	}
+	return server.GetProduct(ctx, &salesv1.GetProductRequest{Id: request.GetId()})
+}
+
+func (server *SalesServer) DeleteProduct(ctx context.Context, request *salesv1.DeleteProductRequest) (*salesv1.DeleteResponse, error) {
+	if err := grpcPermission(ctx, auth.ProductsDelete); err != nil {
+		return nil, err
+	}
+	id, err := grpcObjectID(request.GetId())
+	if err != nil {
+		return nil, err
+	}
+	database := db.DbConnect()
+	defer database.DbDisconnect()
+
+	if err := deleteProduct(ctx, database.Client.Database(dbName), id); err != nil {
+		return nil, grpcError(ctx, err, "products")
+	}
+	return &salesv1.DeleteResponse{}, nil
+}
+
+func (server *SalesServer) CreateCustomer(ctx context.Context, request *salesv1.CreateCustomerRequest) (*salesv1.Customer, error) {
+	if err := grpcPermission(ctx, auth.CustomersWrite); err != nil {
+		return nil, err
+	}
+	database := db.DbConnect()
+	defer database.DbDisconnect()
+
+	customer := Customer{Name: request.GetName(), Address: request.GetAddress()}
+	if err := insertCustomer(ctx, database.Client.Database(dbName), &customer); err != nil {
+		return nil, grpcError(ctx, err, customerCollection)
+	}
+	return customerMessage(&customer), nil
+}
+
+func (server *SalesServer) GetCustomer(ctx context.Context, request *salesv1.GetCustomerRequest) (*salesv1.Customer, error) {
+	if err := grpcPermission(ctx, auth.CustomersRead); err != nil {
+		return nil, err
+	}
+	customer, err := findOneGRPC[Customer](ctx, customerCollection, request.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return customerMessage(customer), nil
+}
+
+func (server *SalesServer) ListCustomers(ctx context.Context, request *salesv1.ListCustomersRequest) (*salesv1.ListCustomersResponse, error) {
+	if err := grpcPermission(ctx, auth.CustomersRead); err != nil {
+		return nil, err
+	}
+	customers, err := findGRPC[Customer](ctx, customerCollection, nameFilter(map[string]interface{}{"name": request.GetName()}))
+	if err != nil {
+		return nil, err
+	}
+	response := &salesv1.ListCustomersResponse{}
+	for _, customer := range customers {
+		response.Customers = append(response.Customers, customerMessage(customer))
+	}
+	return response, nil
+}
+
+func (server *SalesServer) UpdateCustomer(ctx context.Context, request *salesv1.UpdateCustomerRequest) (*salesv1.Customer, error) {
+	if err := grpcPermission(ctx, auth.CustomersWrite); err != nil {
+		return nil, err
+	}
+	id, err := grpcObjectID(request.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	updateBody := bson.M{}
+	if request.Name != nil {
+		updateBody["name"] = request.GetName()
+	}
+	if request.Address != nil {
+		updateBody["address"] = request.GetAddress()
+	}
+	if len(updateBody) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "No fields to update")
+	}
+
+	database := db.DbConnect()
+	defer database.DbDisconnect()
+
+	if _, err := updateCustomer(ctx, database.Client.Database(dbName), id, updateBody); err != nil {
+		return nil, grpcError(ctx, err, customerCollection)
+	}
+	return server.GetCustomer(ctx, &salesv1.GetCustomerRequest{Id: request.GetId()})
+}
+
+func (server *SalesServer) DeleteCustomer(ctx context.Context, request *salesv1.DeleteCustomerRequest) (*salesv1.DeleteResponse, error) {
+	if err := grpcPermission(ctx, auth.CustomersDelete); err != nil {
+		return nil, err
+	}
+	id, err := grpcObjectID(request.GetId())
+	if err != nil {
+		return nil, err
+	}
+	database := db.DbConnect()
+	defer database.DbDisconnect()
+
+	if err := deleteCustomer(ctx, database.Client.Database(dbName), id); err != nil {
+		return nil, grpcError(ctx, err, customerCollection)
+	}
+	return &salesv1.DeleteResponse{}, nil
+}
+
+func (server *SalesServer) CreateOrder(ctx context.Context, request *salesv1.CreateOrderRequest) (*salesv1.Order, error) {
+	if err := grpcPermission(ctx, auth.OrdersWrite); err != nil {
+		return nil, err
+	}
+	customer, err := grpcObjectID(request.GetCustomer())
+	if err != nil {
+		return nil, err
+	}
+	product, err := grpcObjectID(request.GetProduct())
+	if err != nil {
+		return nil, err
+	}
+	database := db.DbConnect()
+	defer database.DbDisconnect()
+
+	order := Order{Customer: customer, Product: product, Amount: request.GetAmount()}
+	if err := insertOrder(ctx, database.Client.Database(dbName), &order); err != nil {
+		return nil, grpcError(ctx, err, ordersCollection)
+	}
+	return orderMessage(&order), nil
+}
+
+func (server *SalesServer) GetOrder(ctx context.Context, request *salesv1.GetOrderRequest) (*salesv1.Order, error) {
+	if err := grpcPermission(ctx, auth.OrdersRead); err != nil {
+		return nil, err
+	}
+	order, err := findOneGRPC[Order](ctx, ordersCollection, request.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return orderMessage(order), nil
+}
+
+// StreamOrders sends the matching orders one by one while reading them from the cursor,
+// so exports of the whole collection are never held in memory
+func (server *SalesServer) StreamOrders(request *salesv1.StreamOrdersRequest, stream grpc.ServerStreamingServer[salesv1.Order]) error {
+	ctx := stream.Context()
+	if err := grpcPermission(ctx, auth.OrdersRead); err != nil {
+		return err
+	}
+
+	filter := bson.M{}
+	if request.GetStatus() != salesv1.OrderStatus_ORDER_STATUS_UNSPECIFIED {
+		filter["status"] = orderStatusName(request.GetStatus())
+	}
+	for field, value := range map[string]string{"customer": request.GetCustomer(), "product": request.GetProduct()} {
+		if value == "" {
+			continue
+		}
+		id, err := grpcObjectID(value)
+		if err != nil {
+			return err
+		}
+		filter[field] = id
+	}
+
+	database := db.DbConnect()
+	defer database.DbDisconnect()
+
+	cursor, err := database.Client.Database(dbName).Collection(ordersCollection).Find(ctx, filter)
+	if err != nil {
+		return grpcError(ctx, err, ordersCollection)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var order Order
+		if err := cursor.Decode(&order); err != nil {
+			return grpcError(ctx, err, ordersCollection)
+		}
+		if err := stream.Send(orderMessage(&order)); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return grpcError(ctx, err, ordersCollection)
+	}
+	return nil
+}
+
+func (server *SalesServer) UpdateOrderStatus(ctx context.Context, request *salesv1.UpdateOrderStatusRequest) (*salesv1.Order, error) {
+	if err := grpcPermission(ctx, auth.OrdersStatus); err != nil {
+		return nil, err
+	}
+	id, err := grpcObjectID(request.GetId())
+	if err != nil {
+		return nil, err
+	}
+	if request.GetStatus() == salesv1.OrderStatus_ORDER_STATUS_UNSPECIFIED {
+		return nil, status.Error(codes.InvalidArgument, "Status is required")
+	}
+	database := db.DbConnect()
+	defer database.DbDisconnect()
+
+	updateBody := bson.M{"status": orderStatusName(request.GetStatus())}
+	if _, err := updateOrder(ctx, database.Client.Database(dbName), id, updateBody); err != nil {
+		return nil, grpcError(ctx, err, ordersCollection)
+	}
+	return server.GetOrder(ctx, &salesv1.GetOrderRequest{Id: request.GetId()})
+}
+
+func (server *SalesServer) DeleteOrder(ctx context.Context, request *salesv1.DeleteOrderRequest) (*salesv1.DeleteResponse, error) {
+	if err := grpcPermission(ctx, auth.OrdersDelete); err != nil {
+		return nil, err
+	}
+	id, err := grpcObjectID(request.GetId())
+	if err != nil {
+		return nil, err
+	}
+	database := db.DbConnect()
+	defer database.DbDisconnect()
+
+	if err := deleteOrder(ctx, database.Client.Database(dbName), id); err != nil {
+		return nil, grpcError(ctx, err, ordersCollection)
+	}
+	return &salesv1.DeleteResponse{}, nil
+}
+
+func (server *SalesServer) SumDeliveredOrders(ctx context.Context, request *salesv1.SumDeliveredOrdersRequest) (*salesv1.SumDeliveredOrdersResponse, error) {
+	if err := grpcPermission(ctx, auth.ReportsRead); err != nil {
+		return nil, err
+	}
+	database := db.DbConnect()
+	defer database.DbDisconnect()
+
+	totalSum, err := sumDeliveredOrders(ctx, database.Client.Database(dbName))
+	if err != nil {
+		return nil, grpcError(ctx, err, ordersCollection)
+	}
+	return &salesv1.SumDeliveredOrdersResponse{TotalSum: totalSum}, nil
+}
+
+// findGRPC finds the documents of the collection matching the filter
+func findGRPC[T any](ctx context.Context, collection string, filter bson.M) ([]*T, error) {
+	database := db.DbConnect()
+	defer database.DbDisconnect()
+
+	cursor, err := database.Client.Database(dbName).Collection(collection).Find(ctx, filter)
+	if err != nil {
+		return nil, grpcError(ctx, err, collection)
+	}
+	defer cursor.Close(ctx)
+
+	documents := []*T{}
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, grpcError(ctx, err, collection)
+	}
+	return documents, nil
+}
+
+// findOneGRPC finds a document by its hex id
+func findOneGRPC[T any](ctx context.Context, collection string, id string) (*T, error) {
+	objectID, err := grpcObjectID(id)
+	if err != nil {
+		return nil, err
+	}
+	database := db.DbConnect()
+	defer database.DbDisconnect()
+
+	var document T
+	err = database.Client.Database(dbName).Collection(collection).FindOne(ctx, bson.M{"_id": objectID}).Decode(&document)
+	if err != nil {
+		return nil, grpcError(ctx, err, collection)
+	}
+	return &document, nil
+}
+
+// grpcPermission is requirePermission with the gRPC status code
+func grpcPermission(ctx context.Context, permission string) error {
+	if err := requirePermission(ctx, permission); err != nil {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return nil
+}
+
+// grpcObjectID parses a hex ObjectId of a request
+func grpcObjectID(id string) (primitive.ObjectID, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return objectID, status.Error(codes.InvalidArgument, "Invalid ObjectId format")
+	}
+	return objectID, nil
+}
+
+// grpcError maps store errors to gRPC status codes like the REST handlers map them to HTTP statuses.
+// Database errors are logged and replaced.
+func grpcError(ctx context.Context, err error, resource string) error {
+	switch {
+	case isInvalid(err):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case err == errCustomerNotFound || err == errProductNotFound || err == errVariantNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	case err == errOutOfStock:
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case err == errSKUTaken || err == errBarcodeTaken:
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return status.Errorf(codes.NotFound, "No %s found with the given ID", singular(resource))
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	}
+	slog.ErrorContext(ctx, "gRPC call failed", "resource", resource, "error", err)
+	return status.Error(codes.Internal, "Internal server error")
+}
+
+// singular turns a collection name into the name of one of its documents
+func singular(resource string) string {
+	return strings.TrimSuffix(resource, "s")
+}
+
+func productMessage(product *Product) *salesv1.Product {
+	message := &salesv1.Product{Id: product.ID.Hex(), Name: product.Name, Price: product.Price}
+	if product.Amount != nil {
+		message.Amount = *product.Amount
+	}
+	return message
+}
+
+func customerMessage(customer *Customer) *salesv1.Customer {
+	return &salesv1.Customer{Id: customer.ID.Hex(), Name: customer.Name, Address: customer.Address}
+}
+
+func orderMessage(order *Order) *salesv1.Order {
+	return &salesv1.Order{
+		Id:       order.ID.Hex(),
+		Customer: order.Customer.Hex(),
+		Product:  order.Product.Hex(),
+		Amount:   order.Amount,
+		Sum:      order.Sum,
+		Status:   orderStatusValue(order.Status),
+	}
+}
+
+// orderStatusName converts ORDER_STATUS_SHIPPED to the stored "shipped"
+func orderStatusName(value salesv1.OrderStatus) string {
+	return strings.ToLower(strings.TrimPrefix(value.String(), "ORDER_STATUS_"))
+}
+
+// orderStatusValue converts a stored status to the enum, unknown statuses are unspecified
+func orderStatusValue(name string) salesv1.OrderStatus {
+	return salesv1.OrderStatus(salesv1.OrderStatus_value["ORDER_STATUS_"+strings.ToUpper(name)])
+}
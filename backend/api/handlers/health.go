@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/DanVerh/university-swe/backend/api/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Time allowed for each readiness check
+const readinessTimeout = 2 * time.Second
+
+// Check results
+const (
+	checkOK   = "ok"
+	checkFail = "fail"
+)
+
+// HealthHandler handles liveness and readiness probes
+type HealthHandler struct{}
+
+// healthCheck is the result of a single readiness check
+type healthCheck struct {
+	Status   string      `json:"status"`
+	Duration string      `json:"duration"`
+	Error    string      `json:"error,omitempty"`
+	Details  interface{} `json:"details,omitempty"`
+}
+
+// healthReport is the response of the probes
+type healthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]healthCheck `json:"checks,omitempty"`
+}
+
+// migrationState is the version document written by golang-migrate
+type migrationState struct {
+	Version  int  `json:"version" bson:"version"`
+	Dirty    bool `json:"dirty" bson:"dirty"`
+	Expected int  `json:"expected" bson:"-"`
+}
+
+// Livez handles GET requests of the liveness probe. It only reports that the process serves requests.
+func (healthHandler *HealthHandler) Livez(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, healthReport{Status: checkOK})
+}
+
+// Readyz handles GET requests of the readiness probe. It pings MongoDB and checks the
+// migration version, responding 503 with the failed checks when the instance cannot serve traffic.
+func (healthHandler *HealthHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	report := healthReport{Status: checkOK, Checks: map[string]healthCheck{}}
+	status := http.StatusOK
+
+	// Probes run every few seconds, so they ping through the shared client instead of connecting each time
+	database, err := db.Shared()
+	if err != nil {
+		report.Checks["mongo"] = healthCheck{Status: checkFail, Duration: "0s", Error: err.Error()}
+		report.Status = checkFail
+		writeHealth(w, http.StatusServiceUnavailable, report)
+		return
+	}
+
+	checks := map[string]func(ctx context.Context) (interface{}, error){
+		"mongo": func(ctx context.Context) (interface{}, error) {
+			return nil, database.Client.Ping(ctx, nil)
+		},
+		"migrations": func(ctx context.Context) (interface{}, error) {
+			state, err := checkMigrations(ctx, database.Client.Database(dbName))
+			if state == nil {
+				return nil, err
+			}
+			return state, err
+		},
+	}
+
+	// Run the checks concurrently so the probe takes at most one timeout
+	var mutex sync.Mutex
+	var group sync.WaitGroup
+	for name, check := range checks {
+		group.Add(1)
+		go func(name string, check func(ctx context.Context) (interface{}, error)) {
+			defer group.Done()
+			result := runCheck(r.Context(), check)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if result.Status != checkOK {
+				report.Status = checkFail
+				status = http.StatusServiceUnavailable
+			}
+			report.Checks[name] = result
+		}(name, check)
+	}
+	group.Wait()
+
+	writeHealth(w, status, report)
+}
+
+// runCheck runs the check with the readiness timeout and records its outcome and duration
+func runCheck(ctx context.Context, check func(ctx context.Context) (interface{}, error)) healthCheck {
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	start := time.Now()
+	details, err := check(ctx)
+	result := healthCheck{Status: checkOK, Duration: time.Since(start).String(), Details: details}
+	if err != nil {
+		result.Status = checkFail
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// checkMigrations verifies the database is migrated to db.MigrationVersion and the last migration did not fail
+func checkMigrations(ctx context.Context, database *mongo.Database) (*migrationState, error) {
+	state := &migrationState{Expected: db.MigrationVersion}
+	findOptions := options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})
+	err := database.Collection(db.MigrationsCollection).FindOne(ctx, bson.M{}, findOptions).Decode(state)
+	if err == mongo.ErrNoDocuments {
+		return state, fmt.Errorf("database is not migrated")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if state.Dirty {
+		return state, fmt.Errorf("migration %d is dirty", state.Version)
+	}
+	if state.Version != db.MigrationVersion {
+		return state, fmt.Errorf("migration version %d, expected %d", state.Version, db.MigrationVersion)
+	}
+	return state, nil
+}
+
+func writeHealth(w http.ResponseWriter, status int, report healthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/DanVerh/university-swe/backend/api/barcode"
+	"github.com/DanVerh/university-swe/backend/api/db"
+	"github.com/DanVerh/university-swe/backend/api/errorHandling"
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Errors of SKUs and barcodes used by another product
+var (
+	errSKUTaken     = errors.New("SKU is already used by another product")
+	errBarcodeTaken = errors.New("Barcode is already used by another product")
+)
+
+// errIdentifierTaken is reported for a duplicate key, as the unique index does not tell which field collided
+var errIdentifierTaken = errors.New("Name, SKU or barcode is already used by another product")
+
+// skuPattern allows letters, digits, dots, dashes and underscores, starting with a letter or digit
+var skuPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// Size of barcode images: module width in pixels and bar height in modules
+const (
+	defaultBarcodeScale = 2
+	maxBarcodeScale     = 10
+	barcodeHeight       = 60
+)
+
+// GetBySKU handles GET requests for the product with a SKU, or with a variant with the SKU
+func (productHandler *ProductsHandler) GetBySKU(w http.ResponseWriter, r *http.Request) {
+	sku := chi.URLParam(r, "sku")
+	productHandler.findOne(w, r, bson.M{"$or": bson.A{bson.M{"sku": sku}, bson.M{"variants.sku": sku}}}, "No product found with the given SKU")
+}
+
+// GetByBarcode handles GET requests for the product with an EAN-13 or UPC-A barcode.
+// A UPC-A code also finds the product stored with the same code as EAN-13 and the other way round.
+func (productHandler *ProductsHandler) GetByBarcode(w http.ResponseWriter, r *http.Request) {
+	code := chi.URLParam(r, "code")
+	if _, err := barcode.Validate(code); err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	productHandler.findOne(w, r, bson.M{"barcode": bson.M{"$in": barcode.Equivalents(code)}}, "No product found with the given barcode")
+}
+
+func (productHandler *ProductsHandler) findOne(w http.ResponseWriter, r *http.Request, filter bson.M, notFound string) {
+	db := db.DbConnect()
+	defer db.DbDisconnect()
+
+	var product Product
+	err := db.Client.Database(dbName).Collection("products").FindOne(r.Context(), filter).Decode(&product)
+	if err == mongo.ErrNoDocuments {
+		errorHandling.ThrowError(r.Context(), w, http.StatusNotFound, notFound, nil)
+		return
+	}
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to retrieve product", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(product)
+}
+
+// Barcode handles GET requests for the barcode image of a product for labels.
+// ?format is svg (default) or png, ?scale the width of a bar module in pixels.
+func (productHandler *ProductsHandler) Barcode(w http.ResponseWriter, r *http.Request) {
+	objectID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid ObjectId format", nil)
+		return
+	}
+
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = "svg"
+	}
+	if format != "svg" && format != "png" {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid format. Needs to be svg or png", nil)
+		return
+	}
+	scale := defaultBarcodeScale
+	if value := r.URL.Query().Get("scale"); value != "" {
+		scale, err = strconv.Atoi(value)
+		if err != nil || scale < 1 || scale > maxBarcodeScale {
+			errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, fmt.Sprintf("Invalid scale. Needs to be between 1 and %d", maxBarcodeScale), nil)
+			return
+		}
+	}
+
+	db := db.DbConnect()
+	defer db.DbDisconnect()
+
+	var product Product
+	err = db.Client.Database(dbName).Collection("products").FindOne(r.Context(), bson.M{"_id": objectID},
+		options.FindOne().SetProjection(bson.M{"barcode": 1})).Decode(&product)
+	if err == mongo.ErrNoDocuments {
+		errorHandling.ThrowError(r.Context(), w, http.StatusNotFound, "No product found with the given ID", nil)
+		return
+	}
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to retrieve product", err)
+		return
+	}
+	if product.Barcode == "" {
+		errorHandling.ThrowError(r.Context(), w, http.StatusNotFound, "The product has no barcode", nil)
+		return
+	}
+
+	symbol, err := barcode.Encode(product.Barcode)
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Stored barcode is invalid", err)
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", product.Barcode+"."+format))
+	if format == "png" {
+		w.Header().Set("Content-Type", "image/png")
+		symbol.PNG(w, scale, barcodeHeight)
+		return
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	symbol.SVG(w, scale, barcodeHeight)
+}
+
+// validateSKU checks the characters and length of a SKU
+func validateSKU(sku string) error {
+	if !skuPattern.MatchString(sku) {
+		return errors.New("SKU needs 1 to 64 letters, digits, dots, dashes or underscores, starting with a letter or digit")
+	}
+	return nil
+}
+
+// validateBarcode checks that a barcode is an EAN-13 or UPC-A code with a correct check digit
+func validateBarcode(code string) error {
+	_, err := barcode.Validate(code)
+	return err
+}
+
+// defaultSKU derives the SKU of a new product without one from its ID
+func defaultSKU(product *Product) {
+	if product.SKU == "" {
+		product.SKU = skuFromID(product.ID)
+	}
+}
+
+// skuFromID is the SKU of a product created without one, as set by the migration for existing products
+func skuFromID(id primitive.ObjectID) string {
+	return "P-" + strings.ToUpper(id.Hex())
+}
+
+// productSKUs returns the SKU of the product and of its variants
+func productSKUs(product *Product) []string {
+	skus := []string{product.SKU}
+	for _, variant := range product.Variants {
+		skus = append(skus, variant.SKU)
+	}
+	return skus
+}
+
+// checkProductIdentifiers returns errSKUTaken if one of the SKUs is used by one of the other
+// products or their variants, and errBarcodeTaken if one of them has the barcode in either form.
+// others selects the products to check, an empty barcode is not checked.
+func checkProductIdentifiers(ctx context.Context, database *mongo.Database, others bson.M, skus []string, code string) error {
+	collection := database.Collection("products")
+	if len(skus) > 0 {
+		filter := bson.M{"$and": bson.A{others, bson.M{"$or": bson.A{bson.M{"sku": bson.M{"$in": skus}}, bson.M{"variants.sku": bson.M{"$in": skus}}}}}}
+		count, err := collection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return errSKUTaken
+		}
+	}
+	if code != "" {
+		filter := bson.M{"$and": bson.A{others, bson.M{"barcode": bson.M{"$in": barcode.Equivalents(code)}}}}
+		count, err := collection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return errBarcodeTaken
+		}
+	}
+	return nil
+}
+
+// checkUpdatedIdentifiers checks the SKU and barcode set by a validated update body of a product
+func checkUpdatedIdentifiers(ctx context.Context, database *mongo.Database, id primitive.ObjectID, updateBody bson.M) error {
+	sku, _ := updateBody["sku"].(string)
+	code, _ := updateBody["barcode"].(string)
+	if sku == "" && code == "" {
+		return nil
+	}
+	var skus []string
+	if sku != "" {
+		skus = []string{sku}
+	}
+	return checkProductIdentifiers(ctx, database, bson.M{"_id": bson.M{"$ne": id}}, skus, code)
+}
+
+// productConflict returns the message of an error of a SKU, barcode or name used by another product
+func productConflict(err error) (string, bool) {
+	switch {
+	case err == errSKUTaken || err == errBarcodeTaken:
+		return err.Error(), true
+	case mongo.IsDuplicateKeyError(err):
+		return errIdentifierTaken.Error(), true
+	}
+	return "", false
+}
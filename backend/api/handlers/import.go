@@ -0,0 +1,361 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/DanVerh/university-swe/backend/api/audit"
+	"github.com/DanVerh/university-swe/backend/api/db"
+	"github.com/DanVerh/university-swe/backend/api/errorHandling"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Number of CSV rows written to Mongo with a single BulkWrite
+const importChunkSize = 500
+
+// ImportReport summarizes an import and lists the rows that failed
+type ImportReport struct {
+	Created int           `json:"created"`
+	Updated int           `json:"updated"`
+	Failed  int           `json:"failed"`
+	Errors  []ImportError `json:"errors,omitempty"`
+}
+
+// ImportError is the error of a single CSV row, numbered as in the file
+type ImportError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// importRow is a parsed CSV row ready to be written
+type importRow struct {
+	line     int
+	model    mongo.WriteModel
+	id       primitive.ObjectID // id of the document if the row inserts one
+	document bson.M             // inserted document or fields set by an upsert, for the audit trail
+	upsertBy string             // product name matched by an upsert
+}
+
+// Import handles POST requests streaming a CSV file of products.
+// With ?upsert=true existing products are matched by name and updated.
+func (productHandler *ProductsHandler) Import(w http.ResponseWriter, r *http.Request) {
+	upsert := r.URL.Query().Get("upsert") == "true"
+	importCSV(w, r, func(ctx context.Context, database *mongo.Database) (*ImportReport, error) {
+		return ImportProducts(ctx, database, r.Body, upsert)
+	})
+}
+
+// Import handles POST requests streaming a CSV file of customers
+func (customersHandler *CustomersHandler) Import(w http.ResponseWriter, r *http.Request) {
+	importCSV(w, r, func(ctx context.Context, database *mongo.Database) (*ImportReport, error) {
+		return ImportCustomers(ctx, database, r.Body)
+	})
+}
+
+func importCSV(w http.ResponseWriter, r *http.Request, run func(ctx context.Context, database *mongo.Database) (*ImportReport, error)) {
+	if r.Method != http.MethodPost {
+		errorHandling.ThrowError(r.Context(), w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be POST", nil)
+		return
+	}
+
+	db := db.DbConnect()
+	defer db.DbDisconnect()
+
+	report, err := run(r.Context(), db.Client.Database(dbName))
+	if isInvalid(err) {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to import", err)
+		return
+	}
+
+	status := http.StatusOK
+	if report.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// ImportProducts streams CSV rows with name, price and optional sku, barcode and amount columns into the products
+// collection. Every row passes the same validation as Create; with upsert rows are matched by the unique name.
+func ImportProducts(ctx context.Context, database *mongo.Database, source io.Reader, upsert bool) (*ImportReport, error) {
+	parse := func(record map[string]string) (*importRow, error) {
+		var product Product
+		product.Name = record["name"]
+		product.SKU = record["sku"]
+		product.Barcode = record["barcode"]
+
+		price, err := strconv.ParseFloat(record["price"], 64)
+		if err != nil {
+			return nil, errors.New("Invalid price")
+		}
+		product.Price = price
+
+		if err := validateProduct(&product); err != nil {
+			return nil, err
+		}
+
+		amount := int32(0)
+		_, hasAmount := record["amount"]
+		if hasAmount && record["amount"] != "" {
+			value, err := strconv.ParseInt(record["amount"], 10, 32)
+			if err != nil || value < 0 {
+				return nil, errors.New("Invalid amount. Expected a non-negative integer")
+			}
+			amount = int32(value)
+		} else {
+			hasAmount = false
+		}
+
+		// An upsert may set the SKU or barcode the product with the same name already has
+		others := bson.M{}
+		if upsert {
+			others = bson.M{"name": bson.M{"$ne": product.Name}}
+		}
+		if product.SKU != "" || product.Barcode != "" {
+			var skus []string
+			if product.SKU != "" {
+				skus = []string{product.SKU}
+			}
+			if err := checkProductIdentifiers(ctx, database, others, skus, product.Barcode); err != nil {
+				return nil, err
+			}
+		}
+
+		product.ID = primitive.NewObjectID()
+		if !upsert {
+			defaultSKU(&product)
+			product.Amount = &amount
+			return &importRow{model: mongo.NewInsertOneModel().SetDocument(product), id: product.ID, document: toBsonM(product)}, nil
+		}
+
+		set := bson.M{"price": product.Price}
+		setOnInsert := bson.M{"_id": product.ID}
+		if product.SKU != "" {
+			set["sku"] = product.SKU
+		} else {
+			setOnInsert["sku"] = skuFromID(product.ID)
+		}
+		if product.Barcode != "" {
+			set["barcode"] = product.Barcode
+		}
+		if hasAmount {
+			set["amount"] = amount
+		} else {
+			setOnInsert["amount"] = amount
+		}
+		model := mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"name": product.Name}).
+			SetUpdate(bson.M{"$set": set, "$setOnInsert": setOnInsert}).
+			SetUpsert(true)
+		document := bson.M{"name": product.Name}
+		for key, value := range set {
+			document[key] = value
+		}
+		return &importRow{model: model, id: product.ID, document: document, upsertBy: product.Name}, nil
+	}
+
+	return importRows(ctx, database.Collection("products"), source, []string{"name", "price"}, parse)
+}
+
+// ImportCustomers streams CSV rows with name and address columns into the customers collection
+func ImportCustomers(ctx context.Context, database *mongo.Database, source io.Reader) (*ImportReport, error) {
+	parse := func(record map[string]string) (*importRow, error) {
+		customer := Customer{Name: record["name"], Address: record["address"]}
+		if err := validateCustomer(&customer); err != nil {
+			return nil, err
+		}
+		customer.ID = primitive.NewObjectID()
+		return &importRow{model: mongo.NewInsertOneModel().SetDocument(customer), id: customer.ID, document: toBsonM(customer)}, nil
+	}
+
+	return importRows(ctx, database.Collection(customerCollection), source, []string{"name", "address"}, parse)
+}
+
+// importRows reads the CSV header, parses every row into a write model and writes them in chunks.
+// A missing or incomplete header and an unreadable body are validation errors, others come from the database.
+func importRows(ctx context.Context, collection *mongo.Collection, source io.Reader, required []string, parse func(map[string]string) (*importRow, error)) (*ImportReport, error) {
+	reader := csv.NewReader(source)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, invalid(fmt.Errorf("Failed to read CSV header: %w", err))
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+	for _, column := range required {
+		if !containsString(header, column) {
+			return nil, invalid(fmt.Errorf("Missing required column %q", column))
+		}
+	}
+	// Rows may have fewer fields than the header, missing ones are treated as empty
+	reader.FieldsPerRecord = -1
+
+	report := &ImportReport{}
+	var chunk []importRow
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, invalid(fmt.Errorf("Failed to read CSV: %w", err))
+			}
+			// The field positions are only known after a successful read
+			line := parseErr.StartLine
+			if line == 0 {
+				line = parseErr.Line
+			}
+			report.fail(line, err)
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+
+		record := make(map[string]string, len(header))
+		for i, column := range header {
+			if i < len(fields) {
+				record[column] = strings.TrimSpace(fields[i])
+			}
+		}
+
+		row, err := parse(record)
+		if err != nil {
+			report.fail(line, err)
+			continue
+		}
+
+		row.line = line
+		chunk = append(chunk, *row)
+		if len(chunk) == importChunkSize {
+			if err := writeImportChunk(ctx, collection, chunk, report); err != nil {
+				return nil, err
+			}
+			chunk = chunk[:0]
+		}
+	}
+
+	if len(chunk) > 0 {
+		if err := writeImportChunk(ctx, collection, chunk, report); err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+// writeImportChunk writes the rows with an unordered BulkWrite, records per-row failures
+// and appends an audit record for every written row
+func writeImportChunk(ctx context.Context, collection *mongo.Collection, chunk []importRow, report *ImportReport) error {
+	models := make([]mongo.WriteModel, len(chunk))
+	var names []string
+	for i, row := range chunk {
+		models[i] = row.model
+		if row.upsertBy != "" {
+			names = append(names, row.upsertBy)
+		}
+	}
+
+	// Products matched by an upsert are updated, keep them for the audit trail
+	existing := map[string]bson.M{}
+	if len(names) > 0 {
+		var documents []bson.M
+		cursor, err := collection.Find(ctx, bson.M{"name": bson.M{"$in": names}})
+		if err != nil {
+			return err
+		}
+		if err := cursor.All(ctx, &documents); err != nil {
+			return err
+		}
+		for _, document := range documents {
+			if name, ok := document["name"].(string); ok {
+				existing[name] = document
+			}
+		}
+	}
+
+	// Upserts changing the price or stock of a product record their domain events
+	events := make([]writeEvents, len(chunk))
+	for i, row := range chunk {
+		if before, ok := existing[row.upsertBy]; ok {
+			id, _ := before["_id"].(primitive.ObjectID)
+			events[i] = writeEvents{domain: productUpdateEvents(id, before, row.document)}
+		}
+	}
+
+	result, err := bulkWriteWithEvents(ctx, collection, models, events)
+	var bulkErr mongo.BulkWriteException
+	if err != nil && !errors.As(err, &bulkErr) {
+		return err
+	}
+
+	failed := map[int]bool{}
+	for _, writeErr := range bulkErr.WriteErrors {
+		message := writeErr.Message
+		if mongo.IsDuplicateKeyError(writeErr) {
+			message = "Duplicate name, SKU or barcode"
+		}
+		failed[writeErr.Index] = true
+		report.fail(chunk[writeErr.Index].line, errors.New(message))
+	}
+
+	var records []audit.Record
+	for i, row := range chunk {
+		if failed[i] {
+			continue
+		}
+		if before, ok := existing[row.upsertBy]; ok {
+			id, _ := before["_id"].(primitive.ObjectID)
+			records = append(records, audit.New(ctx, collection.Name(), id, audit.OperationUpsert, before, audit.ApplySet(before, row.document)))
+		} else {
+			records = append(records, audit.New(ctx, collection.Name(), row.id, audit.OperationCreate, nil, row.document))
+		}
+	}
+	audit.Append(ctx, collection.Database(), records...)
+
+	if result != nil {
+		report.Created += int(result.InsertedCount + result.UpsertedCount)
+		report.Updated += int(result.MatchedCount)
+	}
+	return nil
+}
+
+func (report *ImportReport) fail(line int, err error) {
+	report.Failed++
+	report.Errors = append(report.Errors, ImportError{Row: line, Error: err.Error()})
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// toBsonM converts a model into a document with its bson field names
+func toBsonM(model interface{}) bson.M {
+	document := bson.M{}
+	data, err := bson.Marshal(model)
+	if err == nil {
+		bson.Unmarshal(data, &document)
+	}
+	return document
+}
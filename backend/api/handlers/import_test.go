@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// offlineCollection returns a collection of a client that never connects, so every write fails
+func offlineCollection(t *testing.T) *mongo.Collection {
+	t.Helper()
+	client, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client.Database("test").Collection("products")
+}
+
+func TestImportRowsMalformed(t *testing.T) {
+	source := strings.NewReader("name,price\na\"b,1\nvalid,2\n\"open,3\n")
+	parse := func(record map[string]string) (*importRow, error) {
+		return nil, errors.New("rejected " + record["name"])
+	}
+
+	report, err := importRows(context.Background(), offlineCollection(t), source, []string{"name", "price"}, parse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Failed != 3 || len(report.Errors) != 3 {
+		t.Fatalf("got %d failures %+v, want 3", report.Failed, report.Errors)
+	}
+	wantRows := []int{2, 3, 4}
+	for i, row := range wantRows {
+		if report.Errors[i].Row != row {
+			t.Errorf("error %d is reported for row %d, want %d: %s", i, report.Errors[i].Row, row, report.Errors[i].Error)
+		}
+	}
+	if report.Errors[1].Error != "rejected valid" {
+		t.Errorf("got %q for the valid row, want the parse error", report.Errors[1].Error)
+	}
+}
+
+func TestImportRowsMissingColumn(t *testing.T) {
+	_, err := importRows(context.Background(), offlineCollection(t), strings.NewReader("name\nx\n"), []string{"name", "price"},
+		func(map[string]string) (*importRow, error) { return nil, nil })
+	if !isInvalid(err) || !strings.Contains(err.Error(), `"price"`) {
+		t.Fatalf("got %v, want a missing price column validation error", err)
+	}
+}
+
+func TestImportRowsDatabaseError(t *testing.T) {
+	parse := func(record map[string]string) (*importRow, error) {
+		return &importRow{model: mongo.NewInsertOneModel().SetDocument(bson.M{"name": record["name"]}), document: bson.M{"name": record["name"]}}, nil
+	}
+	_, err := importRows(context.Background(), offlineCollection(t), strings.NewReader("name\nx\n"), []string{"name"}, parse)
+	if err == nil || isInvalid(err) {
+		t.Fatalf("got %v, want a database error that is not a validation error", err)
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// batchLoadFunc fetches the values of all keys at once. Keys without a value are left out of the map.
+type batchLoadFunc func(ctx context.Context, keys []primitive.ObjectID) (map[primitive.ObjectID]interface{}, error)
+
+// loader batches the lookups of a request into a single query per collection and caches the results.
+// Load only queues the key; the queued keys are fetched together when the first returned thunk is called,
+// which graphql-go does after resolving every field of the current level.
+type loader struct {
+	mutex   sync.Mutex
+	fetch   batchLoadFunc
+	pending []primitive.ObjectID
+	values  map[primitive.ObjectID]interface{}
+	errs    map[primitive.ObjectID]error
+}
+
+func newLoader(fetch batchLoadFunc) *loader {
+	return &loader{
+		fetch:  fetch,
+		values: map[primitive.ObjectID]interface{}{},
+		errs:   map[primitive.ObjectID]error{},
+	}
+}
+
+// Load queues the key and returns a thunk resolving to its value, or nil if it does not exist
+func (loader *loader) Load(ctx context.Context, key primitive.ObjectID) func() (interface{}, error) {
+	loader.mutex.Lock()
+	if _, loaded := loader.values[key]; !loaded {
+		loader.pending = append(loader.pending, key)
+	}
+	loader.mutex.Unlock()
+
+	return func() (interface{}, error) {
+		loader.mutex.Lock()
+		defer loader.mutex.Unlock()
+		loader.flush(ctx)
+		return loader.values[key], graphQLError(ctx, loader.errs[key], "reference")
+	}
+}
+
+// flush fetches the pending keys; the caller holds the mutex
+func (loader *loader) flush(ctx context.Context) {
+	if len(loader.pending) == 0 {
+		return
+	}
+	keys := loader.pending
+	loader.pending = nil
+
+	values, err := loader.fetch(ctx, keys)
+	for _, key := range keys {
+		if err != nil {
+			loader.errs[key] = err
+		}
+		loader.values[key] = values[key]
+	}
+}
+
+// documentLoader loads documents of the collection by _id into values of the model type
+func documentLoader[T any](database *mongo.Database, collection string, id func(*T) primitive.ObjectID) *loader {
+	return newLoader(func(ctx context.Context, keys []primitive.ObjectID) (map[primitive.ObjectID]interface{}, error) {
+		var documents []T
+		if err := findByIDs(ctx, database.Collection(collection), keys, &documents); err != nil {
+			return nil, err
+		}
+		values := map[primitive.ObjectID]interface{}{}
+		for i := range documents {
+			values[id(&documents[i])] = &documents[i]
+		}
+		return values, nil
+	})
+}
+
+// customerOrdersLoader loads the orders of customers, grouped by customer
+func customerOrdersLoader(database *mongo.Database) *loader {
+	return newLoader(func(ctx context.Context, keys []primitive.ObjectID) (map[primitive.ObjectID]interface{}, error) {
+		cursor, err := database.Collection(ordersCollection).Find(ctx, bson.M{"customer": bson.M{"$in": keys}})
+		if err != nil {
+			return nil, err
+		}
+		var orders []Order
+		if err := cursor.All(ctx, &orders); err != nil {
+			return nil, err
+		}
+
+		grouped := map[primitive.ObjectID][]*Order{}
+		for i := range orders {
+			grouped[orders[i].Customer] = append(grouped[orders[i].Customer], &orders[i])
+		}
+		values := map[primitive.ObjectID]interface{}{}
+		for _, key := range keys {
+			values[key] = append([]*Order{}, grouped[key]...)
+		}
+		return values, nil
+	})
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/DanVerh/university-swe/backend/api/db"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Time allowed for the business metrics aggregation of a single scrape
+const businessMetricsTimeout = 5 * time.Second
+
+// BusinessCollector exposes order counts by status and delivered revenue as Prometheus gauges.
+// The figures are aggregated from the orders collection on every scrape.
+type BusinessCollector struct {
+	ordersByStatus   *prometheus.Desc
+	revenueByStatus  *prometheus.Desc
+	deliveredRevenue *prometheus.Desc
+}
+
+// NewBusinessCollector creates the collector; register it with prometheus.MustRegister
+func NewBusinessCollector() *BusinessCollector {
+	return &BusinessCollector{
+		ordersByStatus: prometheus.NewDesc("sales_orders", "Number of orders by status.",
+			[]string{"status"}, nil),
+		revenueByStatus: prometheus.NewDesc("sales_orders_value", "Total value of orders by status.",
+			[]string{"status"}, nil),
+		deliveredRevenue: prometheus.NewDesc("sales_delivered_revenue", "Total value of delivered orders.",
+			nil, nil),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (collector *BusinessCollector) Describe(descriptions chan<- *prometheus.Desc) {
+	descriptions <- collector.ordersByStatus
+	descriptions <- collector.revenueByStatus
+	descriptions <- collector.deliveredRevenue
+}
+
+// Collect implements prometheus.Collector. When MongoDB is unavailable or the aggregation fails the error
+// is logged and the gauges are omitted, so the scrape still returns the process metrics.
+func (collector *BusinessCollector) Collect(metrics chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), businessMetricsTimeout)
+	defer cancel()
+
+	database, err := db.Shared()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to connect to MongoDB for business metrics", "error", err)
+		return
+	}
+	collection := database.Client.Database(dbName).Collection(ordersCollection)
+
+	cursor, err := collection.Aggregate(ctx, bson.A{
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$status"},
+			{Key: "orders", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "revenue", Value: bson.D{{Key: "$sum", Value: "$sum"}}},
+		}}},
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to aggregate business metrics", "error", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var groups []salesGroup
+	if err := cursor.All(ctx, &groups); err != nil {
+		slog.ErrorContext(ctx, "Failed to decode business metrics", "error", err)
+		return
+	}
+
+	delivered := 0.0
+	for _, group := range groups {
+		status, _ := group.Key.(string)
+		metrics <- prometheus.MustNewConstMetric(collector.ordersByStatus, prometheus.GaugeValue, float64(group.Orders), status)
+		metrics <- prometheus.MustNewConstMetric(collector.revenueByStatus, prometheus.GaugeValue, group.Revenue, status)
+		if status == "delivered" {
+			delivered = group.Revenue
+		}
+	}
+	metrics <- prometheus.MustNewConstMetric(collector.deliveredRevenue, prometheus.GaugeValue, delivered)
+}
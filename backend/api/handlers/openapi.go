@@ -0,0 +1,551 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/DanVerh/university-swe/backend/api/audit"
+	"github.com/DanVerh/university-swe/backend/api/errorHandling"
+	"github.com/DanVerh/university-swe/backend/api/events"
+	"github.com/DanVerh/university-swe/backend/api/openapi"
+	"github.com/DanVerh/university-swe/backend/api/webhooks"
+)
+
+// Prefix of the version 1 routes
+const apiV1 = "/v1"
+
+// Order statuses accepted by the orders collection validator
+var orderStatuses = []interface{}{"pending", "processing", "shipped", "delivered", "cancelled"}
+
+// OpenAPI describes every route of the API. Schemas are derived from the handler models,
+// so adding a field to Product, Customer or Order updates the document.
+func OpenAPI() *openapi.Document {
+	document := openapi.New(openapi.Info{
+		Title:       "Sales API",
+		Description: "Products, customers, orders and sales reports.",
+		Version:     "1.0.0",
+	})
+	document.Servers = []openapi.Server{{URL: "/", Description: "This server"}}
+	document.Tags = []openapi.Tag{
+		{Name: "products"}, {Name: "categories"}, {Name: "customers"}, {Name: "orders"},
+		{Name: "reports"}, {Name: "audit"}, {Name: "webhooks"}, {Name: "graphql"}, {Name: "operations"},
+	}
+
+	addComponents(document)
+	addProductPaths(document)
+	addCategoryPaths(document)
+	addCustomerPaths(document)
+	addOrderPaths(document)
+	addReportPaths(document)
+	addWebhookPaths(document)
+	addOperationsPaths(document)
+	// The unversioned paths are served until their sunset, see application/versions.go
+	document.DeprecatedAlias(apiV1, "", "Unversioned")
+	return document
+}
+
+// addComponents registers the schemas, shared parameters, error responses and security schemes
+func addComponents(document *openapi.Document) {
+	components := &document.Components
+	product := openapi.SchemaOf(Product{})
+	customer := openapi.SchemaOf(Customer{})
+	order := openapi.SchemaOf(Order{})
+	order.Properties["status"].Enum = orderStatuses
+
+	product.Properties["sku"].Pattern = skuPattern.String()
+	product.Properties["sku"].Description = "Unique across products and variants"
+	product.Properties["barcode"].Pattern = "^[0-9]{12,13}$"
+	product.Properties["barcode"].Description = "EAN-13 or UPC-A code with a valid check digit"
+	components.Schemas["Product"] = product
+	// The SKU of a new product is optional and defaults to P- and the upper case ID
+	productCreate := product.Without("id", "amount", "sku")
+	productCreate.Properties["sku"] = product.Properties["sku"]
+	productCreate.Properties["variants"] = openapi.ArrayOf(openapi.Ref("VariantCreate"))
+	components.Schemas["ProductCreate"] = productCreate
+	components.Schemas["ProductUpdate"] = product.Without("id", "options", "variants").Optional()
+	variant := openapi.SchemaOf(Variant{})
+	variant.Properties["options"].Description = "Value of every option of the product, e.g. {\"size\": \"M\"}"
+	variant.Properties["price"].Description = "Overrides the product price"
+	components.Schemas["Variant"] = variant
+	components.Schemas["VariantCreate"] = variant.Without("id")
+	variantUpdate := variant.Without("id").Optional()
+	variantUpdate.Properties["price"] = &openapi.Schema{Type: "number", Format: "double", Nullable: true, Description: "Null removes the override"}
+	components.Schemas["VariantUpdate"] = variantUpdate
+	components.Schemas["ProductOptions"] = &openapi.Schema{
+		Type:       "object",
+		Required:   []string{"options"},
+		Properties: map[string]*openapi.Schema{"options": openapi.ArrayOf(openapi.SchemaOf(ProductOption{}))},
+	}
+	category := openapi.SchemaOf(Category{})
+	category.Properties["parent"].Description = "Null for a root category"
+	category.Properties["path"].Description = "IDs from the root to the category, e.g. /<root id>/<id>/"
+	category.Properties["position"].Description = "Order among the siblings, from 0"
+	components.Schemas["Category"] = category
+	position := &openapi.Schema{Type: "integer", Format: "int32", Description: "Order among the siblings, default last"}
+	components.Schemas["CategoryCreate"] = &openapi.Schema{
+		Type:       "object",
+		Required:   []string{"name"},
+		Properties: map[string]*openapi.Schema{"name": {Type: "string"}, "parent": openapi.ObjectID(), "position": position},
+	}
+	components.Schemas["CategoryUpdate"] = &openapi.Schema{
+		Type:       "object",
+		Required:   []string{"name"},
+		Properties: map[string]*openapi.Schema{"name": {Type: "string"}},
+	}
+	parent := openapi.ObjectID()
+	parent.Nullable = true
+	parent.Description = "New parent, null for the root. Missing keeps the parent."
+	components.Schemas["CategoryMove"] = &openapi.Schema{
+		Type:       "object",
+		Properties: map[string]*openapi.Schema{"parent": parent, "position": position},
+	}
+	components.Schemas["Customer"] = customer
+	components.Schemas["CustomerCreate"] = customer.Without("id")
+	components.Schemas["CustomerUpdate"] = customer.Without("id").Optional()
+	components.Schemas["Order"] = order
+	components.Schemas["OrderCreate"] = order.Without("id", "sum", "status", "paid", "refunded")
+	components.Schemas["OrderStatusUpdate"] = &openapi.Schema{
+		Type:       "object",
+		Properties: map[string]*openapi.Schema{"status": {Type: "string", Enum: orderStatuses}},
+		Required:   []string{"status"},
+	}
+	components.Schemas["OrderEvent"] = &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"id":   {Type: "string", Description: "Increasing ID to resume after"},
+			"type": {Type: "string", Enum: []interface{}{events.OrderCreated, events.OrderStatusChanged, events.OrderDeleted}},
+			"time": {Type: "string", Format: "date-time"},
+			"data": openapi.Ref("Order"),
+		},
+	}
+	history := openapi.SchemaOf(OrderHistoryEvent{})
+	history.Properties["type"].Enum = []interface{}{orderEventCreated, orderEventLineChanged, orderEventStatusChanged,
+		orderEventPayment, orderEventRefund, orderEventDeleted}
+	components.Schemas["OrderHistoryEvent"] = history
+	components.Schemas["OrderLineChange"] = &openapi.Schema{
+		Type:        "object",
+		Description: "At least one of product, variant and amount",
+		Properties: map[string]*openapi.Schema{"product": openapi.ObjectID(), "variant": openapi.ObjectID(),
+			"amount": {Type: "integer", Format: "int32"}},
+	}
+	components.Schemas["Payment"] = &openapi.Schema{
+		Type:     "object",
+		Required: []string{"value"},
+		Properties: map[string]*openapi.Schema{
+			"value":     {Type: "number", Format: "double"},
+			"method":    {Type: "string", Description: "e.g. card or invoice"},
+			"reference": {Type: "string", Description: "Reference of the payment provider"},
+		},
+	}
+	components.Schemas["Refund"] = &openapi.Schema{
+		Type:       "object",
+		Required:   []string{"value"},
+		Properties: map[string]*openapi.Schema{"value": {Type: "number", Format: "double"}, "reason": {Type: "string"}},
+	}
+	components.Schemas["Problem"] = openapi.SchemaOf(errorHandling.Problem{})
+	components.Schemas["BatchItem"] = &openapi.Schema{
+		Type:        "object",
+		Description: "A create, update or delete. Items without op are documents to create.",
+		Properties: map[string]*openapi.Schema{
+			"op":   {Type: "string", Enum: []interface{}{"create", "update", "delete"}},
+			"id":   openapi.ObjectID(),
+			"data": {Type: "object", Description: "Document to create or fields to update"},
+		},
+	}
+	components.Schemas["BatchResponse"] = &openapi.Schema{
+		Type:       "object",
+		Properties: map[string]*openapi.Schema{"results": openapi.ArrayOf(openapi.SchemaOf(batchResult{}))},
+	}
+	components.Schemas["ImportReport"] = openapi.SchemaOf(ImportReport{})
+	components.Schemas["SalesReport"] = openapi.SchemaOf(salesReport{})
+	components.Schemas["ProductRanking"] = openapi.SchemaOf(productRanking{})
+	components.Schemas["CustomerValue"] = openapi.SchemaOf(customerValue{})
+	components.Schemas["CustomerSegment"] = openapi.SchemaOf(customerSegment{})
+	components.Schemas["AuditRecord"] = openapi.SchemaOf(audit.Record{})
+	webhook := openapi.SchemaOf(webhooks.Subscription{})
+	components.Schemas["Webhook"] = webhook.Without("secret")
+	components.Schemas["WebhookCreated"] = webhook
+	components.Schemas["WebhookCreate"] = webhook.Without("id", "secret", "active", "createdAt")
+	components.Schemas["WebhookUpdate"] = webhook.Without("id", "secret", "createdAt").Optional()
+	delivery := openapi.SchemaOf(webhooks.Delivery{})
+	delivery.Properties["payload"] = openapi.Ref("OrderEvent")
+	delivery.Properties["attempts"].Items.Properties["duration"].Description = "Nanoseconds"
+	components.Schemas["WebhookDelivery"] = delivery
+	components.Schemas["HealthReport"] = openapi.SchemaOf(healthReport{})
+
+	components.Parameters["id"] = openapi.Parameter{Name: "id", In: "path", Required: true, Schema: openapi.ObjectID()}
+	components.Parameters["fields"] = queryParameter("fields", "Comma-separated fields to return, e.g. name,price. An empty list is rejected")
+	components.Parameters["format"] = openapi.Parameter{Name: "format", In: "query",
+		Description: "Export format. The Accept header text/csv or application/x-ndjson works too.",
+		Schema:      &openapi.Schema{Type: "string", Enum: []interface{}{"json", "csv", "ndjson"}}}
+	components.Parameters["from"] = queryParameter("from", "Start of the range, YYYY-MM-DD or RFC 3339")
+	components.Parameters["to"] = queryParameter("to", "End of the range, YYYY-MM-DD (inclusive) or RFC 3339")
+	components.Parameters["tz"] = queryParameter("tz", "IANA timezone of dates and time buckets, default UTC")
+	components.Parameters["status"] = openapi.Parameter{Name: "status", In: "query", Description: "Order status",
+		Schema: &openapi.Schema{Type: "string", Enum: orderStatuses}}
+	components.Parameters["limit"] = openapi.Parameter{Name: "limit", In: "query", Description: "Number of entries, 1-100, default 10",
+		Schema: &openapi.Schema{Type: "integer"}}
+
+	// Handlers answer with plain text errors; authentication, authorization and rate limiting with problem details
+	plainError := map[string]openapi.MediaType{"text/plain": {Schema: &openapi.Schema{Type: "string"}}}
+	problem := map[string]openapi.MediaType{"application/problem+json": {Schema: openapi.Ref("Problem")}}
+	components.Responses["BadRequest"] = openapi.Response{Description: "Invalid request", Content: plainError}
+	components.Responses["NotFound"] = openapi.Response{Description: "Resource not found", Content: plainError}
+	components.Responses["InternalError"] = openapi.Response{Description: "Server or database error", Content: plainError}
+	components.Responses["Unauthorized"] = openapi.Response{Description: "Missing or invalid credentials", Content: problem}
+	components.Responses["Forbidden"] = openapi.Response{Description: "The role does not grant the permission", Content: problem}
+	components.Responses["TooManyRequests"] = openapi.Response{Description: "Rate limit exceeded", Content: problem,
+		Headers: map[string]openapi.Header{"Retry-After": {Description: "Seconds until a request is allowed", Schema: &openapi.Schema{Type: "integer"}}}}
+
+	components.SecuritySchemes["bearerAuth"] = openapi.SecurityScheme{Type: "http", Scheme: "bearer", BearerFormat: "JWT"}
+	components.SecuritySchemes["apiKey"] = openapi.SecurityScheme{Type: "apiKey", Name: "X-API-Key", In: "header"}
+	document.Security = []map[string][]string{{"bearerAuth": {}}, {"apiKey": {}}}
+}
+
+func addProductPaths(document *openapi.Document) {
+	identifierTaken := withContentResponse(http.StatusConflict, "The name, SKU or barcode is already used by another product",
+		"text/plain", &openapi.Schema{Type: "string"})
+	document.Add(http.MethodPost, apiV1+"/products", operation("products", "createProduct", "Create a product",
+		withBody("ProductCreate"), withResponse(http.StatusCreated, "The created product", openapi.Ref("Product")), identifierTaken))
+	document.Add(http.MethodGet, apiV1+"/products", operation("products", "listProducts", "List products",
+		withParameters(queryParameter("name", "Case-insensitive name search"), parameterRef("fields"), parameterRef("format")),
+		withResponse(http.StatusOK, "The products", openapi.ArrayOf(openapi.Ref("Product")))))
+	document.Add(http.MethodPost, apiV1+"/products/import", operation("products", "importProducts", "Import products from CSV",
+		withParameters(queryParameter("upsert", "Update the price of products with the same name instead of failing")),
+		withCSVBody("name,price[,sku][,barcode][,amount]"), withResponse(http.StatusOK, "The import report; 207 if rows failed", openapi.Ref("ImportReport"))))
+	document.Add(http.MethodGet, apiV1+"/products/by-sku/{sku}", operation("products", "getProductBySKU", "Get a product by SKU",
+		withDescription("Finds the product with the SKU or with a variant with the SKU."),
+		withParameters(openapi.Parameter{Name: "sku", In: "path", Required: true, Schema: &openapi.Schema{Type: "string"}}),
+		withResponse(http.StatusOK, "The product", openapi.Ref("Product")), withNotFound()))
+	document.Add(http.MethodGet, apiV1+"/products/by-barcode/{code}", operation("products", "getProductByBarcode", "Get a product by barcode",
+		withDescription("A UPC-A code also finds the product with the same code as EAN-13 with a leading 0, and the other way round."),
+		withParameters(openapi.Parameter{Name: "code", In: "path", Required: true, Schema: &openapi.Schema{Type: "string", Pattern: "^[0-9]{12,13}$"}}),
+		withResponse(http.StatusOK, "The product", openapi.Ref("Product")), withNotFound()))
+	document.Add(http.MethodGet, apiV1+"/products/{id}", operation("products", "getProduct", "Get a product",
+		withParameters(parameterRef("id"), parameterRef("fields")),
+		withResponse(http.StatusOK, "The product", openapi.Ref("Product")), withNotFound()))
+	document.Add(http.MethodPut, apiV1+"/products/{id}", operation("products", "updateProduct", "Update product fields",
+		withDescription("An empty barcode removes the barcode."),
+		withParameters(parameterRef("id")), withBody("ProductUpdate"), withTextResponse(http.StatusOK), withNotFound(), identifierTaken))
+	document.Add(http.MethodDelete, apiV1+"/products/{id}", operation("products", "deleteProduct", "Delete a product",
+		withParameters(parameterRef("id")), withTextResponse(http.StatusOK), withNotFound()))
+	image := &openapi.Schema{Type: "string", Format: "binary"}
+	document.Add(http.MethodGet, apiV1+"/products/{id}/barcode", operation("products", "getProductBarcode", "Get the barcode image of a product",
+		withDescription("Renders the barcode for labels. 404 if the product has no barcode."),
+		withParameters(parameterRef("id"), queryParameter("format", "svg (default) or png"),
+			queryParameter("scale", "Width of a bar module in pixels, 1 to "+strconv.Itoa(maxBarcodeScale)+", default "+strconv.Itoa(defaultBarcodeScale))),
+		func(operation *openapi.Operation) {
+			operation.Responses[statusKey(http.StatusOK)] = openapi.Response{Description: "The barcode image",
+				Content: map[string]openapi.MediaType{"image/svg+xml": {Schema: image}, "image/png": {Schema: image}}}
+		}, withNotFound()))
+	document.Add(http.MethodPut, apiV1+"/products/{id}/options", operation("products", "setProductOptions", "Replace the option axes of a product",
+		withDescription("The existing variants need to fit the new options."),
+		withParameters(parameterRef("id")), withBody("ProductOptions"),
+		withResponse(http.StatusOK, "The product", openapi.Ref("Product")), withNotFound(),
+		withContentResponse(http.StatusConflict, "Existing variants do not fit the options", "text/plain", &openapi.Schema{Type: "string"})))
+	variantID := openapi.Parameter{Name: "variantId", In: "path", Required: true, Schema: openapi.ObjectID()}
+	skuTaken := withContentResponse(http.StatusConflict, "The SKU is already used by another product", "text/plain", &openapi.Schema{Type: "string"})
+	document.Add(http.MethodGet, apiV1+"/products/{id}/variants", operation("products", "listVariants", "List the variants of a product",
+		withParameters(parameterRef("id")), withResponse(http.StatusOK, "The variants", openapi.ArrayOf(openapi.Ref("Variant"))), withNotFound()))
+	document.Add(http.MethodPost, apiV1+"/products/{id}/variants", operation("products", "createVariant", "Add a variant to a product",
+		withParameters(parameterRef("id")), withBody("VariantCreate"),
+		withResponse(http.StatusCreated, "The created variant", openapi.Ref("Variant")), withNotFound(), skuTaken))
+	document.Add(http.MethodPut, apiV1+"/products/{id}/variants/{variantId}", operation("products", "updateVariant", "Update a variant",
+		withParameters(parameterRef("id"), variantID), withBody("VariantUpdate"),
+		withResponse(http.StatusOK, "The variant", openapi.Ref("Variant")), withNotFound(), skuTaken))
+	document.Add(http.MethodDelete, apiV1+"/products/{id}/variants/{variantId}", operation("products", "deleteVariant", "Delete a variant",
+		withDescription("Orders keep referencing the deleted variant."),
+		withParameters(parameterRef("id"), variantID), withTextResponse(http.StatusOK), withNotFound()))
+	document.Add(http.MethodPost, apiV1+"/products:batch", batchOperation("products", "batchProducts"))
+}
+
+func addCategoryPaths(document *openapi.Document) {
+	conflict := withContentResponse(http.StatusConflict, "The change would break the tree or duplicate a sibling name",
+		"text/plain", &openapi.Schema{Type: "string"})
+	document.Add(http.MethodPost, apiV1+"/categories", operation("categories", "createCategory", "Create a category",
+		withBody("CategoryCreate"), withResponse(http.StatusCreated, "The created category", openapi.Ref("Category")), conflict))
+	document.Add(http.MethodGet, apiV1+"/categories", operation("categories", "listCategories", "List categories by parent and position",
+		withParameters(queryParameter("parent", "Only the children of the category, or root for the top level")),
+		withResponse(http.StatusOK, "The categories", openapi.ArrayOf(openapi.Ref("Category")))))
+	document.Add(http.MethodGet, apiV1+"/categories/{id}", operation("categories", "getCategory", "Get a category",
+		withParameters(parameterRef("id")), withResponse(http.StatusOK, "The category", openapi.Ref("Category")), withNotFound()))
+	document.Add(http.MethodPut, apiV1+"/categories/{id}", operation("categories", "renameCategory", "Rename a category",
+		withParameters(parameterRef("id")), withBody("CategoryUpdate"),
+		withResponse(http.StatusOK, "The category", openapi.Ref("Category")), withNotFound(), conflict))
+	document.Add(http.MethodDelete, apiV1+"/categories/{id}", operation("categories", "deleteCategory", "Delete a category without subcategories",
+		withDescription("The category is removed from its products."),
+		withParameters(parameterRef("id")), withTextResponse(http.StatusOK), withNotFound(), conflict))
+	document.Add(http.MethodPost, apiV1+"/categories/{id}/move", operation("categories", "moveCategory", "Move or reorder a category",
+		withDescription("Moves the category with its subcategories below another parent and to a position among its siblings."),
+		withParameters(parameterRef("id")), withBody("CategoryMove"),
+		withResponse(http.StatusOK, "The moved category", openapi.Ref("Category")), withNotFound(), conflict))
+	document.Add(http.MethodGet, apiV1+"/categories/{id}/products", operation("categories", "listCategoryProducts",
+		"List the products of a category and its subcategories",
+		withParameters(parameterRef("id"), parameterRef("fields")),
+		withResponse(http.StatusOK, "The products by name", openapi.ArrayOf(openapi.Ref("Product"))), withNotFound()))
+}
+
+func addCustomerPaths(document *openapi.Document) {
+	document.Add(http.MethodPost, apiV1+"/customers", operation("customers", "createCustomer", "Create a customer",
+		withBody("CustomerCreate"), withResponse(http.StatusCreated, "The created customer", openapi.Ref("Customer"))))
+	document.Add(http.MethodGet, apiV1+"/customers", operation("customers", "listCustomers", "List customers",
+		withParameters(queryParameter("name", "Case-insensitive name search"), parameterRef("fields"), parameterRef("format")),
+		withResponse(http.StatusOK, "The customers", openapi.ArrayOf(openapi.Ref("Customer")))))
+	document.Add(http.MethodPost, apiV1+"/customers/import", operation("customers", "importCustomers", "Import customers from CSV",
+		withCSVBody("name,address"), withResponse(http.StatusOK, "The import report; 207 if rows failed", openapi.Ref("ImportReport"))))
+	document.Add(http.MethodGet, apiV1+"/customers/{id}", operation("customers", "getCustomer", "Get a customer",
+		withParameters(parameterRef("id"), parameterRef("fields")),
+		withResponse(http.StatusOK, "The customer", openapi.Ref("Customer")), withNotFound()))
+	document.Add(http.MethodPut, apiV1+"/customers/{id}", operation("customers", "updateCustomer", "Update customer fields",
+		withParameters(parameterRef("id")), withBody("CustomerUpdate"), withTextResponse(http.StatusOK), withNotFound()))
+	document.Add(http.MethodDelete, apiV1+"/customers/{id}", operation("customers", "deleteCustomer", "Delete a customer",
+		withParameters(parameterRef("id")), withTextResponse(http.StatusOK), withNotFound()))
+	document.Add(http.MethodPost, apiV1+"/customers:batch", batchOperation("customers", "batchCustomers"))
+}
+
+func addOrderPaths(document *openapi.Document) {
+	expand := openapi.Parameter{Name: "expand", In: "query", Description: "Embed the referenced documents: customer, product or both. They are returned even if ?fields= does not list them",
+		Schema: &openapi.Schema{Type: "string"}}
+	document.Add(http.MethodPost, apiV1+"/orders", operation("orders", "createOrder", "Create an order",
+		withDescription("The sum is computed from the price of the product or variant and the status starts as pending. "+
+			"Orders of products with variants need a variant, whose stock is reserved."),
+		withBody("OrderCreate"), withTextResponse(http.StatusCreated), withNotFound(),
+		withContentResponse(http.StatusConflict, "Not enough stock of the variant", "text/plain", &openapi.Schema{Type: "string"})))
+	document.Add(http.MethodGet, apiV1+"/orders", operation("orders", "listOrders", "List orders",
+		withParameters(parameterRef("fields"), expand, parameterRef("format")),
+		withResponse(http.StatusOK, "The orders", openapi.ArrayOf(openapi.Ref("Order")))))
+	document.Add(http.MethodGet, apiV1+"/orders/{id}", operation("orders", "getOrder", "Get an order",
+		withParameters(parameterRef("id"), parameterRef("fields"), expand),
+		withResponse(http.StatusOK, "The order", openapi.Ref("Order")), withNotFound()))
+	document.Add(http.MethodPut, apiV1+"/orders/{id}", operation("orders", "updateOrderStatus", "Update the status of an order",
+		withDescription("Cancelling releases the stock of the variant, leaving cancelled reserves it again."),
+		withParameters(parameterRef("id")), withBody("OrderStatusUpdate"), withTextResponse(http.StatusOK), withNotFound(),
+		withContentResponse(http.StatusConflict, "Not enough stock of the variant", "text/plain", &openapi.Schema{Type: "string"})))
+	document.Add(http.MethodDelete, apiV1+"/orders/{id}", operation("orders", "deleteOrder", "Delete an order",
+		withParameters(parameterRef("id")), withTextResponse(http.StatusOK), withNotFound()))
+	document.Add(http.MethodGet, apiV1+"/orders/{id}/history", operation("orders", "orderHistory", "Event log of an order, oldest first",
+		withDescription("The order is the projection of these events. The log is kept after the order is deleted."),
+		withParameters(parameterRef("id")),
+		withResponse(http.StatusOK, "The events", openapi.ArrayOf(openapi.Ref("OrderHistoryEvent"))), withNotFound()))
+	conflict := withContentResponse(http.StatusConflict, "The state of the order does not allow the change", "text/plain", &openapi.Schema{Type: "string"})
+	document.Add(http.MethodPut, apiV1+"/orders/{id}/line", operation("orders", "changeOrderLine", "Change the product, variant or amount of a pending order",
+		withDescription("The sum is recomputed from the current price and the stock reservation of the variant moves with the line."),
+		withParameters(parameterRef("id")), withBody("OrderLineChange"),
+		withResponse(http.StatusOK, "The changed order", openapi.Ref("Order")), withNotFound(), conflict))
+	document.Add(http.MethodPost, apiV1+"/orders/{id}/payments", operation("orders", "recordOrderPayment", "Record a payment of an order",
+		withParameters(parameterRef("id")), withBody("Payment"),
+		withResponse(http.StatusOK, "The order with the paid total", openapi.Ref("Order")), withNotFound(), conflict))
+	document.Add(http.MethodPost, apiV1+"/orders/{id}/refunds", operation("orders", "refundOrder", "Refund up to the paid amount of an order",
+		withParameters(parameterRef("id")), withBody("Refund"),
+		withResponse(http.StatusOK, "The order with the refunded total", openapi.Ref("Order")), withNotFound(), conflict))
+	document.Add(http.MethodGet, apiV1+"/orders/sum", operation("orders", "sumDeliveredOrders", "Total value of delivered orders",
+		withResponse(http.StatusOK, "The total", &openapi.Schema{Type: "object",
+			Properties: map[string]*openapi.Schema{"totalSum": {Type: "number", Format: "double"}}})))
+	eventFilters := withParameters(queryParameter("customer", "Only events of orders of the customer"), parameterRef("status"),
+		queryParameter("lastEventId", "Resume after the event, like the Last-Event-ID header"))
+	document.Add(http.MethodGet, apiV1+"/orders/events", operation("orders", "orderEvents", "Stream order changes as Server-Sent Events",
+		withDescription("Sends order.created, order.status_changed and order.deleted events. "+
+			"Reconnecting clients resume after the Last-Event-ID header."),
+		eventFilters, withContentResponse(http.StatusOK, "Event stream, the data of each event is an OrderEvent",
+			"text/event-stream", &openapi.Schema{Type: "string"})))
+	document.Add(http.MethodGet, apiV1+"/orders/events/ws", operation("orders", "orderEventsWebSocket", "Stream order changes over a WebSocket",
+		withDescription("After the upgrade every message is an OrderEvent in JSON. For server-to-server clients, "+
+			"as the credentials are only read from headers; browsers use the Server-Sent Events stream."),
+		eventFilters, withResponse(http.StatusSwitchingProtocols, "WebSocket upgrade", openapi.Ref("OrderEvent"))))
+	document.Add(http.MethodPost, apiV1+"/orders:batch", batchOperation("orders", "batchOrders"))
+}
+
+func addReportPaths(document *openapi.Document) {
+	groupBy := openapi.Parameter{Name: "groupBy", In: "query", Schema: &openapi.Schema{Type: "string",
+		Enum: []interface{}{"status", "product", "customer", "day", "week", "month"}}}
+	document.Add(http.MethodGet, apiV1+"/reports/sales", operation("reports", "salesReport", "Sales totals by group",
+		withParameters(groupBy, parameterRef("from"), parameterRef("to"), parameterRef("tz"), parameterRef("status")),
+		withDescription("Without status every order except cancelled ones is counted."),
+		withResponse(http.StatusOK, "The report", openapi.Ref("SalesReport"))))
+
+	ranking := []openapi.Parameter{parameterRef("limit"), parameterRef("status"), parameterRef("from"), parameterRef("to"), parameterRef("tz")}
+	document.Add(http.MethodGet, apiV1+"/reports/top-products", operation("reports", "topProducts", "Best selling products",
+		withParameters(append([]openapi.Parameter{{Name: "by", In: "query",
+			Schema: &openapi.Schema{Type: "string", Enum: []interface{}{"revenue", "units"}}}}, ranking...)...),
+		withResponse(http.StatusOK, "The ranking", openapi.ArrayOf(openapi.Ref("ProductRanking")))))
+	document.Add(http.MethodGet, apiV1+"/reports/top-customers", operation("reports", "topCustomers", "Most valuable customers",
+		withParameters(append([]openapi.Parameter{{Name: "by", In: "query",
+			Schema: &openapi.Schema{Type: "string", Enum: []interface{}{"value", "orders"}}}}, ranking...)...),
+		withResponse(http.StatusOK, "The ranking", openapi.ArrayOf(openapi.Ref("CustomerValue")))))
+	document.Add(http.MethodGet, apiV1+"/reports/customers/rfm", operation("reports", "customerSegments", "RFM scores and segments of customers",
+		withParameters(queryParameter("segment", "Only return customers of the segment, e.g. champions"),
+			parameterRef("status"), parameterRef("from"), parameterRef("to"), parameterRef("tz")),
+		withResponse(http.StatusOK, "The customers", openapi.ArrayOf(openapi.Ref("CustomerSegment")))))
+}
+
+func addWebhookPaths(document *openapi.Document) {
+	document.Add(http.MethodPost, apiV1+"/webhooks", operation("webhooks", "createWebhook", "Subscribe a URL to order events",
+		withDescription("Deliveries are POSTed with the "+webhooks.HeaderSignature+" header, the HMAC-SHA256 of "+
+			"\"<"+webhooks.HeaderTimestamp+">.<body>\" keyed with the secret. The secret is only returned here."),
+		withBody("WebhookCreate"), withResponse(http.StatusCreated, "The webhook and its secret", openapi.Ref("WebhookCreated"))))
+	document.Add(http.MethodGet, apiV1+"/webhooks", operation("webhooks", "listWebhooks", "List webhooks",
+		withResponse(http.StatusOK, "The webhooks", openapi.ArrayOf(openapi.Ref("Webhook")))))
+	document.Add(http.MethodGet, apiV1+"/webhooks/{id}", operation("webhooks", "getWebhook", "Get a webhook",
+		withParameters(parameterRef("id")), withResponse(http.StatusOK, "The webhook", openapi.Ref("Webhook")), withNotFound()))
+	document.Add(http.MethodPut, apiV1+"/webhooks/{id}", operation("webhooks", "updateWebhook", "Update or pause a webhook",
+		withParameters(parameterRef("id")), withBody("WebhookUpdate"),
+		withResponse(http.StatusOK, "The webhook", openapi.Ref("Webhook")), withNotFound()))
+	document.Add(http.MethodDelete, apiV1+"/webhooks/{id}", operation("webhooks", "deleteWebhook", "Delete a webhook",
+		withParameters(parameterRef("id")), withTextResponse(http.StatusOK), withNotFound()))
+	document.Add(http.MethodGet, apiV1+"/webhooks/{id}/deliveries", operation("webhooks", "listWebhookDeliveries", "Delivery log of a webhook, newest first",
+		withParameters(parameterRef("id"), openapi.Parameter{Name: "status", In: "query", Schema: &openapi.Schema{Type: "string",
+			Enum: []interface{}{webhooks.StatusPending, webhooks.StatusDelivered, webhooks.StatusDead}}},
+			openapi.Parameter{Name: "limit", In: "query", Description: "1-500, default 50", Schema: &openapi.Schema{Type: "integer"}}),
+		withResponse(http.StatusOK, "The deliveries", openapi.ArrayOf(openapi.Ref("WebhookDelivery")))))
+	deliveryID := openapi.Parameter{Name: "deliveryId", In: "path", Required: true, Schema: openapi.ObjectID()}
+	document.Add(http.MethodPost, apiV1+"/webhooks/{id}/deliveries/{deliveryId}/redeliver", operation("webhooks", "redeliverWebhook",
+		"Queue a delivered or dead-lettered delivery again",
+		withParameters(parameterRef("id"), deliveryID), withTextResponse(http.StatusAccepted), withNotFound()))
+}
+
+func addOperationsPaths(document *openapi.Document) {
+	document.Add(http.MethodGet, apiV1+"/audit", operation("audit", "listAuditRecords", "Audit trail of data changes, newest first",
+		withParameters(queryParameter("resource", "Collection, e.g. products"), queryParameter("id", "Id of the changed document"),
+			queryParameter("actor", "Subject of the principal"), parameterRef("from"), parameterRef("to"), parameterRef("tz"),
+			openapi.Parameter{Name: "limit", In: "query", Description: "1-1000, default 100", Schema: &openapi.Schema{Type: "integer"}}),
+		withResponse(http.StatusOK, "The records", openapi.ArrayOf(openapi.Ref("AuditRecord")))))
+
+	document.Add(http.MethodPost, "/graphql", operation("graphql", "graphql", "GraphQL queries and mutations over products, customers and orders",
+		withDescription("Fields require the same permissions as the REST routes. Queries are limited in depth and complexity."),
+		func(operation *openapi.Operation) {
+			operation.RequestBody = &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{
+				"application/json": {Schema: &openapi.Schema{Type: "object", Required: []string{"query"}, Properties: map[string]*openapi.Schema{
+					"query":         {Type: "string"},
+					"operationName": {Type: "string"},
+					"variables":     {Type: "object"},
+				}}},
+			}}
+		},
+		withResponse(http.StatusOK, "GraphQL result with data and errors", &openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{
+			"data":   {Type: "object"},
+			"errors": openapi.ArrayOf(&openapi.Schema{Type: "object"}),
+		}})))
+
+	health := []func(*openapi.Operation){public(), withResponse(http.StatusOK, "The process is alive", openapi.Ref("HealthReport"))}
+	document.Add(http.MethodGet, "/health", operation("operations", "health", "Liveness probe, same as /livez", health...))
+	document.Add(http.MethodGet, "/livez", operation("operations", "livez", "Liveness probe", health...))
+	document.Add(http.MethodGet, "/readyz", operation("operations", "readyz", "Readiness probe checking MongoDB and migrations",
+		public(), withResponse(http.StatusOK, "Ready; 503 with the failed checks otherwise", openapi.Ref("HealthReport"))))
+	document.Add(http.MethodGet, "/metrics", operation("operations", "metrics", "Prometheus metrics",
+		public(), withContentResponse(http.StatusOK, "Metrics in the Prometheus text format", "text/plain", &openapi.Schema{Type: "string"})))
+	document.Add(http.MethodGet, "/openapi.json", operation("operations", "openapi", "This document",
+		public(), withResponse(http.StatusOK, "The OpenAPI document", &openapi.Schema{Type: "object"})))
+	document.Add(http.MethodGet, "/docs", operation("operations", "docs", "Interactive API documentation",
+		public(), withContentResponse(http.StatusOK, "Swagger UI page", "text/html", &openapi.Schema{Type: "string"})))
+}
+
+// operation creates an authenticated operation with the common error responses
+func operation(tag, id, summary string, options ...func(*openapi.Operation)) *openapi.Operation {
+	operation := &openapi.Operation{
+		Tags:        []string{tag},
+		Summary:     summary,
+		OperationID: id,
+		Responses: map[string]openapi.Response{
+			"400": responseRef("BadRequest"),
+			"401": responseRef("Unauthorized"),
+			"403": responseRef("Forbidden"),
+			"429": responseRef("TooManyRequests"),
+			"500": responseRef("InternalError"),
+		},
+	}
+	for _, option := range options {
+		option(operation)
+	}
+	return operation
+}
+
+// batchOperation documents POST /<resource>:batch
+func batchOperation(resource, id string) *openapi.Operation {
+	mode := openapi.Parameter{Name: "mode", In: "query", Description: "atomic applies all items in one transaction or none",
+		Schema: &openapi.Schema{Type: "string", Enum: []interface{}{"best-effort", "atomic"}}}
+	items := openapi.ArrayOf(openapi.Ref("BatchItem"))
+	return operation(resource, id, "Create, update and delete "+resource+" in bulk",
+		withParameters(mode),
+		func(operation *openapi.Operation) {
+			operation.RequestBody = &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{
+				"application/json":     {Schema: items},
+				"application/x-ndjson": {Schema: openapi.Ref("BatchItem")},
+			}}
+		},
+		withResponse(http.StatusOK, "Result per item; 207 if any item failed", openapi.Ref("BatchResponse")))
+}
+
+func withDescription(description string) func(*openapi.Operation) {
+	return func(operation *openapi.Operation) {
+		operation.Description = description
+	}
+}
+
+func withParameters(parameters ...openapi.Parameter) func(*openapi.Operation) {
+	return func(operation *openapi.Operation) {
+		operation.Parameters = append(operation.Parameters, parameters...)
+	}
+}
+
+func withBody(schema string) func(*openapi.Operation) {
+	return func(operation *openapi.Operation) {
+		operation.RequestBody = &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{
+			"application/json": {Schema: openapi.Ref(schema)},
+		}}
+	}
+}
+
+func withCSVBody(header string) func(*openapi.Operation) {
+	return func(operation *openapi.Operation) {
+		operation.RequestBody = &openapi.RequestBody{Required: true, Description: "CSV with the header " + header,
+			Content: map[string]openapi.MediaType{"text/csv": {Schema: &openapi.Schema{Type: "string"}}}}
+	}
+}
+
+func withResponse(status int, description string, schema *openapi.Schema) func(*openapi.Operation) {
+	return withContentResponse(status, description, "application/json", schema)
+}
+
+func withContentResponse(status int, description, mediaType string, schema *openapi.Schema) func(*openapi.Operation) {
+	return func(operation *openapi.Operation) {
+		operation.Responses[statusKey(status)] = openapi.Response{Description: description,
+			Content: map[string]openapi.MediaType{mediaType: {Schema: schema}}}
+	}
+}
+
+// withTextResponse documents the plain text confirmation of updates, deletes and order creation
+func withTextResponse(status int) func(*openapi.Operation) {
+	return withContentResponse(status, "Confirmation message", "text/plain", &openapi.Schema{Type: "string"})
+}
+
+func withNotFound() func(*openapi.Operation) {
+	return func(operation *openapi.Operation) {
+		operation.Responses["404"] = responseRef("NotFound")
+	}
+}
+
+// public marks an operation that needs no credentials and is not rate limited
+func public() func(*openapi.Operation) {
+	return func(operation *openapi.Operation) {
+		operation.Security = &[]map[string][]string{}
+		for _, status := range []string{"400", "401", "403", "429", "500"} {
+			delete(operation.Responses, status)
+		}
+	}
+}
+
+func queryParameter(name, description string) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Description: description, Schema: &openapi.Schema{Type: "string"}}
+}
+
+func parameterRef(name string) openapi.Parameter {
+	return openapi.Parameter{Ref: "#/components/parameters/" + name}
+}
+
+func responseRef(name string) openapi.Response {
+	return openapi.Response{Ref: "#/components/responses/" + name}
+}
+
+func statusKey(status int) string {
+	return strconv.Itoa(status)
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/DanVerh/university-swe/backend/api/audit"
+	"github.com/DanVerh/university-swe/backend/api/errorHandling"
+	"github.com/DanVerh/university-swe/backend/api/events"
+	"github.com/DanVerh/university-swe/backend/api/webhooks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/net/websocket"
+)
+
+// Interval of the SSE comments that keep idle connections open through proxies
+const eventsHeartbeat = 15 * time.Second
+
+// Events handles GET requests for a Server-Sent Events stream of order changes.
+// Query parameters: customer and status filter the events; a reconnecting client
+// resumes after the Last-Event-ID header or the lastEventId parameter.
+func (ordersHandler *OrdersHandler) Events(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		errorHandling.ThrowError(r.Context(), w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be GET", nil)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Streaming is not supported", nil)
+		return
+	}
+
+	filter, after, err := parseOrderEventsQuery(r)
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	subscription, missed := events.Subscribe(filter, after)
+	defer subscription.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Stop nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+	for _, event := range missed {
+		writeServerSentEvent(r.Context(), w, event)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case event, ok := <-subscription.Events():
+			if !ok {
+				// Dropped as too slow, the client reconnects with Last-Event-ID
+				return
+			}
+			writeServerSentEvent(r.Context(), w, event)
+		}
+		flusher.Flush()
+	}
+}
+
+// EventsWebSocket handles GET requests upgrading to a WebSocket that receives order changes as JSON messages.
+// It takes the query parameters of Events and resumes after the lastEventId parameter.
+// It is meant for server-to-server clients: the credentials are only read from the Authorization
+// and X-API-Key headers, which browsers cannot set on a WebSocket.
+func (ordersHandler *OrdersHandler) EventsWebSocket(w http.ResponseWriter, r *http.Request) {
+	filter, after, err := parseOrderEventsQuery(r)
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	// The Origin is not checked, as browsers cannot send the credentials the route requires
+	server := websocket.Server{Handler: func(conn *websocket.Conn) {
+		defer conn.Close()
+		streamWebSocketEvents(r.Context(), conn, filter, after)
+	}}
+	server.ServeHTTP(w, r)
+}
+
+// streamWebSocketEvents sends the events until the client disconnects
+func streamWebSocketEvents(ctx context.Context, conn *websocket.Conn, filter events.Filter, after uint64) {
+	subscription, missed := events.Subscribe(filter, after)
+	defer subscription.Close()
+
+	// Incoming messages are ignored; reading detects when the client goes away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		var message string
+		for websocket.Message.Receive(conn, &message) == nil {
+		}
+	}()
+
+	for _, event := range missed {
+		if err := websocket.JSON.Send(conn, event); err != nil {
+			return
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-closed:
+			return
+		case event, ok := <-subscription.Events():
+			if !ok {
+				return
+			}
+			if err := websocket.JSON.Send(conn, event); err != nil {
+				slog.DebugContext(ctx, "Failed to send order event", "error", err)
+				return
+			}
+		}
+	}
+}
+
+// parseOrderEventsQuery reads the customer and status filters and the ID to resume after
+func parseOrderEventsQuery(r *http.Request) (events.Filter, uint64, error) {
+	filter := events.Filter{Attributes: map[string]string{}}
+	query := r.URL.Query()
+
+	if customer := query.Get("customer"); customer != "" {
+		if _, err := primitive.ObjectIDFromHex(customer); err != nil {
+			return filter, 0, fmt.Errorf("Invalid customer. Needs to be an ObjectId")
+		}
+		filter.Attributes["customer"] = customer
+	}
+	if status := query.Get("status"); status != "" {
+		if !validOrderStatus(status) {
+			return filter, 0, fmt.Errorf("Invalid status %q", status)
+		}
+		filter.Attributes["status"] = status
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = query.Get("lastEventId")
+	}
+	var after uint64
+	if lastEventID != "" {
+		parsed, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			return filter, 0, fmt.Errorf("Invalid Last-Event-ID")
+		}
+		after = parsed
+	}
+	return filter, after, nil
+}
+
+// writeServerSentEvent writes the event in the text/event-stream format
+func writeServerSentEvent(ctx context.Context, w http.ResponseWriter, event events.Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to encode order event", "error", err)
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+}
+
+// publishOrderEvent publishes a change of the order, given as *Order or as the stored document,
+// to the event streams and queues it for the webhook subscriptions
+func publishOrderEvent(ctx context.Context, database *mongo.Database, eventType string, document interface{}) {
+	order, ok := document.(*Order)
+	if !ok {
+		order = &Order{}
+		raw, err := bson.Marshal(document)
+		if err == nil {
+			err = bson.Unmarshal(raw, order)
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to decode order for its event", "type", eventType, "error", err)
+			return
+		}
+	}
+
+	event := events.Publish(events.Event{
+		Type: eventType,
+		Data: order,
+		Attributes: map[string]string{
+			"customer": order.Customer.Hex(),
+			"status":   order.Status,
+		},
+	})
+	webhooks.Enqueue(ctx, database, event)
+}
+
+// publishBatchOrderEvent publishes the change of an order written by a batch
+func publishBatchOrderEvent(ctx context.Context, database *mongo.Database, op batchOp, before bson.M) {
+	switch op.op {
+	case "create":
+		publishOrderEvent(ctx, database, events.OrderCreated, op.document)
+	case "delete":
+		publishOrderEvent(ctx, database, events.OrderDeleted, before)
+	case "update":
+		after := audit.ApplySet(before, op.set)
+		if before["status"] != after["status"] {
+			publishOrderEvent(ctx, database, events.OrderStatusChanged, after)
+		}
+	}
+}
+
+// validOrderStatus reports whether the status is accepted by the orders collection validator
+func validOrderStatus(status string) bool {
+	for _, valid := range orderStatuses {
+		if valid == status {
+			return true
+		}
+	}
+	return false
+}
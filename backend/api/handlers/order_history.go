@@ -0,0 +1,566 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/DanVerh/university-swe/backend/api/audit"
+	"github.com/DanVerh/university-swe/backend/api/auth"
+	"github.com/DanVerh/university-swe/backend/api/db"
+	"github.com/DanVerh/university-swe/backend/api/errorHandling"
+	"github.com/DanVerh/university-swe/backend/api/logging"
+	"github.com/DanVerh/university-swe/backend/api/outbox"
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Mongo collection name for the order event log. Events are only ever inserted;
+// the orders collection is the read model projected from them.
+const orderEventsCollection = "orderEvents"
+
+// Types of order events
+const (
+	orderEventCreated       = "created"
+	orderEventLineChanged   = "line_changed"
+	orderEventStatusChanged = "status_changed"
+	orderEventPayment       = "payment_recorded"
+	orderEventRefund        = "refunded"
+	orderEventDeleted       = "deleted"
+)
+
+// Actor of events written outside of an authenticated request
+const systemActor = "system"
+
+// Number of rebuilt orders written with a single BulkWrite
+const rebuildChunkSize = 500
+
+// Errors of order changes that the state of the order does not allow
+var (
+	errOrderNotPending = errors.New("Only pending orders can be changed")
+	errOrderCancelled  = errors.New("Cancelled orders cannot be paid")
+	errRefundTooHigh   = errors.New("Refund exceeds the paid amount")
+)
+
+// errUnchanged is returned by an order change that has nothing to record
+var errUnchanged = errors.New("unchanged")
+
+// OrderHistoryEvent is an entry of the event log of an order
+type OrderHistoryEvent struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id"`
+	Order      primitive.ObjectID `json:"order" bson:"order"`
+	Version    int64              `json:"version" bson:"version"`
+	Type       string             `json:"type" bson:"type"`
+	Data       orderEventData     `json:"data" bson:"data"`
+	OccurredAt time.Time          `json:"occurredAt" bson:"occurredAt"`
+	Actor      string             `json:"actor" bson:"actor"`
+	RequestID  string             `json:"requestId,omitempty" bson:"requestId,omitempty"`
+}
+
+// orderEventData holds the fields of every event type, each type sets its own:
+// created the whole order, line_changed product, variant, amount and sum, status_changed status and previousStatus,
+// payment_recorded value, method and reference, and refunded value and reason
+type orderEventData struct {
+	Customer       *primitive.ObjectID `json:"customer,omitempty" bson:"customer,omitempty"`
+	Product        *primitive.ObjectID `json:"product,omitempty" bson:"product,omitempty"`
+	Variant        *primitive.ObjectID `json:"variant,omitempty" bson:"variant,omitempty"`
+	Amount         int32               `json:"amount,omitempty" bson:"amount,omitempty"`
+	Sum            *float64            `json:"sum,omitempty" bson:"sum,omitempty"`
+	Status         string              `json:"status,omitempty" bson:"status,omitempty"`
+	PreviousStatus string              `json:"previousStatus,omitempty" bson:"previousStatus,omitempty"`
+	Value          float64             `json:"value,omitempty" bson:"value,omitempty"`
+	Method         string              `json:"method,omitempty" bson:"method,omitempty"`
+	Reference      string              `json:"reference,omitempty" bson:"reference,omitempty"`
+	Reason         string              `json:"reason,omitempty" bson:"reason,omitempty"`
+}
+
+// RebuildReport summarizes a rebuild of the orders collection
+type RebuildReport struct {
+	Events  int `json:"events"`
+	Orders  int `json:"orders"`
+	Deleted int `json:"deleted"`
+	// Orders without any event, removed from the read model
+	Removed int `json:"removed"`
+}
+
+// History handles GET requests for the event log of an order, oldest first.
+// The log is kept after the order is deleted.
+func (ordersHandler *OrdersHandler) History(w http.ResponseWriter, r *http.Request) {
+	objectID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid ObjectId format", nil)
+		return
+	}
+
+	db := db.DbConnect()
+	defer db.DbDisconnect()
+
+	history, err := orderHistory(r.Context(), db.Client.Database(dbName), objectID)
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to retrieve order history", err)
+		return
+	}
+	if len(history) == 0 {
+		errorHandling.ThrowError(r.Context(), w, http.StatusNotFound, "No order found with the given ID", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(history)
+}
+
+// ChangeLine handles PUT requests to change the product, variant or amount of a pending order.
+// The sum is recomputed from the current price and the stock reservation moves with the line.
+func (ordersHandler *OrdersHandler) ChangeLine(w http.ResponseWriter, r *http.Request) {
+	var line struct {
+		Product *primitive.ObjectID `json:"product"`
+		Variant *primitive.ObjectID `json:"variant"`
+		Amount  *int32              `json:"amount"`
+	}
+	ordersHandler.change(w, r, &line, func(ctx context.Context, database *mongo.Database, id primitive.ObjectID) (*Order, error) {
+		return changeOrderLine(ctx, database, id, line.Product, line.Variant, line.Amount)
+	})
+}
+
+// RecordPayment handles POST requests to record a payment of an order
+func (ordersHandler *OrdersHandler) RecordPayment(w http.ResponseWriter, r *http.Request) {
+	var payment struct {
+		Value     float64 `json:"value"`
+		Method    string  `json:"method"`
+		Reference string  `json:"reference"`
+	}
+	ordersHandler.change(w, r, &payment, func(ctx context.Context, database *mongo.Database, id primitive.ObjectID) (*Order, error) {
+		return recordOrderPayment(ctx, database, id, payment.Value, payment.Method, payment.Reference)
+	})
+}
+
+// Refund handles POST requests to refund up to the paid amount of an order
+func (ordersHandler *OrdersHandler) Refund(w http.ResponseWriter, r *http.Request) {
+	var refund struct {
+		Value  float64 `json:"value"`
+		Reason string  `json:"reason"`
+	}
+	ordersHandler.change(w, r, &refund, func(ctx context.Context, database *mongo.Database, id primitive.ObjectID) (*Order, error) {
+		return refundOrder(ctx, database, id, refund.Value, refund.Reason)
+	})
+}
+
+// change decodes the body of an order change, applies it and responds with the changed order
+func (ordersHandler *OrdersHandler) change(w http.ResponseWriter, r *http.Request, body interface{}, apply func(context.Context, *mongo.Database, primitive.ObjectID) (*Order, error)) {
+	objectID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid ObjectId format", nil)
+		return
+	}
+	if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid request body", nil)
+		return
+	}
+
+	db := db.DbConnect()
+	defer db.DbDisconnect()
+
+	order, err := apply(r.Context(), db.Client.Database(dbName), objectID)
+	switch {
+	case isInvalid(err):
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, err.Error(), nil)
+		return
+	case err == errOrderNotPending || err == errOrderCancelled || err == errRefundTooHigh || err == errOutOfStock:
+		errorHandling.ThrowError(r.Context(), w, http.StatusConflict, err.Error(), nil)
+		return
+	case err == mongo.ErrNoDocuments:
+		errorHandling.ThrowError(r.Context(), w, http.StatusNotFound, "No order found with the given ID", nil)
+		return
+	case err == errProductNotFound || err == errVariantNotFound:
+		errorHandling.ThrowError(r.Context(), w, http.StatusNotFound, err.Error(), nil)
+		return
+	case err != nil:
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to change order", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(order)
+}
+
+// changeOrderLine changes the product, variant and amount of a pending order, reprices it
+// and moves its stock reservation. A new product without a variant clears the variant.
+func changeOrderLine(ctx context.Context, database *mongo.Database, id primitive.ObjectID, productID, variantID *primitive.ObjectID, amount *int32) (*Order, error) {
+	if productID == nil && variantID == nil && amount == nil {
+		return nil, invalid(errors.New("Missing fields: product, variant or amount"))
+	}
+	if amount != nil && *amount < 1 {
+		return nil, invalid(errors.New("Amount needs to be at least 1"))
+	}
+
+	var product Product
+	before, after, err := changeOrder(ctx, database, id, orderEventLineChanged, func(ctx context.Context, order *Order) (orderEventData, []outbox.Event, error) {
+		if order.Status != "pending" {
+			return orderEventData{}, nil, errOrderNotPending
+		}
+		line := orderEventData{Product: &order.Product, Variant: order.Variant, Amount: order.Amount}
+		if productID != nil && *productID != order.Product {
+			line.Product, line.Variant = productID, nil
+		}
+		if variantID != nil {
+			line.Variant = variantID
+		}
+		if amount != nil {
+			line.Amount = *amount
+		}
+		err := database.Collection("products").FindOne(ctx, bson.M{"_id": *line.Product}).Decode(&product)
+		if err == mongo.ErrNoDocuments {
+			return orderEventData{}, nil, errProductNotFound
+		}
+		if err != nil {
+			return orderEventData{}, nil, err
+		}
+		variant, err := orderVariant(&product, line.Variant)
+		if err != nil {
+			return orderEventData{}, nil, err
+		}
+		sum := unitPrice(&product, variant) * float64(line.Amount)
+		line.Sum = &sum
+
+		next := *order
+		next.Product, next.Variant, next.Amount = *line.Product, line.Variant, line.Amount
+		stockEvents, err := reserveOrderStock(ctx, database, order, &next)
+		if err != nil {
+			return orderEventData{}, nil, err
+		}
+		return line, stockEvents, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	audit.Write(ctx, database, ordersCollection, id, audit.OperationUpdate, before, after)
+	return after, nil
+}
+
+// recordOrderPayment adds a payment to the paid total of an order that is not cancelled
+func recordOrderPayment(ctx context.Context, database *mongo.Database, id primitive.ObjectID, value float64, method, reference string) (*Order, error) {
+	if value <= 0 || math.IsInf(value, 0) {
+		return nil, invalid(errors.New("Value needs to be positive"))
+	}
+	before, after, err := changeOrder(ctx, database, id, orderEventPayment, func(ctx context.Context, order *Order) (orderEventData, []outbox.Event, error) {
+		if order.Status == "cancelled" {
+			return orderEventData{}, nil, errOrderCancelled
+		}
+		return orderEventData{Value: value, Method: method, Reference: reference}, nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	audit.Write(ctx, database, ordersCollection, id, audit.OperationUpdate, before, after)
+	return after, nil
+}
+
+// refundOrder adds a refund of up to the paid and not yet refunded amount of an order
+func refundOrder(ctx context.Context, database *mongo.Database, id primitive.ObjectID, value float64, reason string) (*Order, error) {
+	if value <= 0 || math.IsInf(value, 0) {
+		return nil, invalid(errors.New("Value needs to be positive"))
+	}
+	before, after, err := changeOrder(ctx, database, id, orderEventRefund, func(ctx context.Context, order *Order) (orderEventData, []outbox.Event, error) {
+		if value > order.Paid-order.Refunded {
+			return orderEventData{}, nil, errRefundTooHigh
+		}
+		return orderEventData{Value: value, Reason: reason}, nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	audit.Write(ctx, database, ordersCollection, id, audit.OperationUpdate, before, after)
+	return after, nil
+}
+
+// changeOrder appends an event to the log of the order and projects it onto the read model,
+// in one transaction with the domain events for the outbox. decide gets the current order,
+// nil for created events, and returns the event data or errUnchanged to record nothing.
+// It returns the order before and after the event: before is nil for created events and after
+// is nil for deleted ones. It returns mongo.ErrNoDocuments if the order does not exist.
+func changeOrder(ctx context.Context, database *mongo.Database, id primitive.ObjectID, eventType string,
+	decide func(ctx context.Context, order *Order) (orderEventData, []outbox.Event, error)) (*Order, *Order, error) {
+	var before, after *Order
+	err := outbox.Transact(ctx, database.Client(), func(sessionCtx mongo.SessionContext) error {
+		collection := database.Collection(ordersCollection)
+		before, after = nil, nil
+		if eventType != orderEventCreated {
+			var current Order
+			if err := collection.FindOne(sessionCtx, bson.M{"_id": id}).Decode(&current); err != nil {
+				return err
+			}
+			before = &current
+		}
+
+		data, domainEvents, err := decide(sessionCtx, before)
+		if err == errUnchanged {
+			after = before
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		event, err := appendOrderEvent(sessionCtx, database, id, eventType, data)
+		if err != nil {
+			return err
+		}
+		after = applyOrderEvent(before, event)
+		switch {
+		case before == nil:
+			_, err = collection.InsertOne(sessionCtx, after)
+		case after == nil:
+			_, err = collection.DeleteOne(sessionCtx, bson.M{"_id": id})
+		default:
+			_, err = collection.ReplaceOne(sessionCtx, bson.M{"_id": id}, after)
+		}
+		if err != nil {
+			return err
+		}
+		return outbox.Add(sessionCtx, database, domainEvents...)
+	})
+	return before, after, err
+}
+
+// appendOrderEvent inserts the event with the next version of the order. It is called inside
+// the transaction that writes the read model, whose write conflicts order concurrent changes.
+func appendOrderEvent(ctx context.Context, database *mongo.Database, order primitive.ObjectID, eventType string, data orderEventData) (OrderHistoryEvent, error) {
+	events, err := appendOrderEvents(ctx, database, []orderLogEntry{{order: order, eventType: eventType, data: data}})
+	if err != nil {
+		return OrderHistoryEvent{}, err
+	}
+	return events[0], nil
+}
+
+// appendOrderEvents inserts the events with the next versions of their orders, numbering several
+// events of one order in their order. It reads the last versions with one query and inserts with one write.
+func appendOrderEvents(ctx context.Context, database *mongo.Database, entries []orderLogEntry) ([]OrderHistoryEvent, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	collection := database.Collection(orderEventsCollection)
+
+	versions := map[primitive.ObjectID]int64{}
+	var orders []primitive.ObjectID
+	for _, entry := range entries {
+		if _, ok := versions[entry.order]; !ok {
+			versions[entry.order] = 0
+			orders = append(orders, entry.order)
+		}
+	}
+	cursor, err := collection.Aggregate(ctx, bson.A{
+		bson.M{"$match": bson.M{"order": bson.M{"$in": orders}}},
+		bson.M{"$group": bson.M{"_id": "$order", "version": bson.M{"$max": "$version"}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var last []struct {
+		Order   primitive.ObjectID `bson:"_id"`
+		Version int64              `bson:"version"`
+	}
+	if err := cursor.All(ctx, &last); err != nil {
+		return nil, err
+	}
+	for _, order := range last {
+		versions[order.Order] = order.Version
+	}
+
+	events := make([]OrderHistoryEvent, len(entries))
+	documents := make([]interface{}, len(entries))
+	for i, entry := range entries {
+		versions[entry.order]++
+		events[i] = newOrderEvent(ctx, entry.order, versions[entry.order], entry.eventType, entry.data)
+		documents[i] = events[i]
+	}
+	if _, err := collection.InsertMany(ctx, documents); err != nil {
+		return nil, fmt.Errorf("failed to append order events: %w", err)
+	}
+	return events, nil
+}
+
+// newOrderEvent creates an event by the principal of the context
+func newOrderEvent(ctx context.Context, order primitive.ObjectID, version int64, eventType string, data orderEventData) OrderHistoryEvent {
+	event := OrderHistoryEvent{
+		ID:         primitive.NewObjectID(),
+		Order:      order,
+		Version:    version,
+		Type:       eventType,
+		Data:       data,
+		OccurredAt: time.Now().UTC(),
+		Actor:      systemActor,
+		RequestID:  logging.RequestID(ctx),
+	}
+	if principal := auth.FromContext(ctx); principal != nil {
+		event.Actor = principal.Subject
+	}
+	return event
+}
+
+// orderCreatedData is the data of the created event of an order
+func orderCreatedData(order *Order) orderEventData {
+	return orderEventData{Customer: &order.Customer, Product: &order.Product, Variant: order.Variant, Amount: order.Amount, Sum: &order.Sum, Status: order.Status}
+}
+
+// applyOrderEvent returns the order after the event, nil once it is deleted.
+// order is nil before the created event.
+func applyOrderEvent(order *Order, event OrderHistoryEvent) *Order {
+	data := event.Data
+	if event.Type == orderEventCreated {
+		created := &Order{ID: event.Order, Amount: data.Amount, Status: data.Status, Variant: data.Variant}
+		if data.Customer != nil {
+			created.Customer = *data.Customer
+		}
+		if data.Product != nil {
+			created.Product = *data.Product
+		}
+		if data.Sum != nil {
+			created.Sum = *data.Sum
+		}
+		return created
+	}
+	if order == nil || event.Type == orderEventDeleted {
+		return nil
+	}
+
+	next := *order
+	switch event.Type {
+	case orderEventLineChanged:
+		// The variant belongs to the product, so both are set together
+		if data.Product != nil {
+			next.Product = *data.Product
+			next.Variant = data.Variant
+		}
+		if data.Amount != 0 {
+			next.Amount = data.Amount
+		}
+		if data.Sum != nil {
+			next.Sum = *data.Sum
+		}
+	case orderEventStatusChanged:
+		next.Status = data.Status
+	case orderEventPayment:
+		next.Paid += data.Value
+	case orderEventRefund:
+		next.Refunded += data.Value
+	}
+	return &next
+}
+
+// orderHistory returns the events of an order, oldest first
+func orderHistory(ctx context.Context, database *mongo.Database, order primitive.ObjectID) ([]OrderHistoryEvent, error) {
+	cursor, err := database.Collection(orderEventsCollection).Find(ctx, bson.M{"order": order},
+		options.Find().SetSort(bson.D{{Key: "version", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	history := []OrderHistoryEvent{}
+	if err := cursor.All(ctx, &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// RebuildOrders replays the whole event log and replaces the orders collection with the projection.
+// Deleted orders and orders without events are removed. Run it while no orders are written,
+// as changes made during the replay may be overwritten.
+func RebuildOrders(ctx context.Context, database *mongo.Database) (*RebuildReport, error) {
+	report := &RebuildReport{}
+	orders := database.Collection(ordersCollection)
+
+	cursor, err := database.Collection(orderEventsCollection).Find(ctx, bson.M{},
+		options.Find().SetSort(bson.D{{Key: "order", Value: 1}, {Key: "version", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	projected := map[primitive.ObjectID]bool{}
+	var models []mongo.WriteModel
+	var current *Order
+	var currentID primitive.ObjectID
+	flush := func() error {
+		if currentID == primitive.NilObjectID {
+			return nil
+		}
+		projected[currentID] = true
+		if current == nil {
+			report.Deleted++
+			models = append(models, mongo.NewDeleteOneModel().SetFilter(bson.M{"_id": currentID}))
+		} else {
+			report.Orders++
+			models = append(models, mongo.NewReplaceOneModel().SetFilter(bson.M{"_id": currentID}).SetReplacement(current).SetUpsert(true))
+		}
+		if len(models) < rebuildChunkSize {
+			return nil
+		}
+		_, err := orders.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+		models = models[:0]
+		return err
+	}
+
+	for cursor.Next(ctx) {
+		var event OrderHistoryEvent
+		if err := cursor.Decode(&event); err != nil {
+			return nil, err
+		}
+		report.Events++
+		if event.Order != currentID {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			current, currentID = nil, event.Order
+		}
+		current = applyOrderEvent(current, event)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	if len(models) > 0 {
+		if _, err := orders.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+			return nil, err
+		}
+	}
+
+	// Orders the log knows nothing about cannot be projected
+	idCursor, err := orders.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer idCursor.Close(ctx)
+	var stray []primitive.ObjectID
+	for idCursor.Next(ctx) {
+		var document struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := idCursor.Decode(&document); err != nil {
+			return nil, err
+		}
+		if !projected[document.ID] {
+			stray = append(stray, document.ID)
+		}
+	}
+	if err := idCursor.Err(); err != nil {
+		return nil, err
+	}
+	if len(stray) > 0 {
+		result, err := orders.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": stray}})
+		if err != nil {
+			return nil, err
+		}
+		report.Removed = int(result.DeletedCount)
+	}
+	return report, nil
+}
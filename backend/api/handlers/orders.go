@@ -1,16 +1,24 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
-	"strings"
 
+	"github.com/DanVerh/university-swe/backend/api/audit"
 	"github.com/DanVerh/university-swe/backend/api/db"
 	"github.com/DanVerh/university-swe/backend/api/errorHandling"
+	"github.com/DanVerh/university-swe/backend/api/events"
+	"github.com/DanVerh/university-swe/backend/api/outbox"
+	"github.com/DanVerh/university-swe/backend/api/tracing"
+	"github.com/go-chi/chi/v5"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Mongo collection name for orders
@@ -21,67 +29,47 @@ type OrdersHandler struct{}
 
 // Order represents an order in the database
 type Order struct {
-	ID       primitive.ObjectID `json:"id" bson:"_id"`
-	Amount   int32              `json:"amount" bson:"amount"`
-	Sum      float64            `json:"sum" bson:"sum"`
-	Customer primitive.ObjectID `json:"customer" bson:"customer"`
-	Status   string             `json:"status" bson:"status"`
-	Product  primitive.ObjectID `json:"product" bson:"product"`
+	ID       primitive.ObjectID  `json:"id" bson:"_id"`
+	Amount   int32               `json:"amount" bson:"amount"`
+	Sum      float64             `json:"sum" bson:"sum"`
+	Customer primitive.ObjectID  `json:"customer" bson:"customer"`
+	Status   string              `json:"status" bson:"status"`
+	Product  primitive.ObjectID  `json:"product" bson:"product"`
+	// Variant of the product, set if and only if the product has variants
+	Variant  *primitive.ObjectID `json:"variant,omitempty" bson:"variant,omitempty"`
+	Paid     float64             `json:"paid" bson:"paid"`
+	Refunded float64             `json:"refunded" bson:"refunded"`
 }
 
 // Create handles POST requests to create a new order
 func (ordersHandler *OrdersHandler) Create(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		errorHandling.ThrowError(w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be POST", nil)
+		errorHandling.ThrowError(r.Context(), w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be POST", nil)
 		return
 	}
 
 	var order Order
 	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
-		errorHandling.ThrowError(w, http.StatusBadRequest, "Invalid request body", err)
-		return
-	}
-
-	if order.Amount == 0 || order.Customer == primitive.NilObjectID || order.Product == primitive.NilObjectID  {
-		errorHandling.ThrowError(w, http.StatusBadRequest, "Missing required fields: amount, customer, product, or status", nil)
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid request body", err)
 		return
 	}
 
 	db := db.DbConnect()
 	defer db.DbDisconnect()
-	collection := db.Client.Database(dbName).Collection("customers")
 
-	var customerExist Customer
-	err := collection.FindOne(nil, bson.M{"_id": order.Customer}).Decode(&customerExist)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			errorHandling.ThrowError(w, http.StatusNotFound, "Customer does not exist", nil)
-		} else {
-			errorHandling.ThrowError(w, http.StatusInternalServerError, "Error checking customer existence", err)
-		}
+	err := insertOrder(r.Context(), db.Client.Database(dbName), &order)
+	switch {
+	case isInvalid(err):
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, err.Error(), nil)
 		return
-	}
-
-	productsCollection := db.Client.Database(dbName).Collection("products")
-	var productExist Product
-	err = productsCollection.FindOne(nil, bson.M{"_id": order.Product}).Decode(&productExist)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			errorHandling.ThrowError(w, http.StatusNotFound, "Product does not exist", nil)
-		} else {
-			errorHandling.ThrowError(w, http.StatusInternalServerError, "Error checking product existence", err)
-		}
+	case err == errCustomerNotFound || err == errProductNotFound || err == errVariantNotFound:
+		errorHandling.ThrowError(r.Context(), w, http.StatusNotFound, err.Error(), nil)
 		return
-	}
-
-	order.Sum = productExist.Price * float64(order.Amount)
-	order.Status = "pending"
-
-	// Step 5: Set the new ObjectID for the order and insert into the database
-	order.ID = primitive.NewObjectID() // Assign a new ObjectID
-	_, err = db.Client.Database(dbName).Collection(ordersCollection).InsertOne(nil, order)
-	if err != nil {
-		errorHandling.ThrowError(w, http.StatusInternalServerError, "Failed to create order", err)
+	case err == errOutOfStock:
+		errorHandling.ThrowError(r.Context(), w, http.StatusConflict, err.Error(), nil)
+		return
+	case err != nil:
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to create order", err)
 		return
 	}
 
@@ -92,7 +80,18 @@ func (ordersHandler *OrdersHandler) Create(w http.ResponseWriter, r *http.Reques
 // List handles GET requests to list all orders
 func (ordersHandler *OrdersHandler) List(w http.ResponseWriter, r *http.Request) {
     if r.Method != http.MethodGet {
-        errorHandling.ThrowError(w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be GET", nil)
+        errorHandling.ThrowError(r.Context(), w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be GET", nil)
+        return
+    }
+
+    projection, err := parseFields(r, Order{})
+    if err != nil {
+        errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, err.Error(), nil)
+        return
+    }
+    expand, err := parseExpand(r)
+    if err != nil {
+        errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, err.Error(), nil)
         return
     }
 
@@ -103,16 +102,47 @@ func (ordersHandler *OrdersHandler) List(w http.ResponseWriter, r *http.Request)
     var filter bson.M
 	filter = bson.M{}
 
-    cursor, err := collection.Find(nil, filter)
+    // Embed the referenced customers and products when expansion is requested
+    if len(expand) > 0 {
+        cursor, err := collection.Aggregate(r.Context(), expandedOrdersPipeline(filter, expand, projection))
+        if err != nil {
+            errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to retrieve documents from the database", err)
+            return
+        }
+        defer cursor.Close(r.Context())
+
+        if err := writeDocuments(r.Context(), w, cursor); err != nil {
+            errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to decode documents", err)
+        }
+        return
+    }
+
+    cursor, err := collection.Find(r.Context(), filter, findOptions(projection))
     if err != nil {
-        errorHandling.ThrowError(w, http.StatusInternalServerError, "Failed to retrieve documents from the database", err)
+        errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to retrieve documents from the database", err)
+        return
+    }
+    defer cursor.Close(r.Context())
+
+    // Stream CSV or NDJSON when requested instead of the JSON array
+    if format := exportFormat(r); format != "" {
+        if err := exportCursor(r.Context(), w, format, cursor, orderColumns, orderRow); err != nil {
+            slog.ErrorContext(r.Context(), "Failed to export orders", "error", err)
+        }
+        return
+    }
+
+    // Return raw documents when only some fields are requested
+    if projection != nil {
+        if err := writeDocuments(r.Context(), w, cursor); err != nil {
+            errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to decode documents", err)
+        }
         return
     }
-    defer cursor.Close(nil)
 
     var orders []Order
-    if err := cursor.All(nil, &orders); err != nil {
-        errorHandling.ThrowError(w, http.StatusInternalServerError, "Failed to decode documents", err)
+    if err := cursor.All(r.Context(), &orders); err != nil {
+        errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to decode documents", err)
         return
     }
 
@@ -124,14 +154,25 @@ func (ordersHandler *OrdersHandler) List(w http.ResponseWriter, r *http.Request)
 // GetByID handles GET requests to retrieve a single order by ID
 func (ordersHandler *OrdersHandler) GetByID(w http.ResponseWriter, r *http.Request) {
     if r.Method != http.MethodGet {
-        errorHandling.ThrowError(w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be GET", nil)
+        errorHandling.ThrowError(r.Context(), w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be GET", nil)
         return
     }
 
-    id := strings.TrimPrefix(r.URL.Path, "/orders/")
+    id := chi.URLParam(r, "id")
     objectID, err := primitive.ObjectIDFromHex(id)
     if err != nil {
-        errorHandling.ThrowError(w, http.StatusBadRequest, "Invalid ObjectId format", nil)
+        errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid ObjectId format", nil)
+        return
+    }
+
+    projection, err := parseFields(r, Order{})
+    if err != nil {
+        errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, err.Error(), nil)
+        return
+    }
+    expand, err := parseExpand(r)
+    if err != nil {
+        errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, err.Error(), nil)
         return
     }
 
@@ -140,16 +181,41 @@ func (ordersHandler *OrdersHandler) GetByID(w http.ResponseWriter, r *http.Reque
     collection := db.Client.Database(dbName).Collection("orders")
 
     var order Order
-    err = collection.FindOne(nil, bson.M{"_id": objectID}).Decode(&order)
+    var document bson.M
+    if len(expand) > 0 {
+        // Embed the referenced customer and product with $lookup
+        var cursor *mongo.Cursor
+        cursor, err = collection.Aggregate(r.Context(), expandedOrdersPipeline(bson.M{"_id": objectID}, expand, projection))
+        if err == nil {
+            defer cursor.Close(r.Context())
+            if !cursor.Next(r.Context()) {
+                err = cursor.Err()
+                if err == nil {
+                    err = mongo.ErrNoDocuments
+                }
+            } else {
+                err = cursor.Decode(&document)
+            }
+        }
+    } else if projection != nil {
+        err = collection.FindOne(r.Context(), bson.M{"_id": objectID}, findOneOptions(projection)).Decode(&document)
+    } else {
+        err = collection.FindOne(r.Context(), bson.M{"_id": objectID}).Decode(&order)
+    }
     if err != nil {
         if err == mongo.ErrNoDocuments {
-            errorHandling.ThrowError(w, http.StatusNotFound, "No order found with the given ID", nil)
+            errorHandling.ThrowError(r.Context(), w, http.StatusNotFound, "No order found with the given ID", nil)
         } else {
-            errorHandling.ThrowError(w, http.StatusInternalServerError, "Failed to retrieve order", err)
+            errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to retrieve order", err)
         }
         return
     }
 
+    if document != nil {
+        writeDocument(w, document)
+        return
+    }
+
     w.WriteHeader(http.StatusOK)
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(order)
@@ -158,43 +224,41 @@ func (ordersHandler *OrdersHandler) GetByID(w http.ResponseWriter, r *http.Reque
 // UpdateByID handles PUT requests to update an order by ID
 func (ordersHandler *OrdersHandler) UpdateByID(w http.ResponseWriter, r *http.Request) {
     if r.Method != http.MethodPut {
-        errorHandling.ThrowError(w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be PUT", nil)
+        errorHandling.ThrowError(r.Context(), w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be PUT", nil)
         return
     }
 
-    id := strings.TrimPrefix(r.URL.Path, "/orders/")
+    id := chi.URLParam(r, "id")
     objectID, err := primitive.ObjectIDFromHex(id)
     if err != nil {
-        errorHandling.ThrowError(w, http.StatusBadRequest, "Invalid ObjectId format", nil)
+        errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid ObjectId format", nil)
         return
     }
 
     var updateBody bson.M
     if err := json.NewDecoder(r.Body).Decode(&updateBody); err != nil {
-        errorHandling.ThrowError(w, http.StatusBadRequest, "Invalid request body", nil)
+        errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid request body", nil)
         return
     }
 
     db := db.DbConnect()
     defer db.DbDisconnect()
-    collection := db.Client.Database(dbName).Collection("orders")
 
-    var updateKeys []string
-    for updateKey := range updateBody {
-        if updateKey != "status" {
-            errorHandling.ThrowError(w, http.StatusBadRequest, "Invalid update field. Only status allowed", nil)
-            return
-        }
-        updateKeys = append(updateKeys, updateKey)
+    updateKeys, err := updateOrder(r.Context(), db.Client.Database(dbName), objectID, updateBody)
+    if isInvalid(err) {
+        errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, err.Error(), nil)
+        return
     }
-
-    updateResult, err := collection.UpdateByID(nil, objectID, bson.M{"$set": updateBody})
-    if err != nil {
-        errorHandling.ThrowError(w, http.StatusInternalServerError, "Failed to update customer", err)
+    if err == mongo.ErrNoDocuments {
+        errorHandling.ThrowError(r.Context(), w, http.StatusNotFound, "No customer found with the provided ID", nil)
+        return
+    }
+    if err == errOutOfStock {
+        errorHandling.ThrowError(r.Context(), w, http.StatusConflict, err.Error(), nil)
         return
     }
-    if updateResult.MatchedCount == 0 {
-        errorHandling.ThrowError(w, http.StatusNotFound, "No customer found with the provided ID", nil)
+    if err != nil {
+        errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to update customer", err)
         return
     }
 
@@ -206,28 +270,27 @@ func (ordersHandler *OrdersHandler) UpdateByID(w http.ResponseWriter, r *http.Re
 // DeleteByID handles DELETE requests to delete a customer by ID
 func (ordersHandler *OrdersHandler) DeleteByID(w http.ResponseWriter, r *http.Request) {
     if r.Method != http.MethodDelete {
-        errorHandling.ThrowError(w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be DELETE", nil)
+        errorHandling.ThrowError(r.Context(), w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be DELETE", nil)
         return
     }
 
-    id := strings.TrimPrefix(r.URL.Path, "/orders/")
+    id := chi.URLParam(r, "id")
     objectID, err := primitive.ObjectIDFromHex(id)
     if err != nil {
-        errorHandling.ThrowError(w, http.StatusBadRequest, "Invalid ObjectId format", nil)
+        errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid ObjectId format", nil)
         return
     }
 
     db := db.DbConnect()
     defer db.DbDisconnect()
-	collection := db.Client.Database(dbName).Collection("orders")
 
-    deleteResult, err := collection.DeleteOne(nil, bson.M{"_id": objectID})
-    if err != nil {
-        errorHandling.ThrowError(w, http.StatusInternalServerError, "Failed to delete order", err)
+    err = deleteOrder(r.Context(), db.Client.Database(dbName), objectID)
+    if err == mongo.ErrNoDocuments {
+        errorHandling.ThrowError(r.Context(), w, http.StatusNotFound, fmt.Sprintf("No order found with the provided ID: %v", id), nil)
         return
     }
-    if deleteResult.DeletedCount == 0 {
-        errorHandling.ThrowError(w, http.StatusNotFound, fmt.Sprintf("No order found with the provided ID: %v", id), nil)
+    if err != nil {
+        errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to delete order", err)
         return
     }
 
@@ -239,44 +302,190 @@ func (ordersHandler *OrdersHandler) DeleteByID(w http.ResponseWriter, r *http.Re
 // SumDeliveredOrders handles GET requests to calculate the total sum of delivered orders
 func (ordersHandler *OrdersHandler) SumDeliveredOrders(w http.ResponseWriter, r *http.Request) {
     if r.Method != http.MethodGet {
-        errorHandling.ThrowError(w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be GET", nil)
+        errorHandling.ThrowError(r.Context(), w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be GET", nil)
         return
     }
 
     db := db.DbConnect()
     defer db.DbDisconnect()
-    collection := db.Client.Database(dbName).Collection("orders")
 
-    // Aggregation pipeline to filter and sum
-    pipeline := mongo.Pipeline{
-        bson.D{{"$match", bson.D{{"status", "delivered"}}}},
-        bson.D{{"$group", bson.D{
-            {"_id", nil},
-            {"totalSum", bson.D{{"$sum", "$sum"}}},
-        }}},
-    }
-
-    cursor, err := collection.Aggregate(nil, pipeline)
+    totalSum, err := sumDeliveredOrders(r.Context(), db.Client.Database(dbName))
     if err != nil {
-        errorHandling.ThrowError(w, http.StatusInternalServerError, "Failed to aggregate orders", err)
-        return
-    }
-    defer cursor.Close(nil)
-
-    // Read the aggregation result
-    var result []bson.M
-    if err := cursor.All(nil, &result); err != nil {
-        errorHandling.ThrowError(w, http.StatusInternalServerError, "Failed to decode aggregation result", err)
+        errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to aggregate orders", err)
         return
     }
 
-    // If no results, the total sum is 0
-    var totalSum float64
-    if len(result) > 0 {
-        totalSum, _ = result[0]["totalSum"].(float64)
-    }
-
     w.WriteHeader(http.StatusOK)
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(bson.M{"totalSum": totalSum})
-}
\ No newline at end of file
+}
+
+// sumDeliveredOrders returns the total sum of delivered orders, 0 if there are none
+func sumDeliveredOrders(ctx context.Context, database *mongo.Database) (float64, error) {
+	// Aggregation pipeline to filter and sum
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.D{{Key: "status", Value: "delivered"}}}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: nil},
+			{Key: "totalSum", Value: bson.D{{Key: "$sum", Value: "$sum"}}},
+		}}},
+	}
+
+	cursor, err := database.Collection(ordersCollection).Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var result []bson.M
+	if err := cursor.All(ctx, &result); err != nil {
+		return 0, err
+	}
+
+	var totalSum float64
+	if len(result) > 0 {
+		totalSum, _ = result[0]["totalSum"].(float64)
+	}
+	return totalSum, nil
+}
+
+// insertOrder validates the order, checks that the customer, product and variant exist, prices it,
+// reserves the stock of the variant and stores it. It returns errCustomerNotFound, errProductNotFound
+// or errVariantNotFound for missing references and errOutOfStock if the variant is sold out.
+func insertOrder(ctx context.Context, database *mongo.Database, order *Order) error {
+	if err := validateOrder(order); err != nil {
+		return invalid(err)
+	}
+
+	// Each step gets its own span so slow lookups and inserts show up in the trace
+	spanCtx, span := tracing.Tracer().Start(ctx, "orders.lookupCustomer")
+	var customerExist Customer
+	err := database.Collection(customerCollection).FindOne(spanCtx, bson.M{"_id": order.Customer}).Decode(&customerExist)
+	tracing.End(span, err)
+	if err == mongo.ErrNoDocuments {
+		return errCustomerNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("Error checking customer existence: %w", err)
+	}
+
+	spanCtx, span = tracing.Tracer().Start(ctx, "orders.lookupProduct")
+	var productExist Product
+	err = database.Collection("products").FindOne(spanCtx, bson.M{"_id": order.Product}).Decode(&productExist)
+	tracing.End(span, err)
+	if err == mongo.ErrNoDocuments {
+		return errProductNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("Error checking product existence: %w", err)
+	}
+
+	variant, err := orderVariant(&productExist, order.Variant)
+	if err != nil {
+		return err
+	}
+	priceOrder(order, &productExist, variant)
+
+	order.ID = primitive.NewObjectID()
+	spanCtx, span = tracing.Tracer().Start(ctx, "orders.insert")
+	span.SetAttributes(attribute.String("order.id", order.ID.Hex()))
+	// The order is projected from its created event, written together with the stock reservation
+	// and the OrderCreated domain event
+	_, _, err = changeOrder(spanCtx, database, order.ID, orderEventCreated, func(ctx context.Context, _ *Order) (orderEventData, []outbox.Event, error) {
+		stockEvents, err := reserveOrderStock(ctx, database, nil, order)
+		if err != nil {
+			return orderEventData{}, nil, err
+		}
+		return orderCreatedData(order), append(orderCreatedEvents(order), stockEvents...), nil
+	})
+	tracing.End(span, err)
+	if err != nil {
+		return err
+	}
+	audit.Write(ctx, database, ordersCollection, order.ID, audit.OperationCreate, nil, order)
+	publishOrderEvent(ctx, database, events.OrderCreated, order)
+	return nil
+}
+
+// updateOrder validates and sets the status of an order and returns the updated field names.
+// Cancelling releases the stock of the variant, leaving cancelled reserves it again.
+// It returns mongo.ErrNoDocuments if the order does not exist.
+func updateOrder(ctx context.Context, database *mongo.Database, id primitive.ObjectID, updateBody bson.M) ([]string, error) {
+	updateKeys, err := validateOrderUpdate(updateBody)
+	if err != nil {
+		return nil, invalid(err)
+	}
+
+	status := updateBody["status"].(string)
+	before, after, err := changeOrder(ctx, database, id, orderEventStatusChanged, func(ctx context.Context, order *Order) (orderEventData, []outbox.Event, error) {
+		if order.Status == status {
+			return orderEventData{}, nil, errUnchanged
+		}
+		next := *order
+		next.Status = status
+		stockEvents, err := reserveOrderStock(ctx, database, order, &next)
+		if err != nil {
+			return orderEventData{}, nil, err
+		}
+		return orderEventData{Status: status, PreviousStatus: order.Status}, append(orderStatusEvents(id, order.Customer, order.Status, status), stockEvents...), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	audit.Write(ctx, database, ordersCollection, id, audit.OperationStatus, before, after)
+	if before.Status != after.Status {
+		publishOrderEvent(ctx, database, events.OrderStatusChanged, after)
+	}
+	return updateKeys, nil
+}
+
+// deleteOrder deletes an order. Its event log is kept with a deleted event.
+// Reserved stock stays taken, as the order may have been delivered.
+// It returns mongo.ErrNoDocuments if the order does not exist.
+func deleteOrder(ctx context.Context, database *mongo.Database, id primitive.ObjectID) error {
+	before, _, err := changeOrder(ctx, database, id, orderEventDeleted, func(ctx context.Context, order *Order) (orderEventData, []outbox.Event, error) {
+		return orderEventData{}, nil, nil
+	})
+	if err != nil {
+		return err
+	}
+	audit.Write(ctx, database, ordersCollection, id, audit.OperationDelete, before, nil)
+	publishOrderEvent(ctx, database, events.OrderDeleted, before)
+	return nil
+}
+
+// validateOrder checks the fields required to create an order
+func validateOrder(order *Order) error {
+	if order.Amount == 0 || order.Customer == primitive.NilObjectID || order.Product == primitive.NilObjectID {
+		return errors.New("Missing required fields: amount, customer, product, or status")
+	}
+	// A negative amount would release stock on creation and store a negative sum
+	if order.Amount < 1 {
+		return errors.New("Amount needs to be at least 1")
+	}
+	return nil
+}
+
+// priceOrder calculates the order sum from the price of the product or variant and marks the order as pending
+func priceOrder(order *Order, product *Product, variant *Variant) {
+	order.Sum = unitPrice(product, variant) * float64(order.Amount)
+	order.Status = "pending"
+}
+
+// validateOrderUpdate checks that only the status of an order is updated, to a valid status
+func validateOrderUpdate(updateBody bson.M) ([]string, error) {
+	var updateKeys []string
+	for updateKey, updateValue := range updateBody {
+		if updateKey != "status" {
+			return nil, errors.New("Invalid update field. Only status allowed")
+		}
+		if status, ok := updateValue.(string); !ok || !validOrderStatus(status) {
+			return nil, errors.New("Invalid status. Needs to be pending, processing, shipped, delivered or cancelled")
+		}
+		updateKeys = append(updateKeys, updateKey)
+	}
+	if len(updateKeys) == 0 {
+		return nil, errors.New("Missing field: status")
+	}
+	return updateKeys, nil
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestValidateOrder(t *testing.T) {
+	customer, product := primitive.NewObjectID(), primitive.NewObjectID()
+	tests := []struct {
+		name  string
+		order Order
+		valid bool
+	}{
+		{name: "valid", order: Order{Amount: 2, Customer: customer, Product: product}, valid: true},
+		{name: "missing amount", order: Order{Customer: customer, Product: product}},
+		{name: "negative amount", order: Order{Amount: -3, Customer: customer, Product: product}},
+		{name: "missing customer", order: Order{Amount: 1, Product: product}},
+		{name: "missing product", order: Order{Amount: 1, Customer: customer}},
+	}
+	for _, test := range tests {
+		if err := validateOrder(&test.order); (err == nil) != test.valid {
+			t.Errorf("%s: got error %v, want valid %v", test.name, err, test.valid)
+		}
+	}
+}
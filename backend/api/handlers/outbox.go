@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/DanVerh/university-swe/backend/api/outbox"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// orderStatusChange is the payload of an OrderStatusChanged event
+type orderStatusChange struct {
+	ID       primitive.ObjectID `json:"id"`
+	Customer primitive.ObjectID `json:"customer"`
+	From     string             `json:"from"`
+	To       string             `json:"to"`
+}
+
+// priceChange is the payload of a ProductPriceChanged event
+type priceChange struct {
+	ID   primitive.ObjectID `json:"id"`
+	From float64            `json:"from"`
+	To   float64            `json:"to"`
+}
+
+// stockAdjustment is the payload of a StockAdjusted event, of a variant if set
+type stockAdjustment struct {
+	ID      primitive.ObjectID  `json:"id"`
+	Variant *primitive.ObjectID `json:"variant,omitempty"`
+	From    int64               `json:"from"`
+	To      int64               `json:"to"`
+	Delta   int64               `json:"delta"`
+}
+
+// orderCreatedEvents returns the domain events of a new order
+func orderCreatedEvents(order *Order) []outbox.Event {
+	return []outbox.Event{{Type: outbox.OrderCreated, AggregateType: outbox.AggregateOrder, AggregateID: order.ID, Data: order}}
+}
+
+// orderStatusEvents returns the domain events of a status change of an order
+func orderStatusEvents(id primitive.ObjectID, customer primitive.ObjectID, from, to string) []outbox.Event {
+	return []outbox.Event{{Type: outbox.OrderStatusChanged, AggregateType: outbox.AggregateOrder, AggregateID: id,
+		Data: orderStatusChange{ID: id, Customer: customer, From: from, To: to}}}
+}
+
+// productUpdateEvents returns the domain events of setting the fields of a product, given the product before
+func productUpdateEvents(id primitive.ObjectID, before bson.M, set bson.M) []outbox.Event {
+	var events []outbox.Event
+	if price, ok := set["price"]; ok {
+		from, to := numberValue(before["price"]), numberValue(price)
+		if from != to {
+			events = append(events, outbox.Event{Type: outbox.ProductPriceChanged, AggregateType: outbox.AggregateProduct, AggregateID: id,
+				Data: priceChange{ID: id, From: from, To: to}})
+		}
+	}
+	if amount, ok := set["amount"]; ok {
+		from, to := int64(numberValue(before["amount"])), int64(numberValue(amount))
+		if from != to {
+			events = append(events, outbox.Event{Type: outbox.StockAdjusted, AggregateType: outbox.AggregateProduct, AggregateID: id,
+				Data: stockAdjustment{ID: id, From: from, To: to, Delta: to - from}})
+		}
+	}
+	return events
+}
+
+// numberValue converts a number decoded from BSON or JSON to float64, 0 for anything else
+func numberValue(value interface{}) float64 {
+	switch number := value.(type) {
+	case float64:
+		return number
+	case int32:
+		return float64(number)
+	case int64:
+		return float64(number)
+	case int:
+		return float64(number)
+	}
+	return 0
+}
+
+// writeEvents are recorded in the transaction of a write: domain events for the outbox
+// and, for orders, events appended to the log of the order and the stock changes of variants
+type writeEvents struct {
+	domain []outbox.Event
+	orders []orderLogEntry
+	stock  []stockChange
+}
+
+// orderLogEntry is an order event to append with the next version of the order
+type orderLogEntry struct {
+	order     primitive.ObjectID
+	eventType string
+	data      orderEventData
+}
+
+func (events writeEvents) empty() bool {
+	return len(events.domain) == 0 && len(events.orders) == 0 && len(events.stock) == 0
+}
+
+// mergeEvents combines the events of several writes in their order, to record them at once
+func mergeEvents(events []writeEvents) writeEvents {
+	var merged writeEvents
+	for _, itemEvents := range events {
+		merged.domain = append(merged.domain, itemEvents.domain...)
+		merged.orders = append(merged.orders, itemEvents.orders...)
+		merged.stock = append(merged.stock, itemEvents.stock...)
+	}
+	return merged
+}
+
+// record changes the stock, appends the order events to the log and adds the domain events
+// to the outbox, with one insert into each. It fails with errOutOfStock if a variant has not
+// enough stock for a reservation.
+func (events writeEvents) record(sessionCtx mongo.SessionContext, database *mongo.Database) error {
+	domain := append([]outbox.Event(nil), events.domain...)
+	for _, change := range events.stock {
+		stockEvents, err := applyStockChange(sessionCtx, database, change)
+		if err != nil {
+			return err
+		}
+		domain = append(domain, stockEvents...)
+	}
+	if _, err := appendOrderEvents(sessionCtx, database, events.orders); err != nil {
+		return err
+	}
+	return outbox.Add(sessionCtx, database, domain...)
+}
+
+// bulkWriteWithEvents writes the models like an unordered BulkWrite. When models have events,
+// the models and all their events are written in a single transaction with one BulkWrite.
+// If a write fails the transaction is rolled back and the models are written again one at a time
+// by bulkWriteEachWithEvents, so only the failed items are lost. Failed writes are returned in a
+// BulkWriteException indexed like models, with the counts of the successful writes.
+func bulkWriteWithEvents(ctx context.Context, collection *mongo.Collection, models []mongo.WriteModel, events []writeEvents) (*mongo.BulkWriteResult, error) {
+	merged := mergeEvents(events)
+	if merged.empty() {
+		return bulkWriteEachWithEvents(ctx, collection, models, events)
+	}
+
+	var written *mongo.BulkWriteResult
+	err := outbox.Transact(ctx, collection.Database().Client(), func(sessionCtx mongo.SessionContext) error {
+		var err error
+		written, err = collection.BulkWrite(sessionCtx, models, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			return err
+		}
+		return merged.record(sessionCtx, collection.Database())
+	})
+	if err == nil {
+		return written, nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return bulkWriteEachWithEvents(ctx, collection, models, events)
+}
+
+// bulkWriteEachWithEvents writes the models without events in one unordered BulkWrite and each model
+// with events in its own transaction, so an event is recorded if and only if its write succeeds
+func bulkWriteEachWithEvents(ctx context.Context, collection *mongo.Collection, models []mongo.WriteModel, events []writeEvents) (*mongo.BulkWriteResult, error) {
+	result := &mongo.BulkWriteResult{}
+	var bulkErr mongo.BulkWriteException
+	var plain []mongo.WriteModel
+	var indexes []int
+	for i, model := range models {
+		if events[i].empty() {
+			plain = append(plain, model)
+			indexes = append(indexes, i)
+			continue
+		}
+
+		var written *mongo.BulkWriteResult
+		err := outbox.Transact(ctx, collection.Database().Client(), func(sessionCtx mongo.SessionContext) error {
+			var err error
+			written, err = collection.BulkWrite(sessionCtx, []mongo.WriteModel{model})
+			if err != nil {
+				return err
+			}
+			return events[i].record(sessionCtx, collection.Database())
+		})
+		if err != nil {
+			bulkErr.WriteErrors = append(bulkErr.WriteErrors, itemWriteError(i, err))
+			continue
+		}
+		addBulkWriteResult(result, written)
+	}
+
+	if len(plain) > 0 {
+		written, err := collection.BulkWrite(ctx, plain, options.BulkWrite().SetOrdered(false))
+		var plainErr mongo.BulkWriteException
+		if err != nil && !errors.As(err, &plainErr) {
+			return nil, err
+		}
+		for _, writeErr := range plainErr.WriteErrors {
+			writeErr.Index = indexes[writeErr.Index]
+			bulkErr.WriteErrors = append(bulkErr.WriteErrors, writeErr)
+		}
+		addBulkWriteResult(result, written)
+	}
+
+	if len(bulkErr.WriteErrors) > 0 {
+		return result, bulkErr
+	}
+	return result, nil
+}
+
+// itemWriteError converts the error of a single write into the write error of the item at index
+func itemWriteError(index int, err error) mongo.BulkWriteError {
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && len(bulkErr.WriteErrors) > 0 {
+		writeErr := bulkErr.WriteErrors[0]
+		writeErr.Index = index
+		return writeErr
+	}
+	return mongo.BulkWriteError{WriteError: mongo.WriteError{Index: index, Message: err.Error()}}
+}
+
+func addBulkWriteResult(result *mongo.BulkWriteResult, written *mongo.BulkWriteResult) {
+	if written == nil {
+		return
+	}
+	result.InsertedCount += written.InsertedCount
+	result.MatchedCount += written.MatchedCount
+	result.ModifiedCount += written.ModifiedCount
+	result.DeletedCount += written.DeletedCount
+	result.UpsertedCount += written.UpsertedCount
+}
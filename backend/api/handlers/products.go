@@ -1,36 +1,49 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
-	"strings"
 
+	"github.com/DanVerh/university-swe/backend/api/audit"
 	"github.com/DanVerh/university-swe/backend/api/db"
 	"github.com/DanVerh/university-swe/backend/api/errorHandling"
+	"github.com/DanVerh/university-swe/backend/api/outbox"
+	"github.com/go-chi/chi/v5"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-// Mongo collection name
-const dbName = "sales"
+// Mongo database name
+const dbName = db.DbName
 
 // ProductsHandler handles requests for products
 type ProductsHandler struct{}
 
 // Product represents a product in the database
 type Product struct {
-    ID    primitive.ObjectID `json:"id" bson:"_id"`
-    Name  string             `json:"name" bson:"name"`
-    Price float64            `json:"price" bson:"price"`
-    Amount *int32            `json:"amount" bson:"amount"`
+    ID         primitive.ObjectID   `json:"id" bson:"_id"`
+    Name       string               `json:"name" bson:"name"`
+    // SKU is unique across products and variants, derived from the ID if not given
+    SKU        string               `json:"sku" bson:"sku"`
+    // Barcode is an optional EAN-13 or UPC-A code
+    Barcode    string               `json:"barcode,omitempty" bson:"barcode,omitempty"`
+    Price      float64              `json:"price" bson:"price"`
+    Amount     *int32               `json:"amount" bson:"amount"`
+    // A product can be listed in several categories
+    Categories []primitive.ObjectID `json:"categories,omitempty" bson:"categories,omitempty"`
+    // Option axes like size and colour, and the variants combining their values
+    Options    []ProductOption      `json:"options,omitempty" bson:"options,omitempty"`
+    Variants   []Variant            `json:"variants,omitempty" bson:"variants,omitempty"`
 }
 
 func (productHandler *ProductsHandler) Create(w http.ResponseWriter, r *http.Request) {
     if r.Method != http.MethodPost {
-        errorHandling.ThrowError(w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be POST", nil)
+        errorHandling.ThrowError(r.Context(), w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be POST", nil)
         return
     }
 
@@ -39,39 +52,27 @@ func (productHandler *ProductsHandler) Create(w http.ResponseWriter, r *http.Req
     d.UseNumber()
 
     if err := d.Decode(&product); err != nil {
-        errorHandling.ThrowError(w, http.StatusBadRequest, "Invalid JSON", nil)
+        errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid JSON", nil)
         return
     }
 
-    if product.Name == "" || product.Price <= 0 {
-        errorHandling.ThrowError(w, http.StatusBadRequest, "Name is required and price must be positive", nil)
-        return
-    }
-
-    product.ID = primitive.NewObjectID()
-    amount := int32(0)
-	product.Amount = &amount
-
     db := db.DbConnect()
-    if db == nil {
-        log.Fatal("Failed to connect to the database")
-    }
     defer db.DbDisconnect()
 
-    collection := db.Client.Database(dbName).Collection("products")
-
-    // Optional: Log the product before insertion
-    log.Printf("Product to insert: %+v", product)
-
-    _, err := collection.InsertOne(nil, product)
+    err := insertProduct(r.Context(), db.Client.Database(dbName), &product)
+    if isInvalid(err) {
+        errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, err.Error(), nil)
+        return
+    }
+    if message, ok := productConflict(err); ok {
+        errorHandling.ThrowError(r.Context(), w, http.StatusConflict, message, nil)
+        return
+    }
     if err != nil {
-        log.Printf("Failed to insert product into the database: %v", err)
-        errorHandling.ThrowError(w, http.StatusInternalServerError, "Failed to insert the product into the database", err)
+        errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to insert the product into the database", err)
         return
     }
 
-    log.Printf("Created product: %v, %v\n", product.Name, product.Price)
-
     w.WriteHeader(http.StatusCreated)
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(product)
@@ -80,7 +81,13 @@ func (productHandler *ProductsHandler) Create(w http.ResponseWriter, r *http.Req
 // List handles GET requests to list all products or search for products by name
 func (productHandler *ProductsHandler) List(w http.ResponseWriter, r *http.Request) {
     if r.Method != http.MethodGet {
-        errorHandling.ThrowError(w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be GET", nil)
+        errorHandling.ThrowError(r.Context(), w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be GET", nil)
+        return
+    }
+
+    projection, err := parseFields(r, Product{})
+    if err != nil {
+        errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, err.Error(), nil)
         return
     }
 
@@ -100,16 +107,32 @@ func (productHandler *ProductsHandler) List(w http.ResponseWriter, r *http.Reque
         filter = bson.M{}
     }
 
-    cursor, err := collection.Find(nil, filter)
+    cursor, err := collection.Find(r.Context(), filter, findOptions(projection))
     if err != nil {
-        errorHandling.ThrowError(w, http.StatusInternalServerError, "Failed to retrieve documents from the database", err)
+        errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to retrieve documents from the database", err)
+        return
+    }
+    defer cursor.Close(r.Context())
+
+    // Stream CSV or NDJSON when requested instead of the JSON array
+    if format := exportFormat(r); format != "" {
+        if err := exportCursor(r.Context(), w, format, cursor, productColumns, productRow); err != nil {
+            slog.ErrorContext(r.Context(), "Failed to export products", "error", err)
+        }
+        return
+    }
+
+    // Return raw documents when only some fields are requested
+    if projection != nil {
+        if err := writeDocuments(r.Context(), w, cursor); err != nil {
+            errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to decode documents", err)
+        }
         return
     }
-    defer cursor.Close(nil)
 
     var products []Product
-    if err := cursor.All(nil, &products); err != nil {
-        errorHandling.ThrowError(w, http.StatusInternalServerError, "Failed to decode documents", err)
+    if err := cursor.All(r.Context(), &products); err != nil {
+        errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to decode documents", err)
         return
     }
 
@@ -121,14 +144,20 @@ func (productHandler *ProductsHandler) List(w http.ResponseWriter, r *http.Reque
 // GetByID handles GET requests to retrieve a single product by ID
 func (productHandler *ProductsHandler) GetByID(w http.ResponseWriter, r *http.Request) {
     if r.Method != http.MethodGet {
-        errorHandling.ThrowError(w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be GET", nil)
+        errorHandling.ThrowError(r.Context(), w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be GET", nil)
         return
     }
 
-    id := strings.TrimPrefix(r.URL.Path, "/products/")
+    id := chi.URLParam(r, "id")
     objectID, err := primitive.ObjectIDFromHex(id)
     if err != nil {
-        errorHandling.ThrowError(w, http.StatusBadRequest, "Invalid ObjectId format", nil)
+        errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid ObjectId format", nil)
+        return
+    }
+
+    projection, err := parseFields(r, Product{})
+    if err != nil {
+        errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, err.Error(), nil)
         return
     }
 
@@ -137,16 +166,27 @@ func (productHandler *ProductsHandler) GetByID(w http.ResponseWriter, r *http.Re
     collection := db.Client.Database(dbName).Collection("products")
 
     var product Product
-    err = collection.FindOne(nil, bson.M{"_id": objectID}).Decode(&product)
+    var document bson.M
+    result := collection.FindOne(r.Context(), bson.M{"_id": objectID}, findOneOptions(projection))
+    if projection != nil {
+        err = result.Decode(&document)
+    } else {
+        err = result.Decode(&product)
+    }
     if err != nil {
         if err == mongo.ErrNoDocuments {
-            errorHandling.ThrowError(w, http.StatusNotFound, "No product found with the given ID", nil)
+            errorHandling.ThrowError(r.Context(), w, http.StatusNotFound, "No product found with the given ID", nil)
         } else {
-            errorHandling.ThrowError(w, http.StatusInternalServerError, "Failed to retrieve product", err)
+            errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to retrieve product", err)
         }
         return
     }
 
+    if projection != nil {
+        writeDocument(w, document)
+        return
+    }
+
     w.WriteHeader(http.StatusOK)
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(product)
@@ -155,51 +195,41 @@ func (productHandler *ProductsHandler) GetByID(w http.ResponseWriter, r *http.Re
 // UpdateByID handles PUT requests to update a product by ID
 func (productHandler *ProductsHandler) UpdateByID(w http.ResponseWriter, r *http.Request) {
     if r.Method != http.MethodPut {
-        errorHandling.ThrowError(w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be PUT", nil)
+        errorHandling.ThrowError(r.Context(), w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be PUT", nil)
         return
     }
 
-    id := strings.TrimPrefix(r.URL.Path, "/products/")
+    id := chi.URLParam(r, "id")
     objectID, err := primitive.ObjectIDFromHex(id)
     if err != nil {
-        errorHandling.ThrowError(w, http.StatusBadRequest, "Invalid ObjectId format", nil)
+        errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid ObjectId format", nil)
         return
     }
 
     var updateBody bson.M
     if err := json.NewDecoder(r.Body).Decode(&updateBody); err != nil {
-        errorHandling.ThrowError(w, http.StatusBadRequest, "Invalid request body", nil)
+        errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid request body", nil)
         return
     }
 
     db := db.DbConnect()
     defer db.DbDisconnect()
-    collection := db.Client.Database(dbName).Collection("products")
 
-    var updateKeys []string
-    for updateKey, updateValue := range updateBody {
-        if updateKey != "name" && updateKey != "price" && updateKey != "amount" {
-            errorHandling.ThrowError(w, http.StatusBadRequest, "Invalid update field", nil)
-            return
-        }
-        if updateKey == "amount" {
-            floatValue, ok := updateValue.(float64)
-            if !ok {
-                errorHandling.ThrowError(w, http.StatusBadRequest, "Invalid type for 'amount'. Expected a number.", nil)
-                return
-            }
-            updateBody[updateKey] = int32(floatValue)
-        }
-        updateKeys = append(updateKeys, updateKey)
+    updateKeys, err := updateProduct(r.Context(), db.Client.Database(dbName), objectID, updateBody)
+    if isInvalid(err) {
+        errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, err.Error(), nil)
+        return
     }
-
-    updateResult, err := collection.UpdateByID(nil, objectID, bson.M{"$set": updateBody})
-    if err != nil {
-        errorHandling.ThrowError(w, http.StatusInternalServerError, "Failed to update product", err)
+    if err == mongo.ErrNoDocuments {
+        errorHandling.ThrowError(r.Context(), w, http.StatusNotFound, "No product found with the provided ID", nil)
         return
     }
-    if updateResult.MatchedCount == 0 {
-        errorHandling.ThrowError(w, http.StatusNotFound, "No product found with the provided ID", nil)
+    if message, ok := productConflict(err); ok {
+        errorHandling.ThrowError(r.Context(), w, http.StatusConflict, message, nil)
+        return
+    }
+    if err != nil {
+        errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to update product", err)
         return
     }
 
@@ -211,32 +241,186 @@ func (productHandler *ProductsHandler) UpdateByID(w http.ResponseWriter, r *http
 // DeleteByID handles DELETE requests to delete a product by ID
 func (productHandler *ProductsHandler) DeleteByID(w http.ResponseWriter, r *http.Request) {
     if r.Method != http.MethodDelete {
-        errorHandling.ThrowError(w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be DELETE", nil)
+        errorHandling.ThrowError(r.Context(), w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be DELETE", nil)
         return
     }
 
-    id := strings.TrimPrefix(r.URL.Path, "/products/")
+    id := chi.URLParam(r, "id")
     objectID, err := primitive.ObjectIDFromHex(id)
     if err != nil {
-        errorHandling.ThrowError(w, http.StatusBadRequest, "Invalid ObjectId format", nil)
+        errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid ObjectId format", nil)
         return
     }
 
     db := db.DbConnect()
     defer db.DbDisconnect()
-	collection := db.Client.Database(dbName).Collection("products")
 
-    deleteResult, err := collection.DeleteOne(nil, bson.M{"_id": objectID})
-    if err != nil {
-        errorHandling.ThrowError(w, http.StatusInternalServerError, "Failed to delete product", err)
+    err = deleteProduct(r.Context(), db.Client.Database(dbName), objectID)
+    if err == mongo.ErrNoDocuments {
+        errorHandling.ThrowError(r.Context(), w, http.StatusNotFound, fmt.Sprintf("No product found with the provided ID: %v", id), nil)
         return
     }
-    if deleteResult.DeletedCount == 0 {
-        errorHandling.ThrowError(w, http.StatusNotFound, fmt.Sprintf("No product found with the provided ID: %v", id), nil)
+    if err != nil {
+        errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to delete product", err)
         return
     }
 
     response := fmt.Sprintf("Deleted product with ID: %v", id)
     w.WriteHeader(http.StatusOK)
     w.Write([]byte(response))
-}
\ No newline at end of file
+}
+
+// insertProduct validates and stores a new product with an empty stock
+func insertProduct(ctx context.Context, database *mongo.Database, product *Product) error {
+    if err := validateProduct(product); err != nil {
+        return invalid(err)
+    }
+    if err := checkCategories(ctx, database, product.Categories); err != nil {
+        return err
+    }
+
+    product.ID = primitive.NewObjectID()
+    defaultSKU(product)
+    amount := int32(0)
+    product.Amount = &amount
+    if err := checkProductIdentifiers(ctx, database, bson.M{}, productSKUs(product), product.Barcode); err != nil {
+        return err
+    }
+
+    if _, err := database.Collection("products").InsertOne(ctx, product); err != nil {
+        return err
+    }
+
+    slog.InfoContext(ctx, "Created product", "id", product.ID.Hex(), "name", product.Name, "price", product.Price)
+    audit.Write(ctx, database, "products", product.ID, audit.OperationCreate, nil, product)
+    return nil
+}
+
+// updateProduct validates and sets the fields of a product and returns the updated field names.
+// It returns mongo.ErrNoDocuments if the product does not exist.
+func updateProduct(ctx context.Context, database *mongo.Database, id primitive.ObjectID, updateBody bson.M) ([]string, error) {
+    updateKeys, err := validateProductUpdate(updateBody)
+    if err != nil {
+        return nil, invalid(err)
+    }
+    if categories, ok := updateBody["categories"].([]primitive.ObjectID); ok {
+        if err := checkCategories(ctx, database, categories); err != nil {
+            return nil, err
+        }
+    }
+    if err := checkUpdatedIdentifiers(ctx, database, id, updateBody); err != nil {
+        return nil, err
+    }
+
+    // Keep the document before the update for the audit trail and the domain events
+    var before bson.M
+    err = outbox.Transact(ctx, database.Client(), func(sessionCtx mongo.SessionContext) error {
+        err := database.Collection("products").FindOneAndUpdate(sessionCtx, bson.M{"_id": id}, productUpdate(updateBody)).Decode(&before)
+        if err != nil {
+            return err
+        }
+        return outbox.Add(sessionCtx, database, productUpdateEvents(id, before, updateBody)...)
+    })
+    if err != nil {
+        return nil, err
+    }
+    audit.Write(ctx, database, "products", id, audit.OperationUpdate, before, audit.ApplyUpdate(before, productUpdate(updateBody)))
+    return updateKeys, nil
+}
+
+// deleteProduct deletes a product. It returns mongo.ErrNoDocuments if the product does not exist.
+func deleteProduct(ctx context.Context, database *mongo.Database, id primitive.ObjectID) error {
+    var before bson.M
+    err := database.Collection("products").FindOneAndDelete(ctx, bson.M{"_id": id}).Decode(&before)
+    if err != nil {
+        return err
+    }
+    audit.Write(ctx, database, "products", id, audit.OperationDelete, before, nil)
+    return nil
+}
+
+// productUpdate builds the update of a validated update body. An empty barcode is unset rather than
+// stored, so the product matches one created without a barcode and stays out of the unique barcode index.
+func productUpdate(updateBody bson.M) bson.M {
+    set := bson.M{}
+    update := bson.M{}
+    for key, value := range updateBody {
+        if key == "barcode" && value == "" {
+            update["$unset"] = bson.M{"barcode": ""}
+            continue
+        }
+        set[key] = value
+    }
+    if len(set) > 0 {
+        update["$set"] = set
+    }
+    return update
+}
+
+// validateProduct checks the fields required to create a product
+func validateProduct(product *Product) error {
+    if product.Name == "" || product.Price <= 0 {
+        return errors.New("Name is required and price must be positive")
+    }
+    // A missing SKU is derived from the ID when the product is stored
+    if product.SKU != "" {
+        if err := validateSKU(product.SKU); err != nil {
+            return err
+        }
+    }
+    if product.Barcode != "" {
+        if err := validateBarcode(product.Barcode); err != nil {
+            return err
+        }
+    }
+    product.Categories = uniqueCategories(product.Categories)
+    return validateVariants(product)
+}
+
+// validateProductUpdate checks the fields of an update body, converts amount to int32
+// and categories to ObjectIds. An empty barcode removes the barcode.
+func validateProductUpdate(updateBody bson.M) ([]string, error) {
+    var updateKeys []string
+    for updateKey, updateValue := range updateBody {
+        if updateKey != "name" && updateKey != "price" && updateKey != "amount" && updateKey != "categories" &&
+            updateKey != "sku" && updateKey != "barcode" {
+            return nil, errors.New("Invalid update field")
+        }
+        if updateKey == "sku" {
+            sku, ok := updateValue.(string)
+            if !ok {
+                return nil, errors.New("Invalid type for 'sku'. Expected a string.")
+            }
+            if err := validateSKU(sku); err != nil {
+                return nil, err
+            }
+        }
+        if updateKey == "barcode" {
+            code, ok := updateValue.(string)
+            if !ok {
+                return nil, errors.New("Invalid type for 'barcode'. Expected a string.")
+            }
+            if code != "" {
+                if err := validateBarcode(code); err != nil {
+                    return nil, err
+                }
+            }
+        }
+        if updateKey == "categories" {
+            categories, err := categoryIDs(updateValue)
+            if err != nil {
+                return nil, err
+            }
+            updateBody[updateKey] = categories
+        }
+        if updateKey == "amount" {
+            floatValue, ok := updateValue.(float64)
+            if !ok {
+                return nil, errors.New("Invalid type for 'amount'. Expected a number.")
+            }
+            updateBody[updateKey] = int32(floatValue)
+        }
+        updateKeys = append(updateKeys, updateKey)
+    }
+    return updateKeys, nil
+}
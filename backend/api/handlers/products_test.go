@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/DanVerh/university-swe/backend/api/audit"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestProductUpdateUnsetsEmptyBarcode(t *testing.T) {
+	tests := []struct {
+		body bson.M
+		want bson.M
+	}{
+		{body: bson.M{"name": "Lamp", "barcode": ""},
+			want: bson.M{"$set": bson.M{"name": "Lamp"}, "$unset": bson.M{"barcode": ""}}},
+		{body: bson.M{"barcode": ""}, want: bson.M{"$unset": bson.M{"barcode": ""}}},
+		{body: bson.M{"barcode": "4006381333931"}, want: bson.M{"$set": bson.M{"barcode": "4006381333931"}}},
+	}
+	for _, test := range tests {
+		if got := productUpdate(test.body); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("update of %v is %v, want %v", test.body, got, test.want)
+		}
+	}
+
+	before := bson.M{"name": "Lamp", "barcode": "4006381333931"}
+	after := audit.ApplyUpdate(before, productUpdate(bson.M{"barcode": ""}))
+	if _, ok := after["barcode"]; ok || after["name"] != "Lamp" {
+		t.Errorf("got document %v after removing the barcode, want the name without barcode", after)
+	}
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// projectionFields maps the JSON field names of a model to their bson names, e.g. id -> _id
+func projectionFields(model interface{}) map[string]string {
+	fields := map[string]string{}
+	modelType := reflect.TypeOf(model)
+	for i := 0; i < modelType.NumField(); i++ {
+		field := modelType.Field(i)
+		jsonName := strings.Split(field.Tag.Get("json"), ",")[0]
+		bsonName := strings.Split(field.Tag.Get("bson"), ",")[0]
+		if jsonName == "" || jsonName == "-" || bsonName == "" || bsonName == "-" {
+			continue
+		}
+		fields[jsonName] = bsonName
+	}
+	return fields
+}
+
+// parseFields builds a Mongo projection from ?fields=name,price.
+// It returns nil without ?fields= so the full document is returned, and an error for an empty field list.
+func parseFields(r *http.Request, model interface{}) (bson.M, error) {
+	if !r.URL.Query().Has("fields") {
+		return nil, nil
+	}
+	query := r.URL.Query().Get("fields")
+
+	allowed := projectionFields(model)
+	projection := bson.M{"_id": 0}
+	for _, name := range strings.Split(query, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		bsonName, ok := allowed[name]
+		if !ok {
+			return nil, fmt.Errorf("Invalid field %q", name)
+		}
+		projection[bsonName] = 1
+	}
+	if len(projection) == 1 {
+		return nil, errors.New("Fields need at least one field name")
+	}
+	return projection, nil
+}
+
+// findOptions applies the projection to a Find when fields were requested
+func findOptions(projection bson.M) *options.FindOptions {
+	findOptions := options.Find()
+	if projection != nil {
+		findOptions.SetProjection(projection)
+	}
+	return findOptions
+}
+
+// findOneOptions applies the projection to a FindOne when fields were requested
+func findOneOptions(projection bson.M) *options.FindOneOptions {
+	findOneOptions := options.FindOne()
+	if projection != nil {
+		findOneOptions.SetProjection(projection)
+	}
+	return findOneOptions
+}
+
+// parseExpand reads ?expand=customer,product and reports which references to embed
+func parseExpand(r *http.Request) (map[string]bool, error) {
+	expand := map[string]bool{}
+	query := r.URL.Query().Get("expand")
+	if query == "" {
+		return expand, nil
+	}
+	for _, name := range strings.Split(query, ",") {
+		name = strings.TrimSpace(name)
+		if name != "customer" && name != "product" {
+			return nil, fmt.Errorf("Invalid expand %q. Needs to be customer or product", name)
+		}
+		expand[name] = true
+	}
+	return expand, nil
+}
+
+// expandPipeline appends $lookup stages that replace the customer and product ids with their documents
+func expandPipeline(pipeline mongo.Pipeline, expand map[string]bool) mongo.Pipeline {
+	references := []struct{ field, collection string }{
+		{"customer", customerCollection},
+		{"product", "products"},
+	}
+	for _, reference := range references {
+		if !expand[reference.field] {
+			continue
+		}
+		pipeline = append(pipeline,
+			bson.D{{Key: "$lookup", Value: bson.D{
+				{Key: "from", Value: reference.collection},
+				{Key: "localField", Value: reference.field},
+				{Key: "foreignField", Value: "_id"},
+				{Key: "as", Value: reference.field},
+			}}},
+			// Deleted references are kept as null instead of dropping the order
+			bson.D{{Key: "$unwind", Value: bson.D{
+				{Key: "path", Value: "$" + reference.field},
+				{Key: "preserveNullAndEmptyArrays", Value: true},
+			}}},
+		)
+	}
+	return pipeline
+}
+
+// expandedOrdersPipeline matches orders, embeds the expanded references and applies the projection.
+// The expanded references are always projected, whether or not they are listed in the fields.
+func expandedOrdersPipeline(filter bson.M, expand map[string]bool, projection bson.M) mongo.Pipeline {
+	pipeline := expandPipeline(mongo.Pipeline{bson.D{{Key: "$match", Value: filter}}}, expand)
+	if projection != nil {
+		expanded := bson.M{}
+		for field, value := range projection {
+			expanded[field] = value
+		}
+		for field := range expand {
+			expanded[field] = 1
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$project", Value: expanded}})
+	}
+	return pipeline
+}
+
+// responseDocument renames _id to id in the document and its embedded documents
+func responseDocument(document bson.M) bson.M {
+	for key, value := range document {
+		if embedded, ok := value.(bson.M); ok {
+			document[key] = responseDocument(embedded)
+		}
+	}
+	if id, ok := document["_id"]; ok {
+		document["id"] = id
+		delete(document, "_id")
+	}
+	return document
+}
+
+// writeDocuments decodes the cursor into raw documents so only the projected or expanded fields are returned
+func writeDocuments(ctx context.Context, w http.ResponseWriter, cursor *mongo.Cursor) error {
+	documents := []bson.M{}
+	if err := cursor.All(ctx, &documents); err != nil {
+		return err
+	}
+	for _, document := range documents {
+		responseDocument(document)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	return json.NewEncoder(w).Encode(documents)
+}
+
+// writeDocument writes a single raw document with _id renamed to id
+func writeDocument(w http.ResponseWriter, document bson.M) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responseDocument(document))
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseFields(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bson.M
+		err   bool
+	}{
+		{query: "", want: nil},
+		{query: "?fields=status,sum", want: bson.M{"_id": 0, "status": 1, "sum": 1}},
+		{query: "?fields=id,%20customer", want: bson.M{"_id": 1, "customer": 1}},
+		{query: "?fields=", err: true},
+		{query: "?fields=,", err: true},
+		{query: "?fields=unknown", err: true},
+	}
+	for _, test := range tests {
+		projection, err := parseFields(httptest.NewRequest(http.MethodGet, "/orders"+test.query, nil), Order{})
+		if (err != nil) != test.err {
+			t.Errorf("%q: got error %v, want error %v", test.query, err, test.err)
+			continue
+		}
+		if !reflect.DeepEqual(projection, test.want) {
+			t.Errorf("%q: got projection %v, want %v", test.query, projection, test.want)
+		}
+	}
+}
+
+func TestExpandedOrdersPipelineProjectsExpandedFields(t *testing.T) {
+	projection := bson.M{"_id": 0, "status": 1}
+	pipeline := expandedOrdersPipeline(bson.M{}, map[string]bool{"customer": true, "product": true}, projection)
+
+	last := pipeline[len(pipeline)-1]
+	if last[0].Key != "$project" {
+		t.Fatalf("got last stage %s, want $project", last[0].Key)
+	}
+	want := bson.M{"_id": 0, "status": 1, "customer": 1, "product": 1}
+	if got := last[0].Value; !reflect.DeepEqual(got, want) {
+		t.Errorf("got projection %v, want %v", got, want)
+	}
+	if len(projection) != 2 {
+		t.Errorf("the projection of the request was changed to %v", projection)
+	}
+
+	pipeline = expandedOrdersPipeline(bson.M{}, map[string]bool{"customer": true}, nil)
+	for _, stage := range pipeline {
+		if stage[0].Key == "$project" {
+			t.Error("got a $project stage without requested fields")
+		}
+	}
+}
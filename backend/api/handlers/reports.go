@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/DanVerh/university-swe/backend/api/db"
+	"github.com/DanVerh/university-swe/backend/api/errorHandling"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ReportsHandler handles reporting requests computed from orders
+type ReportsHandler struct{}
+
+// Date formats of the time buckets, rendered by $dateToString in the requested timezone
+var reportBuckets = map[string]string{
+	"day":   "%Y-%m-%d",
+	"week":  "%G-W%V",
+	"month": "%Y-%m",
+}
+
+// reportRange is the date range and timezone of a report
+type reportRange struct {
+	From     *time.Time `json:"from,omitempty"`
+	To       *time.Time `json:"to,omitempty"`
+	Timezone string     `json:"timezone"`
+}
+
+// salesGroup holds the sales figures of a single group
+type salesGroup struct {
+	Key               interface{} `json:"key" bson:"_id"`
+	Name              string      `json:"name,omitempty" bson:"name,omitempty"`
+	Orders            int64       `json:"orders" bson:"orders"`
+	Quantity          int64       `json:"quantity" bson:"quantity"`
+	Revenue           float64     `json:"revenue" bson:"revenue"`
+	AverageOrderValue float64     `json:"averageOrderValue" bson:"averageOrderValue"`
+}
+
+// salesReport is the response of the sales report
+type salesReport struct {
+	GroupBy string       `json:"groupBy"`
+	Status  string       `json:"status,omitempty"`
+	Range   reportRange  `json:"range"`
+	Groups  []salesGroup `json:"groups"`
+	Totals  salesGroup   `json:"totals"`
+}
+
+// Sales handles GET requests for sales totals grouped by status, product, customer or time bucket.
+// Query parameters: groupBy (status|product|customer|day|week|month), from, to, tz and status.
+func (reportsHandler *ReportsHandler) Sales(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		errorHandling.ThrowError(r.Context(), w, http.StatusMethodNotAllowed, "Invalid request method. Needs to be GET", nil)
+		return
+	}
+
+	groupBy := r.URL.Query().Get("groupBy")
+	if groupBy == "" {
+		groupBy = "status"
+	}
+
+	var groupKey interface{}
+	switch groupBy {
+	case "status", "product", "customer":
+		groupKey = "$" + groupBy
+	case "day", "week", "month":
+		// Bucket keys are formatted below once the timezone is known
+	default:
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid groupBy. Needs to be status, product, customer, day, week or month", nil)
+		return
+	}
+
+	dateRange, err := parseReportRange(r)
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	if format, ok := reportBuckets[groupBy]; ok {
+		groupKey = bson.D{{Key: "$dateToString", Value: bson.D{
+			{Key: "date", Value: "$createdAt"},
+			{Key: "format", Value: format},
+			{Key: "timezone", Value: dateRange.Timezone},
+		}}}
+	}
+
+	status := r.URL.Query().Get("status")
+	pipeline := salesMatchPipeline(dateRange, status)
+	pipeline = append(pipeline,
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: groupKey},
+			{Key: "orders", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "quantity", Value: bson.D{{Key: "$sum", Value: "$amount"}}},
+			{Key: "revenue", Value: bson.D{{Key: "$sum", Value: "$sum"}}},
+			{Key: "averageOrderValue", Value: bson.D{{Key: "$avg", Value: "$sum"}}},
+		}}},
+	)
+	// Resolve product and customer names for readable reports
+	if groupBy == "product" || groupBy == "customer" {
+		pipeline = append(pipeline, nameLookupStages(groupBy)...)
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}})
+
+	db := db.DbConnect()
+	defer db.DbDisconnect()
+	collection := db.Client.Database(dbName).Collection(ordersCollection)
+
+	cursor, err := collection.Aggregate(r.Context(), pipeline)
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to aggregate orders", err)
+		return
+	}
+	defer cursor.Close(r.Context())
+
+	groups := []salesGroup{}
+	if err := cursor.All(r.Context(), &groups); err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to decode aggregation result", err)
+		return
+	}
+
+	report := salesReport{GroupBy: groupBy, Status: status, Range: dateRange, Groups: groups}
+	for _, group := range groups {
+		report.Totals.Orders += group.Orders
+		report.Totals.Quantity += group.Quantity
+		report.Totals.Revenue += group.Revenue
+	}
+	if report.Totals.Orders > 0 {
+		report.Totals.AverageOrderValue = report.Totals.Revenue / float64(report.Totals.Orders)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
+
+// parseReportRange reads from, to and tz. Dates without time are interpreted in tz
+// and to is inclusive of that whole day; RFC 3339 timestamps are used as given.
+func parseReportRange(r *http.Request) (reportRange, error) {
+	dateRange := reportRange{Timezone: "UTC"}
+	if tz := r.URL.Query().Get("tz"); tz != "" {
+		dateRange.Timezone = tz
+	}
+	// Local is the timezone of the server, which Mongo does not know
+	location, err := time.LoadLocation(dateRange.Timezone)
+	if err != nil || dateRange.Timezone == "Local" {
+		return dateRange, errors.New("Invalid tz. Needs to be an IANA timezone such as Europe/Kyiv")
+	}
+
+	parse := func(name string, endOfDay bool) (*time.Time, error) {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			return nil, nil
+		}
+		if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+			return &parsed, nil
+		}
+		parsed, err := time.ParseInLocation("2006-01-02", value, location)
+		if err != nil {
+			return nil, errors.New("Invalid " + name + ". Needs to be YYYY-MM-DD or RFC 3339")
+		}
+		if endOfDay {
+			parsed = parsed.AddDate(0, 0, 1)
+		}
+		return &parsed, nil
+	}
+
+	if dateRange.From, err = parse("from", false); err != nil {
+		return dateRange, err
+	}
+	if dateRange.To, err = parse("to", true); err != nil {
+		return dateRange, err
+	}
+	if dateRange.From != nil && dateRange.To != nil && !dateRange.From.Before(*dateRange.To) {
+		return dateRange, errors.New("Invalid range. from needs to be before to")
+	}
+	return dateRange, nil
+}
+
+// reportMatchPipeline derives the order date from its ObjectId and filters by date range and status
+func reportMatchPipeline(dateRange reportRange, status string) mongo.Pipeline {
+	match := bson.D{}
+	createdAt := bson.D{}
+	if dateRange.From != nil {
+		createdAt = append(createdAt, bson.E{Key: "$gte", Value: *dateRange.From})
+	}
+	if dateRange.To != nil {
+		createdAt = append(createdAt, bson.E{Key: "$lt", Value: *dateRange.To})
+	}
+	if len(createdAt) > 0 {
+		match = append(match, bson.E{Key: "createdAt", Value: createdAt})
+	}
+	if status != "" {
+		match = append(match, bson.E{Key: "status", Value: status})
+	}
+
+	return mongo.Pipeline{
+		bson.D{{Key: "$addFields", Value: bson.D{{Key: "createdAt", Value: bson.D{{Key: "$toDate", Value: "$_id"}}}}}},
+		bson.D{{Key: "$match", Value: match}},
+	}
+}
+
+// salesMatchPipeline filters the orders of the sales report. Without a status cancelled orders
+// are left out, so revenue, quantity and average order value only count orders that still stand.
+func salesMatchPipeline(dateRange reportRange, status string) mongo.Pipeline {
+	pipeline := reportMatchPipeline(dateRange, status)
+	if status == "" {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.D{{Key: "status", Value: bson.D{{Key: "$ne", Value: "cancelled"}}}}}})
+	}
+	return pipeline
+}
+
+// nameLookupStages adds the name of the grouped product or customer to each group
+func nameLookupStages(groupBy string) []bson.D {
+	from := "products"
+	if groupBy == "customer" {
+		from = customerCollection
+	}
+	return []bson.D{
+		{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: from},
+			{Key: "localField", Value: "_id"},
+			{Key: "foreignField", Value: "_id"},
+			{Key: "as", Value: "reference"},
+		}}},
+		{{Key: "$addFields", Value: bson.D{{Key: "name", Value: bson.D{{Key: "$arrayElemAt", Value: bson.A{"$reference.name", 0}}}}}}},
+		{{Key: "$project", Value: bson.D{{Key: "reference", Value: 0}}}},
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseReportRange(t *testing.T) {
+	kyiv, err := time.LoadLocation("Europe/Kyiv")
+	if err != nil {
+		t.Skip("timezone database is not available")
+	}
+	date := func(year int, month time.Month, day int, location *time.Location) *time.Time {
+		value := time.Date(year, month, day, 0, 0, 0, 0, location)
+		return &value
+	}
+
+	tests := []struct {
+		query    string
+		timezone string
+		from, to *time.Time
+		err      bool
+	}{
+		{query: "", timezone: "UTC"},
+		{query: "?from=2024-03-01&to=2024-03-31", timezone: "UTC",
+			from: date(2024, time.March, 1, time.UTC), to: date(2024, time.April, 1, time.UTC)},
+		{query: "?from=2024-03-01&tz=Europe/Kyiv", timezone: "Europe/Kyiv", from: date(2024, time.March, 1, kyiv)},
+		{query: "?to=2024-03-01T12:00:00Z&tz=Europe/Kyiv", timezone: "Europe/Kyiv",
+			to: func() *time.Time { value := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC); return &value }()},
+		{query: "?from=2024-03-01&to=2024-03-01", timezone: "UTC",
+			from: date(2024, time.March, 1, time.UTC), to: date(2024, time.March, 2, time.UTC)},
+		{query: "?from=2024-03-02&to=2024-03-01", err: true},
+		{query: "?from=2024-03-01T00:00:00Z&to=2024-03-01T00:00:00Z", err: true},
+		{query: "?from=01.03.2024", err: true},
+		{query: "?tz=Local", err: true},
+		{query: "?tz=Mars/Olympus", err: true},
+	}
+	for _, test := range tests {
+		dateRange, err := parseReportRange(httptest.NewRequest(http.MethodGet, "/reports/sales"+test.query, nil))
+		if (err != nil) != test.err {
+			t.Errorf("%q: got error %v, want error %v", test.query, err, test.err)
+			continue
+		}
+		if test.err {
+			continue
+		}
+		if dateRange.Timezone != test.timezone {
+			t.Errorf("%q: got timezone %s, want %s", test.query, dateRange.Timezone, test.timezone)
+		}
+		if !sameTime(dateRange.From, test.from) || !sameTime(dateRange.To, test.to) {
+			t.Errorf("%q: got range %v - %v, want %v - %v", test.query, dateRange.From, dateRange.To, test.from, test.to)
+		}
+	}
+}
+
+func TestSalesMatchPipelineExcludesCancelled(t *testing.T) {
+	excludeCancelled := bson.D{{Key: "$match", Value: bson.D{{Key: "status", Value: bson.D{{Key: "$ne", Value: "cancelled"}}}}}}
+
+	pipeline := salesMatchPipeline(reportRange{Timezone: "UTC"}, "")
+	if last := pipeline[len(pipeline)-1]; !reflect.DeepEqual(last, excludeCancelled) {
+		t.Errorf("got last stage %v without status, want %v", last, excludeCancelled)
+	}
+
+	pipeline = salesMatchPipeline(reportRange{Timezone: "UTC"}, "cancelled")
+	for _, stage := range pipeline {
+		if reflect.DeepEqual(stage, excludeCancelled) {
+			t.Error("cancelled orders are excluded although they were requested")
+		}
+	}
+}
+
+func sameTime(got, want *time.Time) bool {
+	if got == nil || want == nil {
+		return got == want
+	}
+	return got.Equal(*want)
+}
@@ -0,0 +1,504 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/DanVerh/university-swe/backend/api/audit"
+	"github.com/DanVerh/university-swe/backend/api/db"
+	"github.com/DanVerh/university-swe/backend/api/errorHandling"
+	"github.com/DanVerh/university-swe/backend/api/outbox"
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Errors of orders for products with variants
+var (
+	errVariantNotFound = errors.New("Variant does not exist")
+	errOutOfStock      = errors.New("Not enough stock of the variant")
+)
+
+// errVariantsMismatch is returned when the options of a product no longer fit its variants
+var errVariantsMismatch = errors.New("Existing variants do not fit the options. Update or delete them first")
+
+// ProductOption is an option axis of a product, e.g. size with the values S, M and L
+type ProductOption struct {
+	Name   string   `json:"name" bson:"name"`
+	Values []string `json:"values" bson:"values"`
+}
+
+// Variant is a sellable combination of option values of a product with its own SKU and stock.
+// Without a price override the variant sells at the product price.
+type Variant struct {
+	ID primitive.ObjectID `json:"id" bson:"_id"`
+	// SKU is unique across all variants
+	SKU string `json:"sku" bson:"sku"`
+	// Options maps every option name of the product to one of its values
+	Options map[string]string `json:"options" bson:"options"`
+	Price   *float64          `json:"price,omitempty" bson:"price,omitempty"`
+	Amount  int32             `json:"amount" bson:"amount"`
+}
+
+// stockChange is a change of the stock of a variant, negative for a reservation by an order
+type stockChange struct {
+	product primitive.ObjectID
+	variant primitive.ObjectID
+	delta   int32
+}
+
+// ListVariants handles GET requests for the variants of a product
+func (productHandler *ProductsHandler) ListVariants(w http.ResponseWriter, r *http.Request) {
+	objectID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid ObjectId format", nil)
+		return
+	}
+
+	db := db.DbConnect()
+	defer db.DbDisconnect()
+
+	var product Product
+	err = db.Client.Database(dbName).Collection("products").FindOne(r.Context(), bson.M{"_id": objectID},
+		options.FindOne().SetProjection(bson.M{"variants": 1})).Decode(&product)
+	if err == mongo.ErrNoDocuments {
+		errorHandling.ThrowError(r.Context(), w, http.StatusNotFound, "No product found with the given ID", nil)
+		return
+	}
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to retrieve product", err)
+		return
+	}
+
+	variants := product.Variants
+	if variants == nil {
+		variants = []Variant{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(variants)
+}
+
+// SetOptions handles PUT requests to replace the option axes of a product.
+// The existing variants need to fit the new options.
+func (productHandler *ProductsHandler) SetOptions(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Options []ProductOption `json:"options"`
+	}
+	productHandler.changeVariants(w, r, &body, func(product *Product) (*Variant, []stockChange, error) {
+		if err := validateOptions(body.Options); err != nil {
+			return nil, nil, invalid(err)
+		}
+		product.Options = body.Options
+		for i := range product.Variants {
+			if err := validateVariant(product, &product.Variants[i]); err != nil {
+				return nil, nil, errVariantsMismatch
+			}
+		}
+		return nil, nil, nil
+	})
+}
+
+// CreateVariant handles POST requests to add a variant to a product
+func (productHandler *ProductsHandler) CreateVariant(w http.ResponseWriter, r *http.Request) {
+	var variant Variant
+	productHandler.changeVariants(w, r, &variant, func(product *Product) (*Variant, []stockChange, error) {
+		variant.ID = primitive.NewObjectID()
+		if err := validateVariant(product, &variant); err != nil {
+			return nil, nil, invalid(err)
+		}
+		product.Variants = append(product.Variants, variant)
+		return &variant, nil, nil
+	})
+}
+
+// UpdateVariant handles PUT requests to change the SKU, options, price override or stock of a variant.
+// A null price removes the override.
+func (productHandler *ProductsHandler) UpdateVariant(w http.ResponseWriter, r *http.Request) {
+	variantID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "variantId"))
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid variant ObjectId format", nil)
+		return
+	}
+
+	// The price stays raw to tell a missing price from null
+	var body struct {
+		SKU     *string           `json:"sku"`
+		Options map[string]string `json:"options"`
+		Price   json.RawMessage   `json:"price"`
+		Amount  *int32            `json:"amount"`
+	}
+	productHandler.changeVariants(w, r, &body, func(product *Product) (*Variant, []stockChange, error) {
+		variant := findVariant(product, variantID)
+		if variant == nil {
+			return nil, nil, errVariantNotFound
+		}
+		if body.SKU != nil {
+			variant.SKU = *body.SKU
+		}
+		if body.Options != nil {
+			variant.Options = body.Options
+		}
+		if len(body.Price) > 0 {
+			variant.Price = nil
+			if err := json.Unmarshal(body.Price, &variant.Price); err != nil {
+				return nil, nil, invalid(errors.New("Invalid type for 'price'. Expected a number or null."))
+			}
+		}
+		var changes []stockChange
+		if body.Amount != nil && *body.Amount != variant.Amount {
+			changes = append(changes, stockChange{product: product.ID, variant: variantID, delta: *body.Amount - variant.Amount})
+			variant.Amount = *body.Amount
+		}
+		if err := validateVariant(product, variant); err != nil {
+			return nil, nil, invalid(err)
+		}
+		return variant, changes, nil
+	})
+}
+
+// DeleteVariant handles DELETE requests to remove a variant. Orders keep referencing it.
+func (productHandler *ProductsHandler) DeleteVariant(w http.ResponseWriter, r *http.Request) {
+	variantID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "variantId"))
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid variant ObjectId format", nil)
+		return
+	}
+
+	productHandler.changeVariants(w, r, nil, func(product *Product) (*Variant, []stockChange, error) {
+		for i, variant := range product.Variants {
+			if variant.ID == variantID {
+				product.Variants = append(product.Variants[:i], product.Variants[i+1:]...)
+				return &variant, nil, nil
+			}
+		}
+		return nil, nil, errVariantNotFound
+	})
+}
+
+// changeVariants decodes the body of a change of the options or variants of a product, applies it
+// in a transaction with the stock events and responds with the changed variant, or the product
+// when change returns no variant. Deleted variants are answered with a text confirmation.
+func (productHandler *ProductsHandler) changeVariants(w http.ResponseWriter, r *http.Request, body interface{},
+	change func(product *Product) (*Variant, []stockChange, error)) {
+	objectID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid ObjectId format", nil)
+		return
+	}
+	if body != nil {
+		if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+			errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid request body", nil)
+			return
+		}
+	}
+
+	db := db.DbConnect()
+	defer db.DbDisconnect()
+	database := db.Client.Database(dbName)
+
+	var before, after Product
+	var variant *Variant
+	err = outbox.Transact(r.Context(), db.Client, func(sessionCtx mongo.SessionContext) error {
+		collection := database.Collection("products")
+		if err := collection.FindOne(sessionCtx, bson.M{"_id": objectID}).Decode(&before); err != nil {
+			return err
+		}
+		// The change works on a copy of the variants so before stays intact for the audit trail
+		after = before
+		after.Variants = append([]Variant(nil), before.Variants...)
+
+		var changes []stockChange
+		var err error
+		variant, changes, err = change(&after)
+		if err != nil {
+			return err
+		}
+		if variant != nil && r.Method != http.MethodDelete {
+			others := bson.M{"_id": bson.M{"$ne": objectID}}
+			if err := checkProductIdentifiers(sessionCtx, database, others, []string{variant.SKU}, ""); err != nil {
+				return err
+			}
+		}
+		_, err = collection.UpdateOne(sessionCtx, bson.M{"_id": objectID},
+			bson.M{"$set": bson.M{"options": after.Options, "variants": after.Variants}})
+		if err != nil {
+			return err
+		}
+		return outbox.Add(sessionCtx, database, variantStockEvents(&before, changes)...)
+	})
+	switch {
+	case isInvalid(err):
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, err.Error(), nil)
+		return
+	case err == mongo.ErrNoDocuments:
+		errorHandling.ThrowError(r.Context(), w, http.StatusNotFound, "No product found with the given ID", nil)
+		return
+	case err == errVariantNotFound:
+		errorHandling.ThrowError(r.Context(), w, http.StatusNotFound, err.Error(), nil)
+		return
+	case err == errVariantsMismatch:
+		errorHandling.ThrowError(r.Context(), w, http.StatusConflict, err.Error(), nil)
+		return
+	case err == errSKUTaken || mongo.IsDuplicateKeyError(err):
+		errorHandling.ThrowError(r.Context(), w, http.StatusConflict, errSKUTaken.Error(), nil)
+		return
+	case err != nil:
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to change product variants", err)
+		return
+	}
+	audit.Write(r.Context(), database, "products", objectID, audit.OperationUpdate, before, after)
+
+	if r.Method == http.MethodDelete {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(fmt.Sprintf("Deleted variant with ID: %v", variant.ID.Hex())))
+		return
+	}
+	status := http.StatusOK
+	if r.Method == http.MethodPost {
+		status = http.StatusCreated
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if variant != nil {
+		json.NewEncoder(w).Encode(variant)
+	} else {
+		json.NewEncoder(w).Encode(after)
+	}
+}
+
+// validateOptions checks that the option axes and their values are named and unique
+func validateOptions(productOptions []ProductOption) error {
+	names := map[string]bool{}
+	for _, option := range productOptions {
+		if strings.TrimSpace(option.Name) == "" || len(option.Values) == 0 {
+			return errors.New("Every option needs a name and values")
+		}
+		if names[option.Name] {
+			return fmt.Errorf("Duplicate option %s", option.Name)
+		}
+		names[option.Name] = true
+		values := map[string]bool{}
+		for _, value := range option.Values {
+			if strings.TrimSpace(value) == "" || values[value] {
+				return fmt.Errorf("Values of option %s need to be unique and not empty", option.Name)
+			}
+			values[value] = true
+		}
+	}
+	return nil
+}
+
+// validateVariant checks a variant against the options and the other variants of its product
+func validateVariant(product *Product, variant *Variant) error {
+	variant.SKU = strings.TrimSpace(variant.SKU)
+	if variant.SKU == "" {
+		return errors.New("SKU is required")
+	}
+	if err := validateSKU(variant.SKU); err != nil {
+		return err
+	}
+	if variant.SKU == product.SKU {
+		return errors.New("SKU is already used by the product")
+	}
+	if variant.Price != nil && *variant.Price <= 0 {
+		return errors.New("Price override must be positive")
+	}
+	if variant.Amount < 0 {
+		return errors.New("Amount must not be negative")
+	}
+
+	if len(product.Options) == 0 {
+		return errors.New("The product has no options. Set them before adding variants")
+	}
+	if len(variant.Options) != len(product.Options) {
+		return fmt.Errorf("Options need one value for each of: %s", optionNames(product.Options))
+	}
+	for _, option := range product.Options {
+		value, ok := variant.Options[option.Name]
+		if !ok {
+			return fmt.Errorf("Options need one value for each of: %s", optionNames(product.Options))
+		}
+		if !containsString(option.Values, value) {
+			return fmt.Errorf("Invalid value %q for option %s", value, option.Name)
+		}
+	}
+
+	for _, other := range product.Variants {
+		if other.ID == variant.ID {
+			continue
+		}
+		if other.SKU == variant.SKU {
+			return errors.New("SKU is already used by another variant")
+		}
+		if sameOptions(other.Options, variant.Options) {
+			return errors.New("Another variant has the same options")
+		}
+	}
+	return nil
+}
+
+// validateVariants assigns IDs to the variants of a new product and checks them
+func validateVariants(product *Product) error {
+	if err := validateOptions(product.Options); err != nil {
+		return err
+	}
+	for i := range product.Variants {
+		product.Variants[i].ID = primitive.NewObjectID()
+	}
+	for i := range product.Variants {
+		if err := validateVariant(product, &product.Variants[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func optionNames(productOptions []ProductOption) string {
+	names := make([]string, len(productOptions))
+	for i, option := range productOptions {
+		names[i] = option.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+func sameOptions(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, value := range a {
+		if b[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// findVariant returns the variant of the product with the ID, nil if there is none
+func findVariant(product *Product, id primitive.ObjectID) *Variant {
+	for i := range product.Variants {
+		if product.Variants[i].ID == id {
+			return &product.Variants[i]
+		}
+	}
+	return nil
+}
+
+// orderVariant returns the variant an order references. Orders of products with variants
+// need a variant; orders of other products must not have one.
+func orderVariant(product *Product, id *primitive.ObjectID) (*Variant, error) {
+	if len(product.Variants) == 0 {
+		if id != nil {
+			return nil, errVariantNotFound
+		}
+		return nil, nil
+	}
+	if id == nil {
+		return nil, invalid(errors.New("Missing required field: variant. The product has variants"))
+	}
+	variant := findVariant(product, *id)
+	if variant == nil {
+		return nil, errVariantNotFound
+	}
+	return variant, nil
+}
+
+// unitPrice is the price of the variant, or of the product without a variant or price override
+func unitPrice(product *Product, variant *Variant) float64 {
+	if variant != nil && variant.Price != nil {
+		return *variant.Price
+	}
+	return product.Price
+}
+
+// applyStockChange changes the stock of a variant and returns the StockAdjusted event.
+// A reservation fails with errOutOfStock unless the variant has enough stock. Releasing stock
+// of a deleted variant does nothing and returns no event.
+func applyStockChange(ctx context.Context, database *mongo.Database, change stockChange) ([]outbox.Event, error) {
+	match := bson.M{"_id": change.variant}
+	if change.delta < 0 {
+		match["amount"] = bson.M{"$gte": -change.delta}
+	}
+	var product Product
+	err := database.Collection("products").FindOneAndUpdate(ctx,
+		bson.M{"_id": change.product, "variants": bson.M{"$elemMatch": match}},
+		bson.M{"$inc": bson.M{"variants.$.amount": change.delta}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"variants": 1}),
+	).Decode(&product)
+	if err == mongo.ErrNoDocuments {
+		if change.delta < 0 {
+			return nil, errOutOfStock
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	variant := findVariant(&product, change.variant)
+	if variant == nil {
+		return nil, nil
+	}
+	before := product
+	before.Variants = []Variant{*variant}
+	before.Variants[0].Amount -= change.delta
+	return variantStockEvents(&before, []stockChange{change}), nil
+}
+
+// variantStockEvents returns the StockAdjusted events of stock changes, given the product before them
+func variantStockEvents(before *Product, changes []stockChange) []outbox.Event {
+	var events []outbox.Event
+	for _, change := range changes {
+		variant := findVariant(before, change.variant)
+		if variant == nil || change.delta == 0 {
+			continue
+		}
+		from := int64(variant.Amount)
+		to := from + int64(change.delta)
+		variantID := change.variant
+		events = append(events, outbox.Event{Type: outbox.StockAdjusted, AggregateType: outbox.AggregateProduct, AggregateID: change.product,
+			Data: stockAdjustment{ID: change.product, Variant: &variantID, From: from, To: to, Delta: to - from}})
+	}
+	return events
+}
+
+// orderStockChanges returns the stock changes of an order moving from one line and status to another:
+// the stock of the old line is released and the stock of the new line reserved, unless cancelled.
+// before or after are nil for created and deleted orders.
+func orderStockChanges(before, after *Order) []stockChange {
+	var changes []stockChange
+	if before != nil && before.Variant != nil && before.Status != "cancelled" {
+		changes = append(changes, stockChange{product: before.Product, variant: *before.Variant, delta: before.Amount})
+	}
+	if after != nil && after.Variant != nil && after.Status != "cancelled" {
+		changes = append(changes, stockChange{product: after.Product, variant: *after.Variant, delta: -after.Amount})
+	}
+	// A reservation that stays is not released and taken again
+	if len(changes) == 2 && changes[0].product == changes[1].product && changes[0].variant == changes[1].variant {
+		delta := changes[0].delta + changes[1].delta
+		if delta == 0 {
+			return nil
+		}
+		return []stockChange{{product: changes[0].product, variant: changes[0].variant, delta: delta}}
+	}
+	return changes
+}
+
+// reserveOrderStock applies the stock changes of an order change and returns their events
+func reserveOrderStock(ctx context.Context, database *mongo.Database, before, after *Order) ([]outbox.Event, error) {
+	var events []outbox.Event
+	for _, change := range orderStockChanges(before, after) {
+		changeEvents, err := applyStockChange(ctx, database, change)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, changeEvents...)
+	}
+	return events, nil
+}
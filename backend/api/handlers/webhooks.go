@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/DanVerh/university-swe/backend/api/audit"
+	"github.com/DanVerh/university-swe/backend/api/db"
+	"github.com/DanVerh/university-swe/backend/api/errorHandling"
+	"github.com/DanVerh/university-swe/backend/api/webhooks"
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Default and maximum number of deliveries returned at once
+const (
+	defaultDeliveriesLimit = 50
+	maxDeliveriesLimit     = 500
+)
+
+// WebhooksHandler handles requests for webhook subscriptions and their delivery log
+type WebhooksHandler struct{}
+
+// Create handles POST requests to subscribe a URL to order events.
+// The response contains the signing secret, which is not returned again.
+func (webhooksHandler *WebhooksHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var subscription webhooks.Subscription
+	if err := json.NewDecoder(r.Body).Decode(&subscription); err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid JSON", nil)
+		return
+	}
+	if err := validateSubscription(&subscription); err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to generate the signing secret", err)
+		return
+	}
+	subscription.ID = primitive.NewObjectID()
+	subscription.Secret = secret
+	subscription.Active = true
+	subscription.CreatedAt = time.Now().UTC()
+
+	db := db.DbConnect()
+	defer db.DbDisconnect()
+	database := db.Client.Database(dbName)
+
+	if _, err := database.Collection(webhooks.Collection).InsertOne(r.Context(), subscription); err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to insert the webhook into the database", err)
+		return
+	}
+	// The secret stays out of the audit trail
+	audit.Write(r.Context(), database, webhooks.Collection, subscription.ID, audit.OperationCreate, nil, withoutSecret(subscription))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(subscription)
+}
+
+// List handles GET requests to list the webhook subscriptions
+func (webhooksHandler *WebhooksHandler) List(w http.ResponseWriter, r *http.Request) {
+	db := db.DbConnect()
+	defer db.DbDisconnect()
+
+	cursor, err := db.Client.Database(dbName).Collection(webhooks.Collection).Find(r.Context(), bson.M{},
+		options.Find().SetProjection(bson.M{"secret": 0}))
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to retrieve documents from the database", err)
+		return
+	}
+	defer cursor.Close(r.Context())
+
+	subscriptions := []webhooks.Subscription{}
+	if err := cursor.All(r.Context(), &subscriptions); err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to decode documents", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(subscriptions)
+}
+
+// GetByID handles GET requests to retrieve a single webhook subscription
+func (webhooksHandler *WebhooksHandler) GetByID(w http.ResponseWriter, r *http.Request) {
+	objectID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid ObjectId format", nil)
+		return
+	}
+
+	db := db.DbConnect()
+	defer db.DbDisconnect()
+
+	var subscription webhooks.Subscription
+	err = db.Client.Database(dbName).Collection(webhooks.Collection).FindOne(r.Context(), bson.M{"_id": objectID}).Decode(&subscription)
+	if err == mongo.ErrNoDocuments {
+		errorHandling.ThrowError(r.Context(), w, http.StatusNotFound, "No webhook found with the given ID", nil)
+		return
+	}
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to retrieve webhook", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(withoutSecret(subscription))
+}
+
+// UpdateByID handles PUT requests to change the url, events, statuses or active flag of a subscription.
+// Deliveries that come due while a subscription is paused are dead-lettered.
+func (webhooksHandler *WebhooksHandler) UpdateByID(w http.ResponseWriter, r *http.Request) {
+	objectID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid ObjectId format", nil)
+		return
+	}
+
+	var update struct {
+		URL      *string   `json:"url"`
+		Events   *[]string `json:"events"`
+		Statuses *[]string `json:"statuses"`
+		Active   *bool     `json:"active"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid request body", nil)
+		return
+	}
+
+	db := db.DbConnect()
+	defer db.DbDisconnect()
+	database := db.Client.Database(dbName)
+	collection := database.Collection(webhooks.Collection)
+
+	var before webhooks.Subscription
+	err = collection.FindOne(r.Context(), bson.M{"_id": objectID}).Decode(&before)
+	if err == mongo.ErrNoDocuments {
+		errorHandling.ThrowError(r.Context(), w, http.StatusNotFound, "No webhook found with the provided ID", nil)
+		return
+	}
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to retrieve webhook", err)
+		return
+	}
+
+	after := before
+	if update.URL != nil {
+		after.URL = *update.URL
+	}
+	if update.Events != nil {
+		after.Events = *update.Events
+	}
+	if update.Statuses != nil {
+		after.Statuses = *update.Statuses
+	}
+	if update.Active != nil {
+		after.Active = *update.Active
+	}
+	if err := validateSubscription(&after); err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	set := bson.M{"url": after.URL, "events": after.Events, "statuses": after.Statuses, "active": after.Active}
+	if _, err := collection.UpdateOne(r.Context(), bson.M{"_id": objectID}, bson.M{"$set": set}); err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to update webhook", err)
+		return
+	}
+	audit.Write(r.Context(), database, webhooks.Collection, objectID, audit.OperationUpdate, withoutSecret(before), withoutSecret(after))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(withoutSecret(after))
+}
+
+// DeleteByID handles DELETE requests to remove a subscription. Its delivery log is kept.
+func (webhooksHandler *WebhooksHandler) DeleteByID(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid ObjectId format", nil)
+		return
+	}
+
+	db := db.DbConnect()
+	defer db.DbDisconnect()
+	database := db.Client.Database(dbName)
+
+	var before webhooks.Subscription
+	err = database.Collection(webhooks.Collection).FindOneAndDelete(r.Context(), bson.M{"_id": objectID}).Decode(&before)
+	if err == mongo.ErrNoDocuments {
+		errorHandling.ThrowError(r.Context(), w, http.StatusNotFound, fmt.Sprintf("No webhook found with the provided ID: %v", id), nil)
+		return
+	}
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to delete webhook", err)
+		return
+	}
+	audit.Write(r.Context(), database, webhooks.Collection, objectID, audit.OperationDelete, withoutSecret(before), nil)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf("Deleted webhook with ID: %v", id)))
+}
+
+// Deliveries handles GET requests for the delivery log of a subscription, newest first.
+// Query parameters: status (pending|delivered|dead) and limit.
+func (webhooksHandler *WebhooksHandler) Deliveries(w http.ResponseWriter, r *http.Request) {
+	objectID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid ObjectId format", nil)
+		return
+	}
+
+	filter := bson.M{"webhook": objectID}
+	if status := r.URL.Query().Get("status"); status != "" {
+		if status != webhooks.StatusPending && status != webhooks.StatusDelivered && status != webhooks.StatusDead {
+			errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid status. Needs to be pending, delivered or dead", nil)
+			return
+		}
+		filter["status"] = status
+	}
+	limit := defaultDeliveriesLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxDeliveriesLimit {
+			errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid limit. Needs to be between 1 and 500", nil)
+			return
+		}
+		limit = parsed
+	}
+
+	db := db.DbConnect()
+	defer db.DbDisconnect()
+
+	cursor, err := db.Client.Database(dbName).Collection(webhooks.DeliveriesCollection).Find(r.Context(), filter,
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(int64(limit)))
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to retrieve deliveries", err)
+		return
+	}
+	defer cursor.Close(r.Context())
+
+	deliveries := []webhooks.Delivery{}
+	if err := cursor.All(r.Context(), &deliveries); err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to decode deliveries", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// Redeliver handles POST requests to queue a finished delivery again, e.g. a dead-lettered one
+// after the receiver was fixed. It gets a fresh set of attempts; earlier attempts stay in the log.
+func (webhooksHandler *WebhooksHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	webhookID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid ObjectId format", nil)
+		return
+	}
+	deliveryID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "deliveryId"))
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusBadRequest, "Invalid ObjectId format", nil)
+		return
+	}
+
+	db := db.DbConnect()
+	defer db.DbDisconnect()
+
+	result, err := db.Client.Database(dbName).Collection(webhooks.DeliveriesCollection).UpdateOne(r.Context(),
+		bson.M{"_id": deliveryID, "webhook": webhookID, "status": bson.M{"$ne": webhooks.StatusPending}},
+		bson.M{"$set": bson.M{"status": webhooks.StatusPending, "nextAttemptAt": time.Now().UTC(), "attemptCount": 0}})
+	if err != nil {
+		errorHandling.ThrowError(r.Context(), w, http.StatusInternalServerError, "Failed to queue the delivery", err)
+		return
+	}
+	if result.MatchedCount == 0 {
+		errorHandling.ThrowError(r.Context(), w, http.StatusNotFound, "No finished delivery found with the provided ID", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte(fmt.Sprintf("Delivery %v queued", deliveryID.Hex())))
+}
+
+// validateSubscription checks the URL, event types and order statuses of a subscription
+func validateSubscription(subscription *webhooks.Subscription) error {
+	if err := subscription.Validate(); err != nil {
+		return err
+	}
+	for _, status := range subscription.Statuses {
+		if !validOrderStatus(status) {
+			return errors.New("Invalid status " + strconv.Quote(status))
+		}
+	}
+	return nil
+}
+
+// withoutSecret returns the subscription with the signing secret removed
+func withoutSecret(subscription webhooks.Subscription) webhooks.Subscription {
+	subscription.Secret = ""
+	return subscription
+}
@@ -2,16 +2,36 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"log/slog"
+	"os"
 
 	"github.com/DanVerh/university-swe/backend/api/application"
+	"github.com/DanVerh/university-swe/backend/api/logging"
+	"github.com/DanVerh/university-swe/backend/api/tracing"
 )
 
 func main() {
+	ctx := context.Background()
+
+	// The default logger writes the error when the configured one could not be set up
+	if err := logging.Setup(); err != nil {
+		slog.ErrorContext(ctx, "failed to configure logging", "error", err)
+		os.Exit(1)
+	}
+
+	shutdownTracing, err := tracing.Setup(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to configure tracing", "error", err)
+		os.Exit(1)
+	}
+	defer shutdownTracing(ctx)
+
 	app := application.New()
 
-	err := app.Start(context.TODO())
+	err = app.Start(ctx)
 	if err != nil {
-		fmt.Println("failed to start app:", err)
+		slog.ErrorContext(ctx, "failed to start app", "error", err)
+		shutdownTracing(ctx)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+var (
+	mongoCommandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mongodb_command_duration_seconds",
+		Help:    "MongoDB command latency by command name and outcome.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"command", "status"})
+
+	mongoConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "mongodb_pool_connections",
+		Help: "Number of open MongoDB connections.",
+	})
+
+	mongoConnectionsInUse = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "mongodb_pool_connections_in_use",
+		Help: "Number of MongoDB connections checked out of the pool.",
+	})
+
+	mongoPoolEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mongodb_pool_events_total",
+		Help: "Number of MongoDB connection pool events by type.",
+	}, []string{"type"})
+)
+
+// CommandMonitor records the duration of every MongoDB command
+func CommandMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Succeeded: func(_ context.Context, succeeded *event.CommandSucceededEvent) {
+			observeCommand(succeeded.CommandName, "success", succeeded.Duration)
+		},
+		Failed: func(_ context.Context, failed *event.CommandFailedEvent) {
+			observeCommand(failed.CommandName, "failure", failed.Duration)
+		},
+	}
+}
+
+// PoolMonitor tracks open and checked out connections of every MongoDB client
+func PoolMonitor() *event.PoolMonitor {
+	return &event.PoolMonitor{
+		Event: func(poolEvent *event.PoolEvent) {
+			mongoPoolEvents.WithLabelValues(poolEvent.Type).Inc()
+			switch poolEvent.Type {
+			case event.ConnectionCreated:
+				mongoConnections.Inc()
+			case event.ConnectionClosed:
+				mongoConnections.Dec()
+			case event.GetSucceeded:
+				mongoConnectionsInUse.Inc()
+			case event.ConnectionReturned:
+				mongoConnectionsInUse.Dec()
+			}
+		},
+	}
+}
+
+func observeCommand(command, status string, duration time.Duration) {
+	mongoCommandDuration.WithLabelValues(command, status).Observe(duration.Seconds())
+}
@@ -0,0 +1,155 @@
+package openapi
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Schema is a JSON schema as used by OpenAPI 3.0
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	ExclusiveMinimum     bool               `json:"exclusiveMinimum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	ReadOnly             bool               `json:"readOnly,omitempty"`
+}
+
+var (
+	objectIDType = reflect.TypeOf(primitive.ObjectID{})
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// Ref returns a schema referencing the schema component
+func Ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// ArrayOf returns an array schema of the items
+func ArrayOf(items *Schema) *Schema {
+	return &Schema{Type: "array", Items: items}
+}
+
+// ObjectID is the schema of a MongoDB ObjectId as serialized to JSON
+func ObjectID() *Schema {
+	return &Schema{Type: "string", Pattern: "^[0-9a-fA-F]{24}$", Description: "MongoDB ObjectId"}
+}
+
+// SchemaOf derives the schema of a model from its Go type and json tags.
+// Fields with omitempty are optional; every other field is listed as required.
+func SchemaOf(model interface{}) *Schema {
+	return schemaOfType(reflect.TypeOf(model))
+}
+
+func schemaOfType(modelType reflect.Type) *Schema {
+	switch modelType {
+	case objectIDType:
+		return ObjectID()
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch modelType.Kind() {
+	case reflect.Ptr:
+		schema := schemaOfType(modelType.Elem())
+		schema.Nullable = true
+		return schema
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.Slice, reflect.Array:
+		if modelType.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return ArrayOf(schemaOfType(modelType.Elem()))
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaOfType(modelType.Elem())}
+	case reflect.Struct:
+		schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		addFields(schema, modelType)
+		return schema
+	}
+	// interface{} and anything else accepts any value
+	return &Schema{}
+}
+
+// addFields adds the exported fields of the struct, inlining embedded structs without a json name
+func addFields(schema *Schema, modelType reflect.Type) {
+	for i := 0; i < modelType.NumField(); i++ {
+		field := modelType.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		name := tag[0]
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			addFields(schema, field.Type)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema.Properties[name] = schemaOfType(field.Type)
+		if !containsOption(tag[1:], "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+// Without returns a copy of the object schema without the properties, e.g. to derive request bodies from models
+func (schema *Schema) Without(names ...string) *Schema {
+	copied := *schema
+	copied.Properties = map[string]*Schema{}
+	for name, property := range schema.Properties {
+		copied.Properties[name] = property
+	}
+	copied.Required = nil
+	for _, name := range schema.Required {
+		if !containsOption(names, name) {
+			copied.Required = append(copied.Required, name)
+		}
+	}
+	for _, name := range names {
+		delete(copied.Properties, name)
+	}
+	return &copied
+}
+
+// Optional returns a copy of the object schema where no property is required, e.g. for partial updates
+func (schema *Schema) Optional() *Schema {
+	copied := schema.Without()
+	copied.Required = nil
+	return copied
+}
+
+func containsOption(options []string, option string) bool {
+	for _, value := range options {
+		if value == option {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package outbox
+
+import (
+	"context"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of the in-process broker
+const (
+	memoryBrokerPartitions = 8
+	// Messages kept per partition for replays, older ones are dropped
+	memoryBrokerRetention = 10000
+	// Messages buffered per subscriber. A subscriber that falls behind misses messages
+	// and catches up with Messages, like a consumer reading from its last offset.
+	memoryBrokerBuffer = 256
+)
+
+// BrokerMessage is a message stored by the in-process broker
+type BrokerMessage struct {
+	Subject   string    `json:"subject"`
+	Key       string    `json:"key"`
+	Partition int       `json:"partition"`
+	Offset    int64     `json:"offset"`
+	Data      []byte    `json:"data"`
+	Time      time.Time `json:"time"`
+}
+
+// MemoryBroker is an in-process stand-in for NATS and Kafka, for development and tests.
+// Subscriptions match subjects like NATS, with * for one token and > for the rest;
+// messages are spread over partitions by key and numbered by offset like in Kafka,
+// so the messages of a key keep their order.
+type MemoryBroker struct {
+	mutex       sync.Mutex
+	partitions  [][]BrokerMessage
+	offsets     []int64
+	subscribers map[*brokerSubscriber]struct{}
+}
+
+type brokerSubscriber struct {
+	pattern  string
+	messages chan BrokerMessage
+}
+
+// NewMemoryBroker creates an empty broker
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		partitions:  make([][]BrokerMessage, memoryBrokerPartitions),
+		offsets:     make([]int64, memoryBrokerPartitions),
+		subscribers: map[*brokerSubscriber]struct{}{},
+	}
+}
+
+// Publish appends the message to the partition of its key and sends it to the matching subscribers
+func (broker *MemoryBroker) Publish(ctx context.Context, subject, key string, data []byte) error {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	partition := int(hash.Sum32() % memoryBrokerPartitions)
+
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	message := BrokerMessage{
+		Subject:   subject,
+		Key:       key,
+		Partition: partition,
+		Offset:    broker.offsets[partition],
+		Data:      append([]byte(nil), data...),
+		Time:      time.Now().UTC(),
+	}
+	broker.offsets[partition]++
+	broker.partitions[partition] = append(broker.partitions[partition], message)
+	if overflow := len(broker.partitions[partition]) - memoryBrokerRetention; overflow > 0 {
+		broker.partitions[partition] = append([]BrokerMessage(nil), broker.partitions[partition][overflow:]...)
+	}
+
+	for subscriber := range broker.subscribers {
+		if !MatchSubject(subscriber.pattern, subject) {
+			continue
+		}
+		select {
+		case subscriber.messages <- message:
+		default:
+		}
+	}
+	return nil
+}
+
+// Subscribe returns the messages published from now on to subjects matching the pattern.
+// The returned function ends the subscription and closes the channel.
+func (broker *MemoryBroker) Subscribe(pattern string) (<-chan BrokerMessage, func()) {
+	subscriber := &brokerSubscriber{pattern: pattern, messages: make(chan BrokerMessage, memoryBrokerBuffer)}
+	broker.mutex.Lock()
+	broker.subscribers[subscriber] = struct{}{}
+	broker.mutex.Unlock()
+
+	var once sync.Once
+	return subscriber.messages, func() {
+		once.Do(func() {
+			broker.mutex.Lock()
+			delete(broker.subscribers, subscriber)
+			broker.mutex.Unlock()
+			close(subscriber.messages)
+		})
+	}
+}
+
+// Messages returns the retained messages of the partition from the offset on that match the pattern
+func (broker *MemoryBroker) Messages(pattern string, partition int, offset int64) []BrokerMessage {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	var messages []BrokerMessage
+	if partition < 0 || partition >= len(broker.partitions) {
+		return messages
+	}
+	for _, message := range broker.partitions[partition] {
+		if message.Offset >= offset && MatchSubject(pattern, message.Subject) {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+// MatchSubject reports whether a subject matches a NATS pattern: tokens are separated by dots,
+// * matches one token and a trailing > matches one or more tokens
+func MatchSubject(pattern, subject string) bool {
+	patternTokens := strings.Split(pattern, ".")
+	subjectTokens := strings.Split(subject, ".")
+	for i, token := range patternTokens {
+		if token == ">" && i == len(patternTokens)-1 {
+			return len(subjectTokens) > i
+		}
+		if i >= len(subjectTokens) || (token != "*" && token != subjectTokens[i]) {
+			return false
+		}
+	}
+	return len(patternTokens) == len(subjectTokens)
+}
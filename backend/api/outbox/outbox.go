@@ -0,0 +1,161 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/DanVerh/university-swe/backend/api/logging"
+)
+
+// Mongo collection names of the messages, the per-aggregate sequence counters and the relay lease
+const (
+	Collection          = "outbox"
+	SequencesCollection = "outboxSequences"
+	LocksCollection     = "outboxLocks"
+)
+
+// Domain event types
+const (
+	OrderCreated        = "OrderCreated"
+	OrderStatusChanged  = "OrderStatusChanged"
+	ProductPriceChanged = "ProductPriceChanged"
+	StockAdjusted       = "StockAdjusted"
+)
+
+// Aggregate types, the kind of document an event belongs to
+const (
+	AggregateOrder   = "order"
+	AggregateProduct = "product"
+)
+
+// Message statuses
+const (
+	StatusPending   = "pending"
+	StatusPublished = "published"
+)
+
+// Event is a domain event to record with the change that caused it
+type Event struct {
+	Type          string
+	AggregateType string
+	AggregateID   primitive.ObjectID
+	Data          interface{}
+}
+
+// Message is an event in the outbox. The JSON encoding is the envelope published to the sinks;
+// consumers deduplicate by ID and order the events of an aggregate by Sequence.
+type Message struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id"`
+	Type          string             `json:"type" bson:"type"`
+	AggregateType string             `json:"aggregateType" bson:"aggregateType"`
+	AggregateID   primitive.ObjectID `json:"aggregateId" bson:"aggregateId"`
+	Sequence      int64              `json:"sequence" bson:"sequence"`
+	Payload       json.RawMessage    `json:"payload" bson:"payload"`
+	OccurredAt    time.Time          `json:"occurredAt" bson:"occurredAt"`
+	RequestID     string             `json:"requestId,omitempty" bson:"requestId,omitempty"`
+
+	// Relay state, not part of the published envelope
+	Status        string     `json:"-" bson:"status"`
+	Attempts      int        `json:"-" bson:"attempts"`
+	NextAttemptAt time.Time  `json:"-" bson:"nextAttemptAt"`
+	LastError     string     `json:"-" bson:"lastError,omitempty"`
+	PublishedAt   *time.Time `json:"-" bson:"publishedAt,omitempty"`
+}
+
+// Transact runs fn in a transaction, retrying it on transient errors like write conflicts.
+// Transactions need a replica set; a single server can run as a one-member replica set.
+func Transact(ctx context.Context, client *mongo.Client, fn func(sessionCtx mongo.SessionContext) error) error {
+	session, err := client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessionCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessionCtx)
+	})
+	return err
+}
+
+// Add records the events in the outbox. It is called with the session context of the
+// transaction that writes the change, so the events are stored if and only if the change is.
+// Every event takes the next sequence number of its aggregate, in the order of events; concurrent
+// changes of the same aggregate conflict on the counter and the later transaction is retried.
+// The counter of each aggregate is updated once and the messages are inserted with one write.
+func Add(sessionCtx mongo.SessionContext, database *mongo.Database, events ...Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	// Reserve the sequence numbers of every aggregate with a single increment
+	counts := map[string]int64{}
+	var aggregates []Event
+	for _, event := range events {
+		key := sequenceKey(event.AggregateType, event.AggregateID)
+		if counts[key] == 0 {
+			aggregates = append(aggregates, event)
+		}
+		counts[key]++
+	}
+	sequences := map[string]int64{}
+	for _, event := range aggregates {
+		key := sequenceKey(event.AggregateType, event.AggregateID)
+		last, err := reserveSequences(sessionCtx, database, key, counts[key])
+		if err != nil {
+			return fmt.Errorf("failed to number %s event: %w", event.Type, err)
+		}
+		sequences[key] = last - counts[key]
+	}
+
+	messages := make([]interface{}, len(events))
+	now := time.Now().UTC()
+	for i, event := range events {
+		payload, err := json.Marshal(event.Data)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s event: %w", event.Type, err)
+		}
+		key := sequenceKey(event.AggregateType, event.AggregateID)
+		sequences[key]++
+		sequence := sequences[key]
+		messages[i] = Message{
+			ID:            primitive.NewObjectID(),
+			Type:          event.Type,
+			AggregateType: event.AggregateType,
+			AggregateID:   event.AggregateID,
+			Sequence:      sequence,
+			Payload:       payload,
+			OccurredAt:    now,
+			RequestID:     logging.RequestID(sessionCtx),
+			Status:        StatusPending,
+			NextAttemptAt: now,
+		}
+	}
+
+	_, err := database.Collection(Collection).InsertMany(sessionCtx, messages)
+	return err
+}
+
+// reserveSequences increments the event counter of the aggregate by count and returns the last reserved number
+func reserveSequences(ctx context.Context, database *mongo.Database, key string, count int64) (int64, error) {
+	var counter struct {
+		Sequence int64 `bson:"sequence"`
+	}
+	err := database.Collection(SequencesCollection).FindOneAndUpdate(ctx,
+		bson.M{"_id": key},
+		bson.M{"$inc": bson.M{"sequence": count}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	return counter.Sequence, err
+}
+
+// sequenceKey is the ID of the event counter of an aggregate
+func sequenceKey(aggregateType string, aggregateID primitive.ObjectID) string {
+	return aggregateType + ":" + aggregateID.Hex()
+}
@@ -0,0 +1,227 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Defaults of the relay
+const (
+	defaultPollInterval = time.Second
+	defaultBatchSize    = 100
+	// Only the holder of the lease publishes, so events of an aggregate are never sent concurrently.
+	// A standby relay takes over once the lease of a stopped one runs out.
+	leaseDuration = 30 * time.Second
+	leaseID       = "relay"
+)
+
+// Retry delays of a message the sinks failed to take. Messages are never given up on,
+// as skipping one would break the order of its aggregate.
+const (
+	initialRetryDelay = time.Second
+	maxRetryDelay     = 5 * time.Minute
+)
+
+// Relay publishes the outbox messages to the sinks. Delivery is at-least-once: a message is
+// published again if a sink or the status update fails, so sinks may see duplicates.
+// The messages of an aggregate are published one after another in sequence order.
+type Relay struct {
+	database     *mongo.Database
+	sinks        []Sink
+	owner        string
+	pollInterval time.Duration
+	batchSize    int64
+}
+
+// NewRelay creates a relay of the outbox in the database
+func NewRelay(database *mongo.Database, sinks ...Sink) *Relay {
+	hostname, _ := os.Hostname()
+	return &Relay{
+		database:     database,
+		sinks:        sinks,
+		owner:        hostname + "-" + strconv.Itoa(os.Getpid()) + "-" + primitive.NewObjectID().Hex(),
+		pollInterval: defaultPollInterval,
+		batchSize:    defaultBatchSize,
+	}
+}
+
+// Run publishes pending messages while holding the lease, until the context is cancelled
+func (relay *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(relay.pollInterval)
+	defer ticker.Stop()
+	for {
+		// Drain full batches before waiting for the next poll
+		for {
+			published, err := relay.RelayPending(ctx)
+			if err != nil && ctx.Err() == nil {
+				slog.ErrorContext(ctx, "Failed to relay outbox messages", "error", err)
+			}
+			if published < int(relay.batchSize) || err != nil {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayPending publishes the due messages, oldest first, and returns how many were published.
+// It does nothing while another relay holds the lease.
+func (relay *Relay) RelayPending(ctx context.Context) (int, error) {
+	held, err := relay.acquire(ctx)
+	if err != nil || !held {
+		return 0, err
+	}
+
+	var messages []Message
+	cursor, err := relay.database.Collection(Collection).Find(ctx,
+		bson.M{"status": StatusPending, "nextAttemptAt": bson.M{"$lte": time.Now().UTC()}},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(relay.batchSize))
+	if err != nil {
+		return 0, err
+	}
+	if err := cursor.All(ctx, &messages); err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, group := range byAggregate(messages) {
+		// An earlier message of the aggregate is still waiting for a retry or is not in this batch
+		waiting, err := relay.database.Collection(Collection).CountDocuments(ctx, bson.M{
+			"aggregateType": group[0].AggregateType,
+			"aggregateId":   group[0].AggregateID,
+			"status":        StatusPending,
+			"sequence":      bson.M{"$lt": group[0].Sequence},
+		}, options.Count().SetLimit(1))
+		if err != nil {
+			return published, err
+		}
+		if waiting > 0 {
+			continue
+		}
+
+		for i, message := range group {
+			// Sequences of an aggregate have no gaps, a missing one is still pending
+			if i > 0 && message.Sequence != group[i-1].Sequence+1 {
+				break
+			}
+			// Renew the lease before every message so slow sinks cannot outlast it
+			if held, err := relay.acquire(ctx); err != nil || !held {
+				return published, err
+			}
+			if err := relay.publish(ctx, message); err != nil {
+				if err := relay.retry(ctx, message, err); err != nil {
+					return published, err
+				}
+				// Later messages of the aggregate wait for this one
+				break
+			}
+			if err := relay.markPublished(ctx, message); err != nil {
+				return published, err
+			}
+			published++
+		}
+	}
+	return published, nil
+}
+
+// publish sends the message to every sink
+func (relay *Relay) publish(ctx context.Context, message Message) error {
+	for _, sink := range relay.sinks {
+		if err := sink.Publish(ctx, message); err != nil {
+			return fmt.Errorf("%s sink: %w", sink.Name(), err)
+		}
+	}
+	return nil
+}
+
+// markPublished records that every sink took the message
+func (relay *Relay) markPublished(ctx context.Context, message Message) error {
+	_, err := relay.database.Collection(Collection).UpdateOne(ctx,
+		bson.M{"_id": message.ID},
+		bson.M{"$set": bson.M{"status": StatusPublished, "publishedAt": time.Now().UTC()}, "$inc": bson.M{"attempts": 1}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox message published: %w", err)
+	}
+	return nil
+}
+
+// retry records the failure and schedules the next attempt
+func (relay *Relay) retry(ctx context.Context, message Message, publishErr error) error {
+	slog.WarnContext(ctx, "Failed to publish outbox message", "id", message.ID.Hex(), "type", message.Type,
+		"aggregate", message.AggregateID.Hex(), "attempts", message.Attempts+1, "error", publishErr)
+	_, err := relay.database.Collection(Collection).UpdateOne(ctx,
+		bson.M{"_id": message.ID},
+		bson.M{
+			"$set": bson.M{"lastError": publishErr.Error(), "nextAttemptAt": time.Now().UTC().Add(retryDelay(message.Attempts + 1))},
+			"$inc": bson.M{"attempts": 1},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to schedule outbox message retry: %w", err)
+	}
+	return nil
+}
+
+// acquire takes or renews the relay lease and reports whether this relay holds it
+func (relay *Relay) acquire(ctx context.Context) (bool, error) {
+	now := time.Now().UTC()
+	_, err := relay.database.Collection(LocksCollection).UpdateOne(ctx,
+		bson.M{"_id": leaseID, "$or": bson.A{bson.M{"owner": relay.owner}, bson.M{"expiresAt": bson.M{"$lt": now}}}},
+		bson.M{"$set": bson.M{"owner": relay.owner, "expiresAt": now.Add(leaseDuration)}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		// The lease exists and belongs to another relay
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire the outbox relay lease: %w", err)
+	}
+	return true, nil
+}
+
+// byAggregate groups the messages by aggregate in order of their oldest message,
+// each group sorted by sequence
+func byAggregate(messages []Message) [][]Message {
+	var groups [][]Message
+	index := map[string]int{}
+	for _, message := range messages {
+		key := message.AggregateType + ":" + message.AggregateID.Hex()
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], message)
+	}
+	for _, group := range groups {
+		sort.Slice(group, func(i, j int) bool { return group[i].Sequence < group[j].Sequence })
+	}
+	return groups
+}
+
+// retryDelay doubles the delay after every failed attempt
+func retryDelay(attempts int) time.Duration {
+	delay := initialRetryDelay << (attempts - 1)
+	if delay > maxRetryDelay || delay <= 0 {
+		delay = maxRetryDelay
+	}
+	return delay
+}
@@ -0,0 +1,119 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/DanVerh/university-swe/backend/api/webhooks"
+)
+
+// Sink publishes outbox messages to consumers. A message can be published more than once,
+// e.g. when a later sink fails, so consumers deduplicate by the message ID.
+type Sink interface {
+	// Name identifies the sink in logs and errors
+	Name() string
+	Publish(ctx context.Context, message Message) error
+}
+
+// LogSink writes every message to the application log
+type LogSink struct{}
+
+func (LogSink) Name() string { return "log" }
+
+func (LogSink) Publish(ctx context.Context, message Message) error {
+	slog.InfoContext(ctx, "Domain event", "id", message.ID.Hex(), "type", message.Type,
+		"aggregateType", message.AggregateType, "aggregateId", message.AggregateID.Hex(),
+		"sequence", message.Sequence, "payload", string(message.Payload))
+	return nil
+}
+
+// Timeout of a webhook sink request
+const webhookSinkTimeout = 10 * time.Second
+
+// WebhookSink posts every message to a URL, signed like the webhook deliveries
+type WebhookSink struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// NewWebhookSink creates a sink posting to the URL. client is nil for the default client.
+func NewWebhookSink(url, secret string, client *http.Client) *WebhookSink {
+	if client == nil {
+		client = &http.Client{Timeout: webhookSinkTimeout}
+	}
+	return &WebhookSink{url: url, secret: secret, client: client}
+}
+
+func (sink *WebhookSink) Name() string { return "webhook" }
+
+// Publish posts the message envelope. Responses other than 2xx are errors, so the message is retried.
+func (sink *WebhookSink) Publish(ctx context.Context, message Message) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, sink.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := time.Now().Unix()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "sales-api-outbox")
+	request.Header.Set(webhooks.HeaderID, message.ID.Hex())
+	request.Header.Set(webhooks.HeaderEvent, message.Type)
+	request.Header.Set(webhooks.HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	request.Header.Set(webhooks.HeaderSignature, webhooks.Sign(sink.secret, timestamp, body))
+
+	response, err := sink.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("receiver responded with %d", response.StatusCode)
+	}
+	return nil
+}
+
+// Broker is the producer side of a message broker like NATS or Kafka.
+// The subject is a NATS subject or Kafka topic; the key is the Kafka partition key.
+type Broker interface {
+	Publish(ctx context.Context, subject, key string, data []byte) error
+}
+
+// BrokerSink publishes every message to a broker on the subject sales.<aggregate type>.<event type>,
+// e.g. sales.order.OrderCreated, keyed by the aggregate ID so an aggregate stays on one partition
+type BrokerSink struct {
+	name   string
+	broker Broker
+}
+
+// NewBrokerSink creates a sink publishing to the broker
+func NewBrokerSink(name string, broker Broker) *BrokerSink {
+	return &BrokerSink{name: name, broker: broker}
+}
+
+func (sink *BrokerSink) Name() string { return sink.name }
+
+func (sink *BrokerSink) Publish(ctx context.Context, message Message) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return sink.broker.Publish(ctx, Subject(message), message.AggregateID.Hex(), data)
+}
+
+// Subject returns the broker subject of the message
+func Subject(message Message) string {
+	return "sales." + message.AggregateType + "." + message.Type
+}
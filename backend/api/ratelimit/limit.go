@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit is a token bucket: Burst requests at once, refilled at Rate tokens per second
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Result is the outcome of taking a token from a bucket
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is the time until the next token is available, zero when allowed
+	RetryAfter time.Duration
+	// Reset is the time until the bucket is full again
+	Reset time.Duration
+}
+
+// Store keeps the token buckets
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// ParseLimit parses limits such as "120/m", "10/s" or "1000/h" into a bucket of that many
+// requests refilled evenly over the period
+func ParseLimit(value string) (Limit, error) {
+	count, period, ok := strings.Cut(value, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, expected <requests>/<s|m|h>", value)
+	}
+	requests, err := strconv.Atoi(count)
+	if err != nil || requests < 1 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, requests need to be a positive integer", value)
+	}
+
+	var duration time.Duration
+	switch period {
+	case "s":
+		duration = time.Second
+	case "m":
+		duration = time.Minute
+	case "h":
+		duration = time.Hour
+	default:
+		return Limit{}, fmt.Errorf("invalid rate limit %q, period needs to be s, m or h", value)
+	}
+
+	return Limit{Rate: float64(requests) / duration.Seconds(), Burst: requests}, nil
+}
+
+// result derives the response for a bucket holding tokens after the request was counted
+func (limit Limit) result(allowed bool, tokens float64) Result {
+	result := Result{
+		Allowed:   allowed,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((float64(limit.Burst) - tokens) / limit.Rate),
+	}
+	if !allowed {
+		result.RetryAfter = seconds((1 - tokens) / limit.Rate)
+	}
+	return result
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second))
+}
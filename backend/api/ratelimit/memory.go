@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Maximum number of buckets kept in memory. When it is reached, the bucket used least recently is evicted,
+// which at worst resets the limit of the client that has been idle the longest.
+const memoryMaxBuckets = 100000
+
+// Interval at which Run evicts the buckets that have refilled completely
+const memorySweepInterval = time.Minute
+
+type bucket struct {
+	key     string
+	tokens  float64
+	updated time.Time
+	// limit of the bucket's group, so sweep knows when the bucket is full
+	limit Limit
+}
+
+// MemoryStore keeps the token buckets in process memory. Limits are per replica.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*list.Element
+	// recent orders the buckets from the most to the least recently used
+	recent     *list.List
+	maxBuckets int
+	now        func() time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store. Run needs to be started to evict refilled buckets.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*list.Element{}, recent: list.New(), maxBuckets: memoryMaxBuckets, now: time.Now}
+}
+
+// Run evicts the buckets that have refilled completely every sweep interval until the context is cancelled
+func (store *MemoryStore) Run(ctx context.Context) {
+	ticker := time.NewTicker(memorySweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			store.mu.Lock()
+			store.sweep(store.now())
+			store.mu.Unlock()
+		}
+	}
+}
+
+// Take refills the bucket of the key for the elapsed time and takes a token if one is available
+func (store *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := store.now()
+	var current *bucket
+	if element, ok := store.buckets[key]; ok {
+		store.recent.MoveToFront(element)
+		current = element.Value.(*bucket)
+	} else {
+		if store.recent.Len() >= store.maxBuckets {
+			store.remove(store.recent.Back())
+		}
+		current = &bucket{key: key, tokens: float64(limit.Burst), updated: now}
+		store.buckets[key] = store.recent.PushFront(current)
+	}
+
+	elapsed := now.Sub(current.updated).Seconds()
+	current.tokens = math.Min(float64(limit.Burst), current.tokens+elapsed*limit.Rate)
+	current.updated = now
+	current.limit = limit
+
+	allowed := current.tokens >= 1
+	if allowed {
+		current.tokens--
+	}
+	return limit.result(allowed, current.tokens), nil
+}
+
+// sweep drops buckets that have refilled completely under their own limit, as they behave like new ones
+func (store *MemoryStore) sweep(now time.Time) {
+	for _, element := range store.buckets {
+		current := element.Value.(*bucket)
+		if current.tokens+now.Sub(current.updated).Seconds()*current.limit.Rate >= float64(current.limit.Burst) {
+			store.remove(element)
+		}
+	}
+}
+
+func (store *MemoryStore) remove(element *list.Element) {
+	delete(store.buckets, store.recent.Remove(element).(*bucket).key)
+}
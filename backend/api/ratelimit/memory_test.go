@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	now := time.Unix(0, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	limit := Limit{Rate: 1, Burst: 2}
+
+	for i, want := range []bool{true, true, false} {
+		result, _ := store.Take(context.Background(), "client", limit)
+		if result.Allowed != want {
+			t.Fatalf("take %d allowed %v, want %v", i+1, result.Allowed, want)
+		}
+	}
+	now = now.Add(time.Second)
+	if result, _ := store.Take(context.Background(), "client", limit); !result.Allowed {
+		t.Fatal("bucket was not refilled after a second")
+	}
+}
+
+func TestMemoryStoreSweepUsesBucketLimit(t *testing.T) {
+	now := time.Unix(0, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	slow := Limit{Rate: 10.0 / 60, Burst: 10}
+	fast := Limit{Rate: 100, Burst: 10}
+
+	// Empty the bucket of a slowly refilling group
+	for i := 0; i < slow.Burst; i++ {
+		store.Take(context.Background(), "batch:client", slow)
+	}
+	store.Take(context.Background(), "products:client", fast)
+	now = now.Add(time.Second)
+	store.sweep(now)
+
+	if _, ok := store.buckets["products:client"]; ok {
+		t.Error("the refilled bucket of the fast group was kept")
+	}
+	if _, ok := store.buckets["batch:client"]; !ok {
+		t.Fatal("the empty bucket of the slow group was evicted")
+	}
+	if result, _ := store.Take(context.Background(), "batch:client", slow); result.Allowed {
+		t.Fatal("the slow group's bucket came back full")
+	}
+}
+
+func TestMemoryStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	store := NewMemoryStore()
+	store.maxBuckets = 3
+	limit := Limit{Rate: 1.0 / 60, Burst: 1}
+
+	for i := 0; i < store.maxBuckets; i++ {
+		store.Take(context.Background(), fmt.Sprintf("client:%d", i), limit)
+	}
+	// Using the oldest bucket again makes the second one the least recently used
+	store.Take(context.Background(), "client:0", limit)
+	store.Take(context.Background(), "client:new", limit)
+
+	if len(store.buckets) != store.maxBuckets || store.recent.Len() != store.maxBuckets {
+		t.Fatalf("got %d buckets, want at most %d", len(store.buckets), store.maxBuckets)
+	}
+	if _, ok := store.buckets["client:1"]; ok {
+		t.Error("the least recently used bucket was kept")
+	}
+	if result, _ := store.Take(context.Background(), "client:0", limit); result.Allowed {
+		t.Error("the recently used bucket was evicted")
+	}
+}
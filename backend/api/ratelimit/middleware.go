@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/DanVerh/university-swe/backend/api/auth"
+	"github.com/DanVerh/university-swe/backend/api/errorHandling"
+)
+
+// Limiter applies a Limit per route group to every client
+type Limiter struct {
+	store  Store
+	limits map[string]Limit
+}
+
+// New creates a limiter with the limits of each route group
+func New(store Store, limits map[string]Limit) *Limiter {
+	return &Limiter{store: store, limits: limits}
+}
+
+// Middleware limits the requests of each client to the route group. Clients are keyed by
+// API key or JWT subject when authenticated and by IP address otherwise.
+// Responses carry RateLimit-* headers and rejected requests get 429 with Retry-After.
+func (limiter *Limiter) Middleware(group string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		limit, ok := limiter.limits[group]
+		if !ok {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			result, err := limiter.store.Take(r.Context(), group+":"+clientKey(r), limit)
+			if err != nil {
+				// Fail open so an unavailable store does not take the API down
+				slog.ErrorContext(r.Context(), "Failed to check rate limit", "group", group, "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+			if !result.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+				errorHandling.ThrowProblem(r.Context(), w, http.StatusTooManyRequests, "Rate limit exceeded for "+group, nil)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientKey identifies the caller by principal subject or client IP
+func clientKey(r *http.Request) string {
+	if principal := auth.FromContext(r.Context()); principal != nil {
+		return principal.Subject
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+func ceilSeconds(duration time.Duration) int {
+	return int(math.Ceil(duration.Seconds()))
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Mongo collection name for rate limit buckets
+const rateLimitsCollection = "rateLimits"
+
+// MongoStore keeps the token buckets in Mongo so every replica shares the same limits.
+// Each take is a single atomic findOneAndUpdate with an aggregation pipeline update.
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoStore creates a store on the rateLimits collection of the database
+func NewMongoStore(database *mongo.Database) *MongoStore {
+	return &MongoStore{collection: database.Collection(rateLimitsCollection)}
+}
+
+type mongoBucket struct {
+	Tokens  float64 `bson:"tokens"`
+	Allowed bool    `bson:"allowed"`
+}
+
+// Take refills the bucket of the key for the elapsed time and takes a token if one is available
+func (store *MongoStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := time.Now()
+	burst := float64(limit.Burst)
+
+	// Elapsed seconds since the last update, zero for a new bucket
+	elapsed := bson.D{{Key: "$divide", Value: bson.A{
+		bson.D{{Key: "$subtract", Value: bson.A{now, bson.D{{Key: "$ifNull", Value: bson.A{"$updatedAt", now}}}}}},
+		1000,
+	}}}
+	refilled := bson.D{{Key: "$min", Value: bson.A{
+		burst,
+		bson.D{{Key: "$add", Value: bson.A{
+			bson.D{{Key: "$ifNull", Value: bson.A{"$tokens", burst}}},
+			bson.D{{Key: "$multiply", Value: bson.A{elapsed, limit.Rate}}},
+		}}},
+	}}}
+	hasToken := bson.D{{Key: "$gte", Value: bson.A{"$tokens", 1}}}
+
+	update := mongo.Pipeline{
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "tokens", Value: refilled},
+			{Key: "updatedAt", Value: now},
+		}}},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "allowed", Value: hasToken},
+			{Key: "tokens", Value: bson.D{{Key: "$cond", Value: bson.A{hasToken, bson.D{{Key: "$subtract", Value: bson.A{"$tokens", 1}}}, "$tokens"}}}},
+			// Buckets are removed by a TTL index once they would be full again
+			{Key: "expiresAt", Value: now.Add(seconds(burst / limit.Rate))},
+		}}},
+	}
+
+	var current mongoBucket
+	err := store.collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, update,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&current)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return limit.result(current.Allowed, current.Tokens), nil
+}
@@ -0,0 +1,44 @@
+package versioning
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Deprecation describes routes that are still served but will be removed
+type Deprecation struct {
+	// Since is when the routes were deprecated
+	Since time.Time
+	// Sunset is when the routes stop being served, zero if not decided yet
+	Sunset time.Time
+	// Prefix is where the deprecated routes are mounted, e.g. "/v1" or "" for unversioned routes
+	Prefix string
+	// Successor replaces Prefix in the path of the replacing route, e.g. "/v2"
+	Successor string
+}
+
+// Deprecated adds the Deprecation (RFC 9745) and Sunset (RFC 8594) headers to every response
+// and links the replacing route with rel="successor-version"
+func Deprecated(deprecation Deprecation) func(http.Handler) http.Handler {
+	since := "@" + strconv.FormatInt(deprecation.Since.Unix(), 10)
+	var sunset string
+	if !deprecation.Sunset.IsZero() {
+		sunset = deprecation.Sunset.UTC().Format(http.TimeFormat)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", since)
+			if sunset != "" {
+				w.Header().Set("Sunset", sunset)
+			}
+			if deprecation.Successor != "" {
+				successor := deprecation.Successor + strings.TrimPrefix(r.URL.Path, deprecation.Prefix)
+				w.Header().Add("Link", "<"+successor+`>; rel="successor-version"`)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
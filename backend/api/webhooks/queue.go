@@ -0,0 +1,65 @@
+package webhooks
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// queue holds the deliveries and subscriptions the worker reads and updates
+type queue interface {
+	// claim leases the delivery due longest by now until the lease ends. It returns nil if none is due.
+	claim(ctx context.Context, now, leaseEnd time.Time) (*Delivery, error)
+	// subscription returns the subscription or mongo.ErrNoDocuments
+	subscription(ctx context.Context, id primitive.ObjectID) (*Subscription, error)
+	// record appends the attempt and sets the status. A pending delivery is due again at next.
+	record(ctx context.Context, id primitive.ObjectID, attempt Attempt, status string, next time.Time) error
+}
+
+// mongoQueue is the queue in the webhooks and webhookDeliveries collections
+type mongoQueue struct {
+	database *mongo.Database
+}
+
+func (queue mongoQueue) claim(ctx context.Context, now, leaseEnd time.Time) (*Delivery, error) {
+	var delivery Delivery
+	err := queue.database.Collection(DeliveriesCollection).FindOneAndUpdate(ctx,
+		bson.M{"status": StatusPending, "nextAttemptAt": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"nextAttemptAt": leaseEnd}},
+		options.FindOneAndUpdate().SetSort(bson.D{{Key: "nextAttemptAt", Value: 1}}).SetReturnDocument(options.After),
+	).Decode(&delivery)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func (queue mongoQueue) subscription(ctx context.Context, id primitive.ObjectID) (*Subscription, error) {
+	var subscription Subscription
+	if err := queue.database.Collection(Collection).FindOne(ctx, bson.M{"_id": id}).Decode(&subscription); err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func (queue mongoQueue) record(ctx context.Context, id primitive.ObjectID, attempt Attempt, status string, next time.Time) error {
+	set := bson.M{"status": status}
+	switch status {
+	case StatusDelivered:
+		set["deliveredAt"] = attempt.At
+	case StatusPending:
+		set["nextAttemptAt"] = next
+	}
+	_, err := queue.database.Collection(DeliveriesCollection).UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": set, "$push": bson.M{"attempts": attempt}, "$inc": bson.M{"attemptCount": 1}},
+	)
+	return err
+}
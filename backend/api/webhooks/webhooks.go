@@ -0,0 +1,185 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/DanVerh/university-swe/backend/api/events"
+)
+
+// Mongo collection names of the subscriptions and of the delivery queue and log
+const (
+	Collection           = "webhooks"
+	DeliveriesCollection = "webhookDeliveries"
+)
+
+// Delivery statuses. Dead deliveries ran out of attempts and are kept for inspection.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+)
+
+// Headers of every delivery request
+const (
+	HeaderID        = "X-Webhook-ID"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Prefix of generated signing secrets
+const secretPrefix = "whsec_"
+
+// Event types a subscription can receive
+var EventTypes = []string{events.OrderCreated, events.OrderStatusChanged, events.OrderDeleted}
+
+// Subscription is a receiver of events in the database
+type Subscription struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id"`
+	URL    string             `json:"url" bson:"url"`
+	Events []string           `json:"events" bson:"events"`
+	// Statuses limits the events to orders with one of the statuses, e.g. shipped and cancelled
+	Statuses []string `json:"statuses,omitempty" bson:"statuses,omitempty"`
+	// Secret signs the payloads. It is only returned when the subscription is created.
+	Secret    string    `json:"secret,omitempty" bson:"secret"`
+	Active    bool      `json:"active" bson:"active"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+// Attempt is the outcome of a single delivery request
+type Attempt struct {
+	At         time.Time     `json:"at" bson:"at"`
+	StatusCode int           `json:"statusCode,omitempty" bson:"statusCode,omitempty"`
+	Error      string        `json:"error,omitempty" bson:"error,omitempty"`
+	Duration   time.Duration `json:"duration" bson:"duration"`
+}
+
+// Delivery is an event queued for a subscription, and its delivery log
+type Delivery struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	Webhook   primitive.ObjectID `json:"webhook" bson:"webhook"`
+	EventID   string             `json:"eventId" bson:"eventId"`
+	EventType string             `json:"eventType" bson:"eventType"`
+	Payload   json.RawMessage    `json:"payload" bson:"payload"`
+	Status    string             `json:"status" bson:"status"`
+	Attempts  []Attempt          `json:"attempts" bson:"attempts"`
+	// AttemptCount counts the attempts since the delivery was last queued, Attempts keeps all of them
+	AttemptCount  int        `json:"attemptCount" bson:"attemptCount"`
+	NextAttemptAt time.Time  `json:"nextAttemptAt" bson:"nextAttemptAt"`
+	CreatedAt     time.Time  `json:"createdAt" bson:"createdAt"`
+	DeliveredAt   *time.Time `json:"deliveredAt,omitempty" bson:"deliveredAt,omitempty"`
+}
+
+// Validate checks the URL and event types of a new subscription
+func (subscription *Subscription) Validate() error {
+	parsed, err := url.Parse(subscription.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errors.New("URL needs to be an absolute http or https URL")
+	}
+	if len(subscription.Events) == 0 {
+		return errors.New("Events need at least one event type")
+	}
+	for _, eventType := range subscription.Events {
+		if !contains(EventTypes, eventType) {
+			return errors.New("Unknown event type " + strconv.Quote(eventType))
+		}
+	}
+	return nil
+}
+
+// NewSecret generates a signing secret
+func NewSecret() (string, error) {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return secretPrefix + hex.EncodeToString(secret), nil
+}
+
+// Sign returns the signature header value of a payload sent at the timestamp:
+// "sha256=" and the hex HMAC-SHA256 of "<timestamp>.<payload>" keyed with the secret.
+// Receivers recompute it and reject old timestamps to prevent replays.
+func Sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature header value in constant time
+func Verify(secret string, timestamp int64, payload []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, payload)), []byte(signature))
+}
+
+// Enqueue queues the event for every active subscription that wants it. The queue is
+// in Mongo so deliveries survive restarts. A failure is logged rather than returned,
+// as the order change has already been written.
+func Enqueue(ctx context.Context, database *mongo.Database, event events.Event) {
+	filter := bson.M{"active": true, "events": event.Type}
+	cursor, err := database.Collection(Collection).Find(ctx, filter)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to find webhook subscriptions", "event", event.Type, "error", err)
+		return
+	}
+	var subscriptions []Subscription
+	if err := cursor.All(ctx, &subscriptions); err != nil {
+		slog.ErrorContext(ctx, "Failed to decode webhook subscriptions", "event", event.Type, "error", err)
+		return
+	}
+
+	var deliveries []interface{}
+	var payload []byte
+	now := time.Now().UTC()
+	for _, subscription := range subscriptions {
+		if len(subscription.Statuses) > 0 && !contains(subscription.Statuses, event.Attributes["status"]) {
+			continue
+		}
+		if payload == nil {
+			if payload, err = json.Marshal(event); err != nil {
+				slog.ErrorContext(ctx, "Failed to encode webhook payload", "event", event.Type, "error", err)
+				return
+			}
+		}
+		deliveries = append(deliveries, Delivery{
+			ID:            primitive.NewObjectID(),
+			Webhook:       subscription.ID,
+			EventID:       strconv.FormatUint(event.ID, 10),
+			EventType:     event.Type,
+			Payload:       payload,
+			Status:        StatusPending,
+			Attempts:      []Attempt{},
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return
+	}
+	if _, err := database.Collection(DeliveriesCollection).InsertMany(ctx, deliveries); err != nil {
+		slog.ErrorContext(ctx, "Failed to queue webhook deliveries", "event", event.Type, "error", err)
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
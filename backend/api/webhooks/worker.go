@@ -0,0 +1,159 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Retry policy of failed deliveries: the delay doubles after every attempt
+// and a delivery is dead-lettered after maxAttempts
+const (
+	maxAttempts    = 8
+	initialBackoff = 10 * time.Second
+	maxBackoff     = time.Hour
+)
+
+// Defaults of the worker
+const (
+	defaultPollInterval = 2 * time.Second
+	// A claimed delivery is retried by any worker once its lease runs out, e.g. after a crash
+	leaseDuration  = time.Minute
+	requestTimeout = 10 * time.Second
+)
+
+// Worker sends the queued deliveries. Several workers can share the queue.
+type Worker struct {
+	queue        queue
+	client       *http.Client
+	pollInterval time.Duration
+}
+
+// NewWorker creates a worker of the queue in the database. client is nil for the default client.
+func NewWorker(database *mongo.Database, client *http.Client) *Worker {
+	if client == nil {
+		client = &http.Client{Timeout: requestTimeout}
+	}
+	return &Worker{queue: mongoQueue{database: database}, client: client, pollInterval: defaultPollInterval}
+}
+
+// Run delivers due deliveries until the context is cancelled
+func (worker *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(worker.pollInterval)
+	defer ticker.Stop()
+	for {
+		// Drain every due delivery before waiting for the next poll
+		for {
+			delivered, err := worker.DeliverNext(ctx)
+			if err != nil && ctx.Err() == nil {
+				slog.ErrorContext(ctx, "Failed to process webhook delivery", "error", err)
+			}
+			if !delivered || err != nil {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverNext claims the next due delivery and sends it. It returns false if none was due.
+func (worker *Worker) DeliverNext(ctx context.Context) (bool, error) {
+	now := time.Now().UTC()
+	delivery, err := worker.queue.claim(ctx, now, now.Add(leaseDuration))
+	if err != nil || delivery == nil {
+		return false, err
+	}
+
+	subscription, err := worker.queue.subscription(ctx, delivery.Webhook)
+	if err == mongo.ErrNoDocuments || (err == nil && !subscription.Active) {
+		// The subscription was deleted or paused, keep the delivery for the log
+		return true, worker.finish(ctx, delivery, Attempt{At: now, Error: "Subscription is not active"}, StatusDead)
+	}
+	if err != nil {
+		return true, err
+	}
+
+	attempt := worker.send(ctx, subscription, delivery)
+	status := StatusPending
+	switch {
+	case attempt.Error == "":
+		status = StatusDelivered
+	case delivery.AttemptCount+1 >= maxAttempts:
+		status = StatusDead
+	}
+	return true, worker.finish(ctx, delivery, attempt, status)
+}
+
+// send posts the signed payload to the subscription URL. 2xx responses are successful.
+func (worker *Worker) send(ctx context.Context, subscription *Subscription, delivery *Delivery) Attempt {
+	start := time.Now()
+	attempt := Attempt{At: start.UTC()}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	timestamp := start.Unix()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "sales-api-webhooks")
+	request.Header.Set(HeaderID, delivery.ID.Hex())
+	request.Header.Set(HeaderEvent, delivery.EventType)
+	request.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	request.Header.Set(HeaderSignature, Sign(subscription.Secret, timestamp, delivery.Payload))
+
+	response, err := worker.client.Do(request)
+	attempt.Duration = time.Since(start)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	attempt.StatusCode = response.StatusCode
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		attempt.Error = fmt.Sprintf("Receiver responded with %d", response.StatusCode)
+	}
+	return attempt
+}
+
+// finish records the attempt and schedules the next one while the delivery is pending
+func (worker *Worker) finish(ctx context.Context, delivery *Delivery, attempt Attempt, status string) error {
+	var next time.Time
+	switch status {
+	case StatusPending:
+		next = attempt.At.Add(backoff(delivery.AttemptCount + 1))
+	case StatusDead:
+		slog.WarnContext(ctx, "Webhook delivery dead-lettered", "delivery", delivery.ID.Hex(),
+			"webhook", delivery.Webhook.Hex(), "attempts", delivery.AttemptCount+1, "error", attempt.Error)
+	}
+
+	if err := worker.queue.record(ctx, delivery.ID, attempt, status, next); err != nil {
+		return fmt.Errorf("failed to record webhook attempt: %w", err)
+	}
+	return nil
+}
+
+// backoff returns the delay after the given number of failed attempts, with up to 20% jitter
+// so receivers coming back up are not hit by every delivery at once
+func backoff(attempts int) time.Duration {
+	delay := initialBackoff << (attempts - 1)
+	if delay > maxBackoff || delay <= 0 {
+		delay = maxBackoff
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
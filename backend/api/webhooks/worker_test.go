@@ -0,0 +1,218 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// memoryQueue keeps the subscriptions and deliveries of the tests in memory
+type memoryQueue struct {
+	mutex         sync.Mutex
+	subscriptions map[primitive.ObjectID]*Subscription
+	deliveries    []*Delivery
+}
+
+func (queue *memoryQueue) claim(ctx context.Context, now, leaseEnd time.Time) (*Delivery, error) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	var due *Delivery
+	for _, delivery := range queue.deliveries {
+		if delivery.Status == StatusPending && !delivery.NextAttemptAt.After(now) &&
+			(due == nil || delivery.NextAttemptAt.Before(due.NextAttemptAt)) {
+			due = delivery
+		}
+	}
+	if due == nil {
+		return nil, nil
+	}
+	due.NextAttemptAt = leaseEnd
+	claimed := *due
+	return &claimed, nil
+}
+
+func (queue *memoryQueue) subscription(ctx context.Context, id primitive.ObjectID) (*Subscription, error) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	subscription, ok := queue.subscriptions[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	return subscription, nil
+}
+
+func (queue *memoryQueue) record(ctx context.Context, id primitive.ObjectID, attempt Attempt, status string, next time.Time) error {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	for _, delivery := range queue.deliveries {
+		if delivery.ID != id {
+			continue
+		}
+		delivery.Status = status
+		delivery.Attempts = append(delivery.Attempts, attempt)
+		delivery.AttemptCount++
+		switch status {
+		case StatusDelivered:
+			delivery.DeliveredAt = &attempt.At
+		case StatusPending:
+			delivery.NextAttemptAt = next
+		}
+		return nil
+	}
+	return mongo.ErrNoDocuments
+}
+
+// testWorker queues a due delivery with the attempts already made for a subscription to the receiver
+func testWorker(t *testing.T, receiver http.HandlerFunc, attemptCount int) (*Worker, *Delivery, *Subscription) {
+	t.Helper()
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+
+	subscription := &Subscription{
+		ID:     primitive.NewObjectID(),
+		URL:    server.URL,
+		Events: EventTypes,
+		Secret: secretPrefix + "test",
+		Active: true,
+	}
+	delivery := &Delivery{
+		ID:            primitive.NewObjectID(),
+		Webhook:       subscription.ID,
+		EventID:       "event-1",
+		EventType:     EventTypes[0],
+		Payload:       json.RawMessage(`{"id":"event-1","type":"order.created"}`),
+		Status:        StatusPending,
+		AttemptCount:  attemptCount,
+		NextAttemptAt: time.Now().UTC().Add(-time.Second),
+	}
+	queue := &memoryQueue{
+		subscriptions: map[primitive.ObjectID]*Subscription{subscription.ID: subscription},
+		deliveries:    []*Delivery{delivery},
+	}
+	return &Worker{queue: queue, client: server.Client(), pollInterval: defaultPollInterval}, delivery, subscription
+}
+
+func TestDeliverNextSignsPayload(t *testing.T) {
+	var verified bool
+	var subscription *Subscription
+	worker, delivery, subscription := testWorker(t, func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := io.ReadAll(r.Body)
+		timestamp, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+		verified = err == nil && Verify(subscription.Secret, timestamp, payload, r.Header.Get(HeaderSignature)) &&
+			r.Header.Get(HeaderEvent) == EventTypes[0] && r.Header.Get(HeaderID) != ""
+		w.WriteHeader(http.StatusNoContent)
+	}, 0)
+
+	delivered, err := worker.DeliverNext(context.Background())
+	if err != nil || !delivered {
+		t.Fatalf("got %v, %v, want a delivery", delivered, err)
+	}
+	if !verified {
+		t.Error("the receiver could not verify the signature and headers")
+	}
+	if delivery.Status != StatusDelivered || delivery.DeliveredAt == nil || delivery.AttemptCount != 1 {
+		t.Errorf("got status %s after %d attempts, want delivered after 1", delivery.Status, delivery.AttemptCount)
+	}
+	if attempt := delivery.Attempts[0]; attempt.StatusCode != http.StatusNoContent || attempt.Error != "" {
+		t.Errorf("got attempt %+v, want a successful one", attempt)
+	}
+
+	delivered, err = worker.DeliverNext(context.Background())
+	if err != nil || delivered {
+		t.Errorf("got %v, %v, want nothing left to deliver", delivered, err)
+	}
+}
+
+func TestVerifyRejectsChangedPayload(t *testing.T) {
+	payload := []byte(`{"id":"event-1"}`)
+	signature := Sign("secret", 1700000000, payload)
+	if !Verify("secret", 1700000000, payload, signature) {
+		t.Fatal("the signature of the payload does not verify")
+	}
+	if Verify("secret", 1700000000, []byte(`{"id":"event-2"}`), signature) {
+		t.Error("a changed payload verifies")
+	}
+	if Verify("secret", 1700000001, payload, signature) {
+		t.Error("a changed timestamp verifies")
+	}
+	if Verify("other", 1700000000, payload, signature) {
+		t.Error("another secret verifies")
+	}
+}
+
+func TestDeliverNextSchedulesRetry(t *testing.T) {
+	worker, delivery, _ := testWorker(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}, 2)
+
+	if _, err := worker.DeliverNext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != StatusPending || delivery.AttemptCount != 3 {
+		t.Fatalf("got status %s after %d attempts, want pending after 3", delivery.Status, delivery.AttemptCount)
+	}
+	attempt := delivery.Attempts[0]
+	if attempt.StatusCode != http.StatusInternalServerError || attempt.Error == "" {
+		t.Errorf("got attempt %+v, want a failed one with the status code", attempt)
+	}
+	// The third failure waits four times the initial backoff plus up to 20% jitter
+	delay := delivery.NextAttemptAt.Sub(attempt.At)
+	if delay < 4*initialBackoff || delay > 4*initialBackoff*6/5 {
+		t.Errorf("got next attempt after %v, want between %v and %v", delay, 4*initialBackoff, 4*initialBackoff*6/5)
+	}
+
+	delivered, err := worker.DeliverNext(context.Background())
+	if err != nil || delivered {
+		t.Errorf("got %v, %v, want the delivery not to be due before the backoff", delivered, err)
+	}
+}
+
+func TestDeliverNextDeadLettersAfterMaxAttempts(t *testing.T) {
+	worker, delivery, _ := testWorker(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}, maxAttempts-1)
+
+	if _, err := worker.DeliverNext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != StatusDead || delivery.AttemptCount != maxAttempts {
+		t.Errorf("got status %s after %d attempts, want dead after %d", delivery.Status, delivery.AttemptCount, maxAttempts)
+	}
+}
+
+func TestDeliverNextInactiveSubscription(t *testing.T) {
+	worker, delivery, subscription := testWorker(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("a paused subscription received a delivery")
+	}, 0)
+	subscription.Active = false
+
+	if _, err := worker.DeliverNext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != StatusDead || delivery.Attempts[0].Error == "" {
+		t.Errorf("got status %s, want dead with the reason", delivery.Status)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{
+		1:  initialBackoff,
+		2:  2 * initialBackoff,
+		4:  8 * initialBackoff,
+		20: maxBackoff,
+		70: maxBackoff,
+	} {
+		if got := backoff(attempts); got < want || got > want*6/5 {
+			t.Errorf("backoff(%d) is %v, want between %v and %v", attempts, got, want, want*6/5)
+		}
+	}
+}
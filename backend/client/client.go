@@ -0,0 +1,214 @@
+// Package client is a typed Go client of the sales API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default retry policy of idempotent requests
+const (
+	defaultMaxRetries = 3
+	defaultBackoff    = 200 * time.Millisecond
+	maxBackoff        = 5 * time.Second
+)
+
+// Prefix of the API version the client is written against
+const apiVersion = "/v1"
+
+// Client calls the sales API. It is safe for concurrent use.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	apiKey     string
+	token      string
+	maxRetries int
+	backoff    time.Duration
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithAPIKey authenticates with an API key sent as X-API-Key
+func WithAPIKey(key string) Option {
+	return func(client *Client) {
+		client.apiKey = key
+	}
+}
+
+// WithBearerToken authenticates with a JWT sent as Authorization: Bearer
+func WithBearerToken(token string) Option {
+	return func(client *Client) {
+		client.token = token
+	}
+}
+
+// WithHTTPClient replaces http.DefaultClient, e.g. to set timeouts or transports
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(client *Client) {
+		client.httpClient = httpClient
+	}
+}
+
+// WithRetries sets how often idempotent requests are retried and the initial backoff,
+// which doubles after every attempt. Zero retries disables retrying.
+func WithRetries(maxRetries int, backoff time.Duration) Option {
+	return func(client *Client) {
+		client.maxRetries = maxRetries
+		client.backoff = backoff
+	}
+}
+
+// New creates a client of the API at baseURL, e.g. http://localhost:8080
+func New(baseURL string, options ...Option) (*Client, error) {
+	parsed, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	client := &Client{
+		baseURL:    parsed,
+		httpClient: http.DefaultClient,
+		maxRetries: defaultMaxRetries,
+		backoff:    defaultBackoff,
+	}
+	for _, option := range options {
+		option(client)
+	}
+	return client, nil
+}
+
+// request is a single API call
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	body   interface{}
+}
+
+// do sends the request and decodes a JSON response into out, if not nil.
+// GET, PUT and DELETE are retried on network errors, 429 and 5xx responses.
+func (client *Client) do(ctx context.Context, req request, out interface{}) error {
+	response, err := client.send(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if out == nil {
+		_, err = io.Copy(io.Discard, response.Body)
+		return err
+	}
+	if text, ok := out.(*string); ok {
+		body, err := io.ReadAll(response.Body)
+		*text = string(body)
+		return err
+	}
+	if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response of %s %s: %w", req.method, req.path, err)
+	}
+	return nil
+}
+
+// send performs the request with retries and returns a successful response or an *Error
+func (client *Client) send(ctx context.Context, req request) (*http.Response, error) {
+	var body []byte
+	if req.body != nil {
+		var err error
+		if body, err = json.Marshal(req.body); err != nil {
+			return nil, fmt.Errorf("failed to encode request body: %w", err)
+		}
+	}
+
+	attempts := 1
+	if idempotent(req.method) {
+		attempts += client.maxRetries
+	}
+	delay := client.backoff
+
+	for attempt := 1; ; attempt++ {
+		response, err := client.attempt(ctx, req, body)
+		if err == nil && response.StatusCode < http.StatusBadRequest {
+			return response, nil
+		}
+
+		var wait time.Duration
+		if err == nil {
+			apiError := newError(response)
+			if attempt >= attempts || !retryable(response.StatusCode) {
+				return nil, apiError
+			}
+			err, wait = apiError, apiError.RetryAfter
+		} else if attempt >= attempts || ctx.Err() != nil {
+			return nil, err
+		}
+
+		// Exponential backoff with jitter, unless the server asked for a specific delay
+		if wait == 0 {
+			wait = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+			delay = min(delay*2, maxBackoff)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt sends the request once
+func (client *Client) attempt(ctx context.Context, req request, body []byte) (*http.Response, error) {
+	target := *client.baseURL
+	target.Path += apiVersion + req.path
+	target.RawQuery = req.query.Encode()
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	httpRequest, err := http.NewRequestWithContext(ctx, req.method, target.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		httpRequest.Header.Set("Content-Type", "application/json")
+	}
+	httpRequest.Header.Set("Accept", "application/json")
+	if client.apiKey != "" {
+		httpRequest.Header.Set("X-API-Key", client.apiKey)
+	}
+	if client.token != "" {
+		httpRequest.Header.Set("Authorization", "Bearer "+client.token)
+	}
+	return client.httpClient.Do(httpRequest)
+}
+
+// idempotent reports whether repeating the request has the same effect as sending it once.
+// Every PUT route of the API sets absolute values; payments and refunds are POST routes.
+func idempotent(method string) bool {
+	return method == http.MethodGet || method == http.MethodPut || method == http.MethodDelete
+}
+
+// retryable reports whether a failed request may succeed when repeated
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// retryAfter parses the Retry-After header in seconds
+func retryAfter(header string) time.Duration {
+	seconds, err := strconv.Atoi(header)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Customer is a customer placing orders
+type Customer struct {
+	ID      string `json:"id,omitempty"`
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
+// CustomerUpdate holds the customer fields to change; nil fields are left as they are
+type CustomerUpdate struct {
+	Name    *string `json:"name,omitempty"`
+	Address *string `json:"address,omitempty"`
+}
+
+// ListCustomersOptions filters ListCustomers
+type ListCustomersOptions struct {
+	// Name is a case-insensitive search of the customer name
+	Name string
+}
+
+// CreateCustomer creates a customer
+func (client *Client) CreateCustomer(ctx context.Context, customer Customer) (*Customer, error) {
+	var created Customer
+	err := client.do(ctx, request{method: http.MethodPost, path: "/customers", body: customer}, &created)
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// ListCustomers lists all customers or those matching the options
+func (client *Client) ListCustomers(ctx context.Context, options *ListCustomersOptions) ([]Customer, error) {
+	query := url.Values{}
+	if options != nil && options.Name != "" {
+		query.Set("name", options.Name)
+	}
+	customers := []Customer{}
+	err := client.do(ctx, request{method: http.MethodGet, path: "/customers", query: query}, &customers)
+	return customers, err
+}
+
+// GetCustomer gets a customer by id
+func (client *Client) GetCustomer(ctx context.Context, id string) (*Customer, error) {
+	var customer Customer
+	err := client.do(ctx, request{method: http.MethodGet, path: "/customers/" + url.PathEscape(id)}, &customer)
+	if err != nil {
+		return nil, err
+	}
+	return &customer, nil
+}
+
+// UpdateCustomer changes the fields of a customer
+func (client *Client) UpdateCustomer(ctx context.Context, id string, update CustomerUpdate) error {
+	return client.do(ctx, request{method: http.MethodPut, path: "/customers/" + url.PathEscape(id), body: update}, nil)
+}
+
+// DeleteCustomer deletes a customer
+func (client *Client) DeleteCustomer(ctx context.Context, id string) error {
+	return client.do(ctx, request{method: http.MethodDelete, path: "/customers/" + url.PathEscape(id)}, nil)
+}
@@ -0,0 +1,93 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Errors to match with errors.Is against an *Error
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrServer       = errors.New("server error")
+)
+
+// Longest error body read from a response
+const maxErrorBody = 64 << 10
+
+// Error is an error response of the API. Handlers answer with a plain text message;
+// authentication, authorization and rate limiting with RFC 7807 problem details.
+type Error struct {
+	StatusCode int
+	// Message is the plain text body or the problem detail
+	Message string
+	// RequestID correlates the error with the server logs
+	RequestID string
+	// RetryAfter is the delay requested by a 429 response
+	RetryAfter time.Duration
+}
+
+// problem is an application/problem+json body
+type problem struct {
+	Title     string `json:"title"`
+	Detail    string `json:"detail"`
+	RequestID string `json:"requestId"`
+}
+
+// newError reads the error response and closes its body
+func newError(response *http.Response) *Error {
+	defer response.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorBody))
+
+	apiError := &Error{
+		StatusCode: response.StatusCode,
+		Message:    strings.TrimSpace(string(body)),
+		RequestID:  response.Header.Get("X-Request-ID"),
+		RetryAfter: retryAfter(response.Header.Get("Retry-After")),
+	}
+	if strings.HasPrefix(response.Header.Get("Content-Type"), "application/problem+json") {
+		var details problem
+		if json.Unmarshal(body, &details) == nil {
+			apiError.Message = details.Detail
+			if apiError.Message == "" {
+				apiError.Message = details.Title
+			}
+			if details.RequestID != "" {
+				apiError.RequestID = details.RequestID
+			}
+		}
+	}
+	return apiError
+}
+
+func (apiError *Error) Error() string {
+	return fmt.Sprintf("sales api: %d %s: %s", apiError.StatusCode, http.StatusText(apiError.StatusCode), apiError.Message)
+}
+
+// Is matches the sentinel error of the status code, e.g. errors.Is(err, client.ErrNotFound)
+func (apiError *Error) Is(target error) bool {
+	switch apiError.StatusCode {
+	case http.StatusBadRequest:
+		return target == ErrBadRequest
+	case http.StatusUnauthorized:
+		return target == ErrUnauthorized
+	case http.StatusForbidden:
+		return target == ErrForbidden
+	case http.StatusNotFound:
+		return target == ErrNotFound
+	case http.StatusConflict:
+		return target == ErrConflict
+	case http.StatusTooManyRequests:
+		return target == ErrRateLimited
+	}
+	return apiError.StatusCode >= http.StatusInternalServerError && target == ErrServer
+}
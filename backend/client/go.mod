@@ -0,0 +1,3 @@
+module github.com/DanVerh/university-swe/backend/client
+
+go 1.23.3
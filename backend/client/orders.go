@@ -0,0 +1,89 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Order statuses
+const (
+	StatusPending    = "pending"
+	StatusProcessing = "processing"
+	StatusShipped    = "shipped"
+	StatusDelivered  = "delivered"
+	StatusCancelled  = "cancelled"
+)
+
+// Order is an order of an amount of a product by a customer
+type Order struct {
+	ID       string  `json:"id,omitempty"`
+	Amount   int32   `json:"amount"`
+	Sum      float64 `json:"sum,omitempty"`
+	Customer string  `json:"customer"`
+	Status   string  `json:"status,omitempty"`
+	Product  string  `json:"product"`
+	// Variant is required for products with variants
+	Variant  string  `json:"variant,omitempty"`
+	Paid     float64 `json:"paid,omitempty"`
+	Refunded float64 `json:"refunded,omitempty"`
+}
+
+// CreateOrder creates an order and returns its id. The sum is computed by the API from the product price.
+func (client *Client) CreateOrder(ctx context.Context, order Order) (string, error) {
+	body := struct {
+		Amount   int32  `json:"amount"`
+		Customer string `json:"customer"`
+		Product  string `json:"product"`
+	}{order.Amount, order.Customer, order.Product}
+
+	// The API confirms with "Order created successfully with ID: <id>"
+	var message string
+	if err := client.do(ctx, request{method: http.MethodPost, path: "/orders", body: body}, &message); err != nil {
+		return "", err
+	}
+	index := strings.LastIndex(message, ": ")
+	if index < 0 {
+		return "", fmt.Errorf("unexpected create order response %q", message)
+	}
+	return strings.TrimSpace(message[index+2:]), nil
+}
+
+// ListOrders lists all orders
+func (client *Client) ListOrders(ctx context.Context) ([]Order, error) {
+	orders := []Order{}
+	err := client.do(ctx, request{method: http.MethodGet, path: "/orders"}, &orders)
+	return orders, err
+}
+
+// GetOrder gets an order by id
+func (client *Client) GetOrder(ctx context.Context, id string) (*Order, error) {
+	var order Order
+	err := client.do(ctx, request{method: http.MethodGet, path: "/orders/" + url.PathEscape(id)}, &order)
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// UpdateOrderStatus changes the status of an order, the only field that can be updated
+func (client *Client) UpdateOrderStatus(ctx context.Context, id, status string) error {
+	body := map[string]string{"status": status}
+	return client.do(ctx, request{method: http.MethodPut, path: "/orders/" + url.PathEscape(id), body: body}, nil)
+}
+
+// DeleteOrder deletes an order
+func (client *Client) DeleteOrder(ctx context.Context, id string) error {
+	return client.do(ctx, request{method: http.MethodDelete, path: "/orders/" + url.PathEscape(id)}, nil)
+}
+
+// SumDeliveredOrders returns the total value of delivered orders
+func (client *Client) SumDeliveredOrders(ctx context.Context) (float64, error) {
+	var result struct {
+		TotalSum float64 `json:"totalSum"`
+	}
+	err := client.do(ctx, request{method: http.MethodGet, path: "/orders/sum"}, &result)
+	return result.TotalSum, err
+}
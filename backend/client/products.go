@@ -0,0 +1,114 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Product is a product of the catalogue
+type Product struct {
+	ID         string          `json:"id,omitempty"`
+	Name       string          `json:"name"`
+	SKU        string          `json:"sku,omitempty"`
+	Barcode    string          `json:"barcode,omitempty"`
+	Price      float64         `json:"price"`
+	Amount     *int32          `json:"amount,omitempty"`
+	Categories []string        `json:"categories,omitempty"`
+	Options    []ProductOption `json:"options,omitempty"`
+	Variants   []Variant       `json:"variants,omitempty"`
+}
+
+// ProductOption is an option axis of a product, e.g. size with its values
+type ProductOption struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+// Variant is a combination of option values of a product with its own SKU and stock
+type Variant struct {
+	ID      string            `json:"id,omitempty"`
+	SKU     string            `json:"sku"`
+	Options map[string]string `json:"options"`
+	// Price overrides the product price when set
+	Price  *float64 `json:"price,omitempty"`
+	Amount int32    `json:"amount"`
+}
+
+// ProductUpdate holds the product fields to change; nil fields are left as they are.
+// An empty Barcode removes the barcode.
+type ProductUpdate struct {
+	Name       *string   `json:"name,omitempty"`
+	SKU        *string   `json:"sku,omitempty"`
+	Barcode    *string   `json:"barcode,omitempty"`
+	Price      *float64  `json:"price,omitempty"`
+	Amount     *int32    `json:"amount,omitempty"`
+	Categories *[]string `json:"categories,omitempty"`
+}
+
+// ListProductsOptions filters ListProducts
+type ListProductsOptions struct {
+	// Name is a case-insensitive search of the product name
+	Name string
+}
+
+// CreateProduct creates a product with a stock amount of zero
+func (client *Client) CreateProduct(ctx context.Context, product Product) (*Product, error) {
+	var created Product
+	err := client.do(ctx, request{method: http.MethodPost, path: "/products", body: product}, &created)
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// ListProducts lists all products or those matching the options
+func (client *Client) ListProducts(ctx context.Context, options *ListProductsOptions) ([]Product, error) {
+	query := url.Values{}
+	if options != nil && options.Name != "" {
+		query.Set("name", options.Name)
+	}
+	products := []Product{}
+	err := client.do(ctx, request{method: http.MethodGet, path: "/products", query: query}, &products)
+	return products, err
+}
+
+// GetProduct gets a product by id
+func (client *Client) GetProduct(ctx context.Context, id string) (*Product, error) {
+	var product Product
+	err := client.do(ctx, request{method: http.MethodGet, path: "/products/" + url.PathEscape(id)}, &product)
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// GetProductBySKU gets the product with the SKU or with a variant with the SKU
+func (client *Client) GetProductBySKU(ctx context.Context, sku string) (*Product, error) {
+	var product Product
+	err := client.do(ctx, request{method: http.MethodGet, path: "/products/by-sku/" + url.PathEscape(sku)}, &product)
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// GetProductByBarcode gets the product with an EAN-13 or UPC-A barcode
+func (client *Client) GetProductByBarcode(ctx context.Context, code string) (*Product, error) {
+	var product Product
+	err := client.do(ctx, request{method: http.MethodGet, path: "/products/by-barcode/" + url.PathEscape(code)}, &product)
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// UpdateProduct changes the fields of a product
+func (client *Client) UpdateProduct(ctx context.Context, id string, update ProductUpdate) error {
+	return client.do(ctx, request{method: http.MethodPut, path: "/products/" + url.PathEscape(id), body: update}, nil)
+}
+
+// DeleteProduct deletes a product
+func (client *Client) DeleteProduct(ctx context.Context, id string) error {
+	return client.do(ctx, request{method: http.MethodDelete, path: "/products/" + url.PathEscape(id)}, nil)
+}
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ReportOptions filters reports by order date and status. Zero values are omitted.
+type ReportOptions struct {
+	From     time.Time
+	To       time.Time
+	Timezone string
+	Status   string
+	// Limit is the number of entries of rankings
+	Limit int
+}
+
+// SalesGroup holds the sales figures of a single group
+type SalesGroup struct {
+	Key               interface{} `json:"key"`
+	Name              string      `json:"name,omitempty"`
+	Orders            int64       `json:"orders"`
+	Quantity          int64       `json:"quantity"`
+	Revenue           float64     `json:"revenue"`
+	AverageOrderValue float64     `json:"averageOrderValue"`
+}
+
+// SalesReport holds sales totals per group
+type SalesReport struct {
+	GroupBy string       `json:"groupBy"`
+	Status  string       `json:"status,omitempty"`
+	Groups  []SalesGroup `json:"groups"`
+	Totals  SalesGroup   `json:"totals"`
+}
+
+// ProductRanking holds the sales figures of a single product
+type ProductRanking struct {
+	Product string  `json:"product"`
+	Name    string  `json:"name,omitempty"`
+	Units   int64   `json:"units"`
+	Revenue float64 `json:"revenue"`
+	Orders  int64   `json:"orders"`
+}
+
+// CustomerValue holds the lifetime figures of a single customer
+type CustomerValue struct {
+	Customer      string    `json:"customer"`
+	Name          string    `json:"name,omitempty"`
+	LifetimeValue float64   `json:"lifetimeValue"`
+	Orders        int64     `json:"orders"`
+	LastOrderDate time.Time `json:"lastOrderDate"`
+}
+
+// Sales returns sales totals grouped by status, product, customer, day, week or month.
+// Without a status cancelled orders are not counted.
+func (client *Client) Sales(ctx context.Context, groupBy string, options *ReportOptions) (*SalesReport, error) {
+	query := options.values()
+	query.Set("groupBy", groupBy)
+	var report SalesReport
+	if err := client.do(ctx, request{method: http.MethodGet, path: "/reports/sales", query: query}, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// TopProducts returns the best selling products by revenue or units
+func (client *Client) TopProducts(ctx context.Context, by string, options *ReportOptions) ([]ProductRanking, error) {
+	query := options.values()
+	query.Set("by", by)
+	products := []ProductRanking{}
+	err := client.do(ctx, request{method: http.MethodGet, path: "/reports/top-products", query: query}, &products)
+	return products, err
+}
+
+// TopCustomers returns the most valuable customers by value or orders
+func (client *Client) TopCustomers(ctx context.Context, by string, options *ReportOptions) ([]CustomerValue, error) {
+	query := options.values()
+	query.Set("by", by)
+	customers := []CustomerValue{}
+	err := client.do(ctx, request{method: http.MethodGet, path: "/reports/top-customers", query: query}, &customers)
+	return customers, err
+}
+
+func (options *ReportOptions) values() url.Values {
+	query := url.Values{}
+	if options == nil {
+		return query
+	}
+	if !options.From.IsZero() {
+		query.Set("from", options.From.Format(time.RFC3339))
+	}
+	if !options.To.IsZero() {
+		query.Set("to", options.To.Format(time.RFC3339))
+	}
+	if options.Timezone != "" {
+		query.Set("tz", options.Timezone)
+	}
+	if options.Status != "" {
+		query.Set("status", options.Status)
+	}
+	if options.Limit > 0 {
+		query.Set("limit", strconv.Itoa(options.Limit))
+	}
+	return query
+}